@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/projector/serve"
+)
+
+type commands struct {
+	storage persist.ReadWriter
+	stdout  io.Writer
+	stderr  io.Writer
+	listen  func(string, http.Handler) error
+}
+
+func newCommands(storage persist.ReadWriter, stdout, stderr io.Writer) *commands {
+	return &commands{storage: storage, stdout: stdout, stderr: stderr, listen: http.ListenAndServe}
+}
+
+func (this *commands) Run(name string, args []string) int {
+	var err error
+
+	switch name {
+	case "get":
+		err = this.get(args)
+	case "stat":
+		err = this.stat(args)
+	case "diff":
+		return this.diff(args)
+	case "put":
+		err = this.put(args)
+	case "switch":
+		err = this.switchVersion(args)
+	case "rollback":
+		err = this.rollback(args)
+	case "serve":
+		err = this.serve(args)
+	default:
+		err = fmt.Errorf("unrecognized command: '%s'", name)
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintln(this.stderr, "[ERROR]", err)
+		return 1
+	}
+
+	return 0
+}
+
+func (this *commands) get(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: get <path>")
+	}
+
+	document, err := this.read(args[0])
+	if err != nil {
+		return err
+	}
+
+	pretty, err := document.Pretty()
+	if err != nil {
+		return err
+	}
+
+	_, err = this.stdout.Write(pretty)
+	return err
+}
+
+func (this *commands) stat(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: stat <path>")
+	}
+
+	document, err := this.read(args[0])
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(this.stdout, "Path:    %s\n", document.Path())
+	_, _ = fmt.Fprintf(this.stdout, "Storage: %s\n", this.storage.Name())
+	_, _ = fmt.Fprintf(this.stdout, "Version: %v\n", document.Version())
+	_, _ = fmt.Fprintf(this.stdout, "Size:    %d\n", len(document.body))
+
+	var names []string
+	for name := range document.metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, _ = fmt.Fprintf(this.stdout, "%s: %s\n", name, strings.Join(document.metadata[name], ", "))
+	}
+
+	return nil
+}
+
+// diff returns the exit status of the comparison: zero if the documents match,
+// one if they differ, and two if there was trouble, just like diff(1).
+func (this *commands) diff(args []string) int {
+	if len(args) != 2 {
+		_, _ = fmt.Fprintln(this.stderr, "[ERROR] usage: diff <path|file:local.json> <path|file:local.json>")
+		return 2
+	}
+
+	left, err := this.source(args[0])
+	if err != nil {
+		_, _ = fmt.Fprintln(this.stderr, "[ERROR]", err)
+		return 2
+	}
+
+	right, err := this.source(args[1])
+	if err != nil {
+		_, _ = fmt.Fprintln(this.stderr, "[ERROR]", err)
+		return 2
+	}
+
+	_, _ = fmt.Fprintf(this.stdout, "--- %s\n+++ %s\n", args[0], args[1])
+	if diffLines(this.stdout, left, right) {
+		return 1
+	}
+
+	return 0
+}
+func (this *commands) source(name string) (string, error) {
+	var document *rawDocument
+
+	if strings.HasPrefix(name, localFilePrefix) {
+		document = newRawDocument(name)
+		if raw, err := ioutil.ReadFile(strings.TrimPrefix(name, localFilePrefix)); err != nil {
+			return "", err
+		} else if err = json.Unmarshal(raw, document); err != nil {
+			return "", err
+		}
+	} else if read, err := this.read(name); err != nil {
+		return "", err
+	} else {
+		document = read
+	}
+
+	pretty, err := document.Pretty()
+	return string(pretty), err
+}
+
+func (this *commands) put(args []string) error {
+	flags := flag.NewFlagSet("put", flag.ContinueOnError)
+	flags.SetOutput(this.stderr)
+	expected := flags.String("if-version", "", "Only write when the stored version matches this value\n"+
+		"(a precondition of the write, except on S3, where it is only compared before writing).")
+	if err := flags.Parse(args); err != nil {
+		return err
+	} else if flags.NArg() != 2 {
+		return errors.New("usage: put [-if-version <version>] <path> <local.json>")
+	}
+
+	raw, err := ioutil.ReadFile(flags.Arg(1))
+	if err != nil {
+		return err
+	} else if !json.Valid(raw) {
+		return fmt.Errorf("file does not contain valid JSON: '%s'", flags.Arg(1))
+	}
+
+	// reading first establishes the current version (generation/etag) of the document
+	// and that version is then used as the precondition when writing it back.
+	document, err := this.read(flags.Arg(0))
+	if err != nil && err != errDocumentNotFound {
+		return err
+	}
+
+	if len(*expected) > 0 {
+		if current := storedVersion(document); current != *expected {
+			return fmt.Errorf("%s (expected version '%s', found '%s')", persist.ErrConcurrentWrite, *expected, current)
+		}
+		document.SetVersion(*expected) // the precondition of the write
+	}
+
+	if err = document.UnmarshalJSON(raw); err != nil {
+		return err
+	}
+	if err = this.storage.Write(document); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(this.stdout, "Version: %v\n", document.Version())
+	return nil
+}
+
+// storedVersion gives back the version of the document as read, which is empty when there is
+// no such document.
+func storedVersion(document *rawDocument) string {
+	if version := document.Version(); version != nil {
+		return fmt.Sprint(version)
+	}
+	return ""
+}
+
+func (this *commands) switchVersion(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: switch <pointer-path> <version>")
+	}
+
+	versions := persist.NewProjectionVersions(this.storage, args[0])
+	if err := versions.Switch(args[1]); err != nil {
+		return err
+	}
+	return this.showPointer(versions)
+}
+func (this *commands) rollback(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: rollback <pointer-path>")
+	}
+
+	versions := persist.NewProjectionVersions(this.storage, args[0])
+	if err := versions.Rollback(); err != nil {
+		return err
+	}
+	return this.showPointer(versions)
+}
+func (this *commands) showPointer(versions *persist.ProjectionVersions) error {
+	pointer, err := versions.Pointer()
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(this.stdout, "Current:  %s\n", pointer.Current)
+	_, _ = fmt.Fprintf(this.stdout, "Previous: %s\n", strings.Join(pointer.Previous, ", "))
+	return nil
+}
+
+func (this *commands) serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(this.stderr)
+	address := flags.String("listen", ":8080", "The address on which to listen.")
+	capacity := flags.Int("cache", 1024, "The number of documents cached in memory (zero disables the cache).")
+	maxAge := flags.Duration("max-age", time.Second*5, "How long a cached document is served before it is validated against storage.")
+	compress := flags.Bool("gzip", true, "Serve documents compressed to clients accepting gzip.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	} else if flags.NArg() != 0 {
+		return errors.New("usage: serve [-listen <address>] [-cache <documents>] [-max-age <duration>] [-gzip=<bool>]")
+	}
+
+	handler := serve.NewHandler(this.storage).WithCache(*capacity, *maxAge)
+	if *compress {
+		handler.WithGzip()
+	}
+
+	_, _ = fmt.Fprintf(this.stdout, "Serving documents from %s on %s\n", this.storage.Name(), *address)
+	return this.listen(*address, handler)
+}
+
+func (this *commands) read(path string) (*rawDocument, error) {
+	document := newRawDocument(path)
+	if err := this.storage.Read(document); err != nil {
+		return nil, err
+	} else if !document.Exists() {
+		return document, errDocumentNotFound
+	} else {
+		return document, nil
+	}
+}
+
+const localFilePrefix = "file:"
+
+var errDocumentNotFound = errors.New("document not found")
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+func TestCommandsFixture(t *testing.T) {
+	gunit.Run(new(CommandsFixture), t)
+}
+
+type CommandsFixture struct {
+	*gunit.Fixture
+
+	storage  *FakeStorage
+	stdout   *bytes.Buffer
+	stderr   *bytes.Buffer
+	commands *commands
+	folder   string
+}
+
+func (this *CommandsFixture) Setup() {
+	this.storage = &FakeStorage{documents: map[string]string{}, versions: map[string]int{}}
+	this.stdout = bytes.NewBuffer(nil)
+	this.stderr = bytes.NewBuffer(nil)
+	this.commands = newCommands(this.storage, this.stdout, this.stderr)
+	this.folder, _ = ioutil.TempDir("", "projector")
+}
+func (this *CommandsFixture) Teardown() {
+	_ = os.RemoveAll(this.folder)
+}
+
+func (this *CommandsFixture) TestGetPrettyPrintsDocument() {
+	this.storage.store("/a.json", `{"a":1}`)
+
+	status := this.commands.Run("get", []string{"/a.json"})
+
+	this.So(status, should.Equal, 0)
+	this.So(this.stdout.String(), should.Equal, "{\n  \"a\": 1\n}\n")
+}
+func (this *CommandsFixture) TestGetMissingDocumentFails() {
+	status := this.commands.Run("get", []string{"/missing.json"})
+
+	this.So(status, should.Equal, 1)
+	this.So(this.stderr.String(), should.ContainSubstring, errDocumentNotFound.Error())
+}
+
+func (this *CommandsFixture) TestStatShowsVersionAndSize() {
+	this.storage.store("/a.json", `{"a":1}`)
+
+	status := this.commands.Run("stat", []string{"/a.json"})
+
+	this.So(status, should.Equal, 0)
+	this.So(this.stdout.String(), should.ContainSubstring, "Version: 1\n")
+	this.So(this.stdout.String(), should.ContainSubstring, "Size:    7\n")
+}
+
+func (this *CommandsFixture) TestDiffReportsChangedLines() {
+	this.storage.store("/a.json", `{"a":1,"b":2}`)
+	local := this.writeLocal("b.json", `{"a":1,"b":3}`)
+
+	status := this.commands.Run("diff", []string{"/a.json", "file:" + local})
+
+	this.So(status, should.Equal, 1)
+	this.So(this.stdout.String(), should.ContainSubstring, "-  \"b\": 2\n+  \"b\": 3\n")
+}
+func (this *CommandsFixture) TestDiffOfIdenticalDocuments() {
+	this.storage.store("/a.json", `{"a":1}`)
+	this.storage.store("/b.json", `{ "a": 1 }`)
+
+	status := this.commands.Run("diff", []string{"/a.json", "/b.json"})
+
+	this.So(status, should.Equal, 0)
+}
+
+func (this *CommandsFixture) TestPutWritesLocalFile() {
+	this.storage.store("/a.json", `{"a":1}`)
+	local := this.writeLocal("a.json", `{"a":2}`)
+
+	status := this.commands.Run("put", []string{"-if-version", "1", "/a.json", local})
+
+	this.So(status, should.Equal, 0)
+	this.So(this.storage.documents["/a.json"], should.Equal, `{"a":2}`)
+	this.So(this.stdout.String(), should.Equal, "Version: 2\n")
+	this.So(this.storage.written, should.Resemble, []interface{}{"1"})
+}
+func (this *CommandsFixture) TestPutExpectingVersionOfMissingDocumentRejected() {
+	local := this.writeLocal("a.json", `{"a":1}`)
+
+	status := this.commands.Run("put", []string{"-if-version", "1", "/a.json", local})
+
+	this.So(status, should.Equal, 1)
+	this.So(this.stderr.String(), should.ContainSubstring, "found ''")
+	this.So(this.storage.documents, should.BeEmpty)
+}
+func (this *CommandsFixture) TestPutRejectedWhenVersionChanged() {
+	this.storage.store("/a.json", `{"a":1}`)
+	this.storage.store("/a.json", `{"a":2}`)
+	local := this.writeLocal("a.json", `{"a":3}`)
+
+	status := this.commands.Run("put", []string{"-if-version", "1", "/a.json", local})
+
+	this.So(status, should.Equal, 1)
+	this.So(this.stderr.String(), should.ContainSubstring, persist.ErrConcurrentWrite.Error())
+	this.So(this.storage.documents["/a.json"], should.Equal, `{"a":2}`)
+}
+func (this *CommandsFixture) TestPutRejectsInvalidJSON() {
+	local := this.writeLocal("a.json", `not json`)
+
+	status := this.commands.Run("put", []string{"/a.json", local})
+
+	this.So(status, should.Equal, 1)
+	this.So(this.storage.documents, should.BeEmpty)
+}
+
+func (this *CommandsFixture) TestSwitchAndRollbackProjectionVersion() {
+	this.So(this.commands.Run("switch", []string{"/projections.json", "v1"}), should.Equal, 0)
+	this.So(this.commands.Run("switch", []string{"/projections.json", "v2"}), should.Equal, 0)
+	this.So(this.stdout.String(), should.EndWith, "Current:  v2\nPrevious: v1\n")
+
+	this.So(this.commands.Run("rollback", []string{"/projections.json"}), should.Equal, 0)
+	this.So(this.stdout.String(), should.EndWith, "Current:  v1\nPrevious: \n")
+
+	this.So(this.commands.Run("rollback", []string{"/projections.json"}), should.Equal, 1)
+	this.So(this.stderr.String(), should.ContainSubstring, persist.ErrNoPreviousVersion.Error())
+}
+
+func (this *CommandsFixture) TestServeListensWithDocumentHandler() {
+	this.storage.store("/a.json", `{"a":1}`)
+	var served http.Handler
+	this.commands.listen = func(address string, handler http.Handler) error {
+		this.So(address, should.Equal, ":9090")
+		served = handler
+		return nil
+	}
+
+	status := this.commands.Run("serve", []string{"-listen", ":9090"})
+
+	this.So(status, should.Equal, 0)
+	recorder := httptest.NewRecorder()
+	served.ServeHTTP(recorder, httptest.NewRequest("GET", "/a.json", nil))
+	this.So(recorder.Body.String(), should.Equal, `{"a":1}`)
+	this.So(recorder.Header().Get("ETag"), should.Equal, `"1"`)
+}
+
+func (this *CommandsFixture) writeLocal(name, contents string) string {
+	filename := filepath.Join(this.folder, name)
+	_ = ioutil.WriteFile(filename, []byte(contents), 0644)
+	return filename
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeStorage struct {
+	documents map[string]string
+	versions  map[string]int
+	written   []interface{} // the version of each write, its precondition
+}
+
+func (this *FakeStorage) store(path, contents string) {
+	this.documents[path] = contents
+	this.versions[path]++
+}
+
+func (this *FakeStorage) Name() string                          { return "Fake" }
+func (this *FakeStorage) ReadPanic(document projector.Document) { panic("nop") }
+func (this *FakeStorage) Read(document projector.Document) error {
+	if contents, found := this.documents[document.Path()]; found {
+		document.SetVersion(strconv.Itoa(this.versions[document.Path()]))
+		return json.Unmarshal([]byte(contents), document)
+	}
+	return nil
+}
+func (this *FakeStorage) Write(document projector.Document) error {
+	this.written = append(this.written, document.Version())
+	if version, _ := document.Version().(string); len(version) > 0 && version != strconv.Itoa(this.versions[document.Path()]) {
+		return persist.ErrConcurrentWrite
+	}
+
+	raw, _ := json.Marshal(document)
+	this.store(document.Path(), string(raw))
+	document.SetVersion(strconv.Itoa(this.versions[document.Path()]))
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// diffLines writes a minimal line-oriented diff (in the spirit of "diff -u", but without hunks)
+// of the two inputs and reports whether any differences were found.
+func diffLines(writer io.Writer, left, right string) (changed bool) {
+	a, b := splitLines(left), splitLines(right)
+	lengths := longestCommonSubsequence(a, b)
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			_, _ = fmt.Fprintln(writer, " "+a[i])
+			i++
+			j++
+		} else if lengths[i+1][j] >= lengths[i][j+1] {
+			_, _ = fmt.Fprintln(writer, "-"+a[i])
+			changed = true
+			i++
+		} else {
+			_, _ = fmt.Fprintln(writer, "+"+b[j])
+			changed = true
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		_, _ = fmt.Fprintln(writer, "-"+a[i])
+		changed = true
+	}
+	for ; j < len(b); j++ {
+		_, _ = fmt.Fprintln(writer, "+"+b[j])
+		changed = true
+	}
+
+	return changed
+}
+func splitLines(value string) []string {
+	value = strings.TrimSuffix(value, "\n")
+	if len(value) == 0 {
+		return nil
+	}
+	return strings.Split(value, "\n")
+}
+
+// longestCommonSubsequence computes the suffix table where [i][j] holds the length
+// of the longest common subsequence of a[i:] and b[j:].
+func longestCommonSubsequence(a, b []string) [][]int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	return lengths
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/smartystreets/projector"
+)
+
+// rawDocument is a projector.Document which holds the raw JSON of whatever
+// happens to be stored at the path rather than a concrete, typed projection.
+type rawDocument struct {
+	path     string
+	body     json.RawMessage
+	version  interface{}
+	metadata http.Header
+}
+
+func newRawDocument(path string) *rawDocument {
+	return &rawDocument{path: path}
+}
+
+func (this *rawDocument) Lapse(time.Time) projector.Document { return this }
+func (this *rawDocument) Apply(interface{}) bool             { return false }
+func (this *rawDocument) Path() string                       { return this.path }
+
+func (this *rawDocument) Reset()                         { this.body = nil; this.version = nil; this.metadata = nil }
+func (this *rawDocument) SetVersion(value interface{})   { this.version = value }
+func (this *rawDocument) Version() interface{}           { return this.version }
+func (this *rawDocument) SetMetadata(values http.Header) { this.metadata = values }
+
+func (this *rawDocument) Exists() bool { return len(this.body) > 0 }
+
+func (this *rawDocument) MarshalJSON() ([]byte, error) {
+	if len(this.body) == 0 {
+		return []byte("null"), nil
+	}
+	return this.body, nil
+}
+func (this *rawDocument) UnmarshalJSON(raw []byte) error {
+	this.body = append(this.body[0:0], raw...)
+	return nil
+}
+
+func (this *rawDocument) Pretty() ([]byte, error) {
+	if len(this.body) == 0 {
+		return nil, nil
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	if err := json.Indent(buffer, this.body, "", "  "); err != nil {
+		return nil, err
+	}
+
+	buffer.WriteString("\n")
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,115 @@
+// Command projector inspects, edits, and serves (read-only, over HTTP) projected documents
+// held in any of the storage engines supported by anypersist.
+//
+// Usage:
+//
+//	projector [flags] get <path>
+//	projector [flags] stat <path>
+//	projector [flags] diff <path|file:local.json> <path|file:local.json>
+//	projector [flags] put [-if-version <version>] <path> <local.json>
+//	projector [flags] switch <pointer-path> <version>
+//	projector [flags] rollback <pointer-path>
+//	projector [flags] serve [-listen <address>] [-cache <documents>] [-max-age <duration>] [-gzip=<bool>]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/projector/persist/anypersist"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) (status int) {
+	flags := flag.NewFlagSet("projector", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	config := parseConfig(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	} else if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	storage, err := config.Build()
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, "[ERROR]", err)
+		return 1
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			_, _ = fmt.Fprintln(stderr, "[ERROR]", recovered)
+			status = 1
+		}
+	}()
+
+	command := newCommands(storage, stdout, stderr)
+	return command.Run(flags.Arg(0), flags.Args()[1:])
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type config struct {
+	dsn               string
+	engine            string
+	address           string
+	accessKey         string
+	secretKey         string
+	bucketName        string
+	pathPrefix        string
+	serviceAccountKey string
+	timeout           time.Duration
+	retries           uint64
+}
+
+func parseConfig(flags *flag.FlagSet) *config {
+	this := &config{}
+	flags.StringVar(&this.dsn, "dsn", os.Getenv("PROJECTOR_STORAGE_DSN"), "The storage DSN (e.g. 's3://bucket/prefix', 'gcs://bucket/prefix', 'file:///path'); overrides the engine-specific flags.")
+	flags.StringVar(&this.engine, "engine", os.Getenv("PROJECTOR_ENGINE"), "The storage engine: 's3' or 'gcs'.")
+	flags.StringVar(&this.address, "address", os.Getenv("PROJECTOR_STORAGE_ADDRESS"), "The S3 storage address (bucket and prefix).")
+	flags.StringVar(&this.accessKey, "access-key", os.Getenv("AWS_ACCESS_KEY_ID"), "The AWS access key.")
+	flags.StringVar(&this.secretKey, "secret-key", os.Getenv("AWS_SECRET_ACCESS_KEY"), "The AWS secret key.")
+	flags.StringVar(&this.bucketName, "bucket", os.Getenv("PROJECTOR_BUCKET_NAME"), "The GCS bucket name.")
+	flags.StringVar(&this.pathPrefix, "prefix", os.Getenv("PROJECTOR_PATH_PREFIX"), "The GCS path prefix.")
+	flags.StringVar(&this.serviceAccountKey, "service-account-key", os.Getenv("PROJECTOR_SERVICE_ACCOUNT_KEY"), "The base64-encoded GCS service account key.")
+	flags.DurationVar(&this.timeout, "timeout", time.Second*10, "The timeout of each HTTP request.")
+	flags.Uint64Var(&this.retries, "retries", 3, "The maximum number of retries of each HTTP request.")
+	return this
+}
+
+func (this *config) Build() (persist.ReadWriter, error) {
+	engine, err := this.engineOption()
+	if err != nil {
+		return nil, err
+	}
+
+	return anypersist.New(
+		engine,
+		anypersist.TimeoutAfter(this.timeout),
+		anypersist.MaxRetries(this.retries),
+	).Build()
+}
+func (this *config) engineOption() (anypersist.Option, error) {
+	if len(this.dsn) > 0 {
+		return anypersist.DSN(this.dsn), nil
+	}
+
+	address, err := url.Parse(this.address)
+	if err != nil {
+		return nil, err
+	}
+
+	return anypersist.Choose(this.engine, address, this.accessKey, this.secretKey,
+		context.Background(), this.bucketName, this.pathPrefix, this.serviceAccountKey), nil
+}
@@ -0,0 +1,50 @@
+package projector
+
+// DeliveryID identifies a delivery by the source which published it and its ID there.
+type DeliveryID struct {
+	SourceID  uint64
+	MessageID uint64
+}
+
+// DeduplicatingDocument is implemented by documents which remember the deliveries already
+// applied to them, so that a message redelivered (e.g. after a crash between the write of the
+// document and the acknowledgement of the delivery) isn't applied twice.
+type DeduplicatingDocument interface {
+	Document
+	Applied(DeliveryID) bool
+	Remember(DeliveryID)
+}
+
+// DeliveryWindow, when embedded in a document, implements DeduplicatingDocument by keeping the
+// most recent deliveries applied, which are serialized (and so persisted) with the document.
+// Documents embedding it should clear it from Reset.
+type DeliveryWindow struct {
+	AppliedDeliveries []DeliveryID `json:",omitempty"`
+	capacity          int
+}
+
+// SetDeliveryWindowCapacity bounds the number of deliveries remembered (DefaultDeliveryWindow by default).
+func (this *DeliveryWindow) SetDeliveryWindowCapacity(capacity int) { this.capacity = capacity }
+
+func (this *DeliveryWindow) Applied(id DeliveryID) bool {
+	for _, applied := range this.AppliedDeliveries {
+		if applied == id {
+			return true
+		}
+	}
+	return false
+}
+func (this *DeliveryWindow) Remember(id DeliveryID) {
+	capacity := this.capacity
+	if capacity <= 0 {
+		capacity = DefaultDeliveryWindow
+	}
+
+	this.AppliedDeliveries = append(this.AppliedDeliveries, id)
+	if excess := len(this.AppliedDeliveries) - capacity; excess > 0 {
+		this.AppliedDeliveries = append(this.AppliedDeliveries[0:0], this.AppliedDeliveries[excess:]...)
+	}
+}
+func (this *DeliveryWindow) Reset() { this.AppliedDeliveries = nil }
+
+const DefaultDeliveryWindow = 1024
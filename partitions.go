@@ -0,0 +1,11 @@
+package projector
+
+// PartitionedDocument is implemented by time-partitioned documents, each period of which is
+// written to a path of its own. As each partition is written the transformer records it in a
+// manifest listing every partition written and in an alias naming the latest partition, at
+// the paths provided (either of which may be empty).
+type PartitionedDocument interface {
+	Document
+	ManifestPath() string
+	LatestPath() string
+}
@@ -0,0 +1,12 @@
+package projector
+
+import "time"
+
+// PeriodicDocument is implemented by documents which hold the messages of a period of time
+// (e.g. a day), lapsing in favor of the document of the next period once it has passed. When
+// late messages are allowed, Covers decides which document, the current one or one of those
+// recently lapsed, a late message belongs to.
+type PeriodicDocument interface {
+	Document
+	Covers(at time.Time) bool
+}
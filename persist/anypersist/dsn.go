@@ -0,0 +1,191 @@
+package anypersist
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DSN configures the storage engine from a single URL-style data source name:
+//
+//	s3://bucket/prefix?region=us-west-1&access_key=...&secret_key=...
+//	s3://bucket.s3.us-west-2.amazonaws.com/prefix
+//	s3://bucket.host:port/prefix (or s3://bucket/prefix?endpoint=host[:port])
+//	s3://bucket/prefix?credentials=ambient
+//	gcs://bucket/prefix?credentials=file:/path/to/service-account.json
+//	gcs://bucket/prefix?auth=oauth (bearer tokens; credentials are optional)
+//	file:///path/to/root
+//	mem://
+//
+// Bucket names may contain dots, in which case a custom endpoint is given with the endpoint
+// parameter and S3 itself is addressed path-style (its certificate doesn't cover such names).
+// References to environment variables (e.g. ${AWS_SECRET_ACCESS_KEY}) are expanded before
+// the DSN is parsed and secrets may also be given as "env:NAME", "file:/path", or "base64:...".
+// Problems with the DSN are reported by Build along with any other configuration problems.
+func DSN(value string) Option {
+	return func(this *Wireup) { this.dsn = strings.TrimSpace(value) }
+}
+
+// Environment overrides how environment variables referenced by the DSN are resolved.
+func Environment(lookup func(string) (string, bool)) Option {
+	return func(this *Wireup) { this.lookup = lookup }
+}
+
+func (this *Wireup) applyDSN() (problems []error) {
+	expanded := os.Expand(this.dsn, func(name string) string {
+		value, found := this.lookup(name)
+		if !found {
+			problems = append(problems, fmt.Errorf("DSN references undefined environment variable: '%s'", name))
+		}
+		return value
+	})
+
+	parsed, err := url.Parse(expanded)
+	if err != nil {
+		return append(problems, fmt.Errorf("malformed DSN: %s", err))
+	}
+
+	switch parsed.Scheme {
+	case "s3":
+		return append(problems, this.applyS3DSN(parsed)...)
+	case "gcs", "gs":
+		return append(problems, this.applyGCSDSN(parsed)...)
+	case "file":
+		this.engine = engineFile
+		this.root = parsed.Path
+		return problems
+	case "mem":
+		this.engine = engineMemory
+		return problems
+	default:
+		return append(problems, fmt.Errorf("unrecognized DSN scheme: '%s'", parsed.Scheme))
+	}
+}
+func (this *Wireup) applyS3DSN(parsed *url.URL) (problems []error) {
+	query := parsed.Query()
+	bucket, host := splitBucketHost(parsed.Host, query.Get("endpoint"))
+	region := query.Get("region")
+	scheme := query.Get("scheme")
+	if len(scheme) == 0 {
+		scheme = "https"
+	}
+
+	if len(host) == 0 && len(region) > 0 && region != "us-east-1" {
+		host = "s3." + region + ".amazonaws.com"
+	} else if len(host) == 0 {
+		host = "s3.amazonaws.com"
+	}
+
+	address := &url.URL{Scheme: scheme, Path: "/" + strings.Trim(parsed.Path, "/")}
+	if strings.HasSuffix(host, ".amazonaws.com") && !strings.Contains(bucket, ".") {
+		address.Host = bucket + "." + host
+	} else {
+		address.Host = host // path-style: custom endpoints and dotted bucket names
+		address.Path = "/" + strings.Trim(bucket+"/"+strings.Trim(parsed.Path, "/"), "/")
+	}
+
+	if query.Get("credentials") == "ambient" {
+		AmbientS3Credentials()(this)
+	}
+
+	accessKey, err := this.resolveSecret(firstNonBlank(query.Get("access_key"), "env:AWS_ACCESS_KEY_ID"))
+	problems = appendProblem(problems, err)
+	secretKey, err := this.resolveSecret(firstNonBlank(query.Get("secret_key"), "env:AWS_SECRET_ACCESS_KEY"))
+	problems = appendProblem(problems, err)
+
+	if len(bucket) == 0 {
+		address = nil // reported by validation
+	}
+
+	S3(address, string(accessKey), string(secretKey))(this)
+	return problems
+}
+func (this *Wireup) applyGCSDSN(parsed *url.URL) (problems []error) {
+	query := parsed.Query()
+	if query.Get("auth") == "oauth" {
+		GoogleCloudStorageTokens()(this)
+	}
+
+	credentials, err := this.resolveSecret(firstNonBlank(query.Get("credentials"), "env:GOOGLE_APPLICATION_CREDENTIALS_JSON"))
+	problems = appendProblem(problems, err)
+
+	GoogleCloudStorage(this.context, parsed.Host, strings.Trim(parsed.Path, "/"), credentials)(this)
+	return problems
+}
+
+// resolveSecret interprets values of the form "env:NAME", "file:/path", and "base64:..."
+// and otherwise returns the value as is.
+func (this *Wireup) resolveSecret(value string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		if resolved, found := this.lookup(name); found {
+			return []byte(strings.TrimSpace(resolved)), nil
+		}
+		return nil, nil // absent secrets are reported by the engine-specific validation
+	case strings.HasPrefix(value, "file:"):
+		raw, err := ioutil.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read secret: %s", err)
+		}
+		return raw, nil
+	case strings.HasPrefix(value, "base64:"):
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, "base64:"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode base64 secret: %s", err)
+		}
+		return raw, nil
+	default:
+		return []byte(value), nil
+	}
+}
+
+// splitBucketHost separates the bucket from the host of S3 (at its "s3" label) or from the
+// host of a custom endpoint (which has a port); otherwise the whole value is the bucket.
+func splitBucketHost(value, endpoint string) (bucket, host string) {
+	if len(endpoint) > 0 {
+		return value, endpoint
+	} else if strings.HasSuffix(value, ".amazonaws.com") {
+		index := strings.LastIndex(value, ".s3.")
+		if dashed := strings.LastIndex(value, ".s3-"); dashed > index {
+			index = dashed
+		}
+		if index < 0 {
+			return "", value
+		}
+		return value[:index], value[index+1:]
+	} else if index := strings.Index(value, "."); index >= 0 && strings.Contains(value, ":") {
+		return value[:index], value[index+1:]
+	}
+	return value, ""
+}
+func firstNonBlank(values ...string) string {
+	for _, value := range values {
+		if len(strings.TrimSpace(value)) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+func appendProblem(problems []error, err error) []error {
+	if err != nil {
+		return append(problems, err)
+	}
+	return problems
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// ConfigurationError aggregates every problem found while validating the configuration.
+type ConfigurationError []error
+
+func (this ConfigurationError) Error() string {
+	messages := make([]string, 0, len(this))
+	for _, problem := range this {
+		messages = append(messages, problem.Error())
+	}
+	return "invalid storage configuration: " + strings.Join(messages, "; ")
+}
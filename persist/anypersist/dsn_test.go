@@ -0,0 +1,156 @@
+package anypersist
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector/persist/filepersist"
+	"github.com/smartystreets/projector/persist/mempersist"
+)
+
+func TestDSNFixture(t *testing.T) {
+	gunit.Run(new(DSNFixture), t)
+}
+
+type DSNFixture struct {
+	*gunit.Fixture
+
+	environment map[string]string
+}
+
+func (this *DSNFixture) Setup() {
+	this.environment = map[string]string{
+		"AWS_ACCESS_KEY_ID":     "access",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+	}
+}
+func (this *DSNFixture) lookup(name string) (string, bool) {
+	value, found := this.environment[name]
+	return value, found
+}
+func (this *DSNFixture) build(options ...Option) (*Wireup, error) {
+	wireup := New(append([]Option{Environment(this.lookup)}, options...)...)
+	_, err := wireup.Build()
+	return wireup, err
+}
+
+func (this *DSNFixture) TestS3WithRegionAndCredentialsFromEnvironment() {
+	wireup, err := this.build(DSN("s3://bucket/some/prefix?region=us-west-1"))
+
+	this.So(err, should.BeNil)
+	this.So(wireup.engine, should.Equal, engineS3)
+	this.So(wireup.s3address.String(), should.Equal, "https://bucket.s3.us-west-1.amazonaws.com/some/prefix")
+	this.So(wireup.awsAccessKey, should.Equal, "access")
+	this.So(wireup.awsSecretKey, should.Equal, "secret")
+}
+func (this *DSNFixture) TestS3WithCustomEndpoint() {
+	wireup, err := this.build(DSN("s3://bucket.minio.local:9000/prefix?scheme=http&access_key=a&secret_key=b"))
+
+	this.So(err, should.BeNil)
+	this.So(wireup.s3address.String(), should.Equal, "http://minio.local:9000/bucket/prefix")
+	this.So(wireup.awsAccessKey, should.Equal, "a")
+	this.So(wireup.awsSecretKey, should.Equal, "b")
+}
+func (this *DSNFixture) TestS3WithDottedBucketAddressedPathStyle() {
+	wireup, err := this.build(DSN("s3://my.bucket/prefix"))
+
+	this.So(err, should.BeNil)
+	this.So(wireup.s3address.String(), should.Equal, "https://s3.amazonaws.com/my.bucket/prefix")
+}
+func (this *DSNFixture) TestS3WithDottedBucketAndRegionalHost() {
+	wireup, err := this.build(DSN("s3://my.bucket.s3.us-west-2.amazonaws.com/prefix"))
+
+	this.So(err, should.BeNil)
+	this.So(wireup.s3address.String(), should.Equal, "https://s3.us-west-2.amazonaws.com/my.bucket/prefix")
+}
+func (this *DSNFixture) TestS3WithDottedBucketAndCustomEndpoint() {
+	wireup, err := this.build(DSN("s3://my.bucket/prefix?endpoint=minio.local:9000&scheme=http"))
+
+	this.So(err, should.BeNil)
+	this.So(wireup.s3address.String(), should.Equal, "http://minio.local:9000/my.bucket/prefix")
+}
+func (this *DSNFixture) TestS3WithAmbientCredentials() {
+	this.environment = map[string]string{}
+
+	wireup, err := this.build(DSN("s3://bucket/prefix?credentials=ambient"))
+
+	this.So(err, should.BeNil)
+	this.So(wireup.ambientCredentials, should.BeTrue)
+}
+func (this *DSNFixture) TestEnvironmentVariablesExpanded() {
+	this.environment["BUCKET"] = "expanded"
+
+	wireup, err := this.build(DSN("s3://${BUCKET}.s3.amazonaws.com/prefix"))
+
+	this.So(err, should.BeNil)
+	this.So(wireup.s3address.Host, should.Equal, "expanded.s3.amazonaws.com")
+}
+func (this *DSNFixture) TestAllProblemsReportedTogether() {
+	delete(this.environment, "AWS_SECRET_ACCESS_KEY")
+
+	_, err := this.build(DSN("s3://${MISSING}/prefix"))
+
+	if this.So(err, should.HaveSameTypeAs, ConfigurationError{}) {
+		this.So(err.(ConfigurationError), should.HaveLength, 3)
+	}
+	this.So(err.Error(), should.ContainSubstring, "'MISSING'")
+	this.So(err.Error(), should.ContainSubstring, "no storage address specified for S3")
+	this.So(err.Error(), should.ContainSubstring, "AWS Secret Key")
+}
+func (this *DSNFixture) TestGCSWithMalformedCredentials() {
+	_, err := this.build(DSN("gcs:///prefix?credentials=base64:!!!"))
+
+	if this.So(err, should.HaveSameTypeAs, ConfigurationError{}) {
+		this.So(err.(ConfigurationError), should.HaveLength, 3)
+	}
+	this.So(err.Error(), should.ContainSubstring, "unable to decode base64 secret")
+	this.So(err.Error(), should.ContainSubstring, "no target bucket specified")
+}
+func (this *DSNFixture) TestGCSWithMalformedServiceAccountKeyReportedWithOtherProblems() {
+	_, err := this.build(DSN("gcs:///prefix?credentials=not-json"))
+
+	if this.So(err, should.HaveSameTypeAs, ConfigurationError{}) {
+		this.So(err.(ConfigurationError), should.HaveLength, 2)
+	}
+	this.So(err.Error(), should.ContainSubstring, "malformed service account key")
+	this.So(err.Error(), should.ContainSubstring, "no target bucket specified")
+}
+func (this *DSNFixture) TestGCSChunkSizeNotMultipleOf256KiBReported() {
+	_, err := this.build(DSN("gcs://bucket/prefix?auth=oauth"), LargeDocuments(1024*1024*16, 1000*1000))
+
+	if this.So(err, should.HaveSameTypeAs, ConfigurationError{}) {
+		this.So(err.(ConfigurationError), should.HaveLength, 1)
+	}
+	this.So(err.Error(), should.ContainSubstring, "must be a multiple of 256 KiB: 1000000")
+
+	_, err = this.build(DSN("gcs://bucket/prefix?auth=oauth"), LargeDocuments(1024*1024*16, 1024*1024*4))
+	this.So(err, should.BeNil)
+}
+func (this *DSNFixture) TestChooseReportsMalformedServiceAccountKey() {
+	_, err := this.build(Choose("gcs", &url.URL{}, "", "", nil, "bucket", "prefix", "!!!"))
+
+	this.So(err, should.NotBeNil)
+	this.So(err.Error(), should.ContainSubstring, "unable to decode base64 service account key")
+}
+func (this *DSNFixture) TestLocalFiles() {
+	wireup := New(DSN("file:///tmp/projections"))
+	storage, err := wireup.Build()
+
+	this.So(err, should.BeNil)
+	this.So(storage, should.HaveSameTypeAs, &filepersist.ReadWriter{})
+	this.So(wireup.root, should.Equal, "/tmp/projections")
+}
+func (this *DSNFixture) TestMemory() {
+	storage, err := New(DSN("mem://")).Build()
+
+	this.So(err, should.BeNil)
+	this.So(storage, should.HaveSameTypeAs, &mempersist.ReadWriter{})
+}
+func (this *DSNFixture) TestUnrecognizedScheme() {
+	_, err := this.build(DSN("ftp://host/path"))
+
+	this.So(err, should.NotBeNil)
+	this.So(err.Error(), should.ContainSubstring, "unrecognized DSN scheme: 'ftp'")
+}
@@ -0,0 +1,148 @@
+package anypersist
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+func TestEngineFixture(t *testing.T) {
+	gunit.Run(new(EngineFixture), t)
+}
+
+type EngineFixture struct {
+	*gunit.Fixture
+
+	server  *FakeS3
+	address *url.URL
+}
+
+func (this *EngineFixture) Setup() {
+	this.server = NewFakeS3(`{"Orders":1}`)
+	this.address, _ = url.Parse(this.server.URL + "/bucket")
+}
+func (this *EngineFixture) Teardown() {
+	this.server.Close()
+}
+
+func (this *EngineFixture) TestWatcherPollsUnchangedS3DocumentThroughRetries() {
+	storage, err := New(S3(this.address, "access", "secret"), MaxRetries(3)).Build()
+	this.So(err, should.BeNil)
+	watcher := persist.NewWatcher(storage, time.Millisecond).
+		Watch(func() projector.Document { return &OrdersDocument{} })
+	go watcher.Listen()
+
+	change := <-watcher.Changes()
+	this.So(change.Document.(*OrdersDocument).Orders, should.Equal, 1)
+
+	for this.server.notModified() < 3 {
+		time.Sleep(time.Millisecond) // each poll is answered without retrying
+	}
+	watcher.Close()
+	for range watcher.Changes() {
+	}
+}
+
+func (this *EngineFixture) TestURLsSignedThroughDecorators() {
+	storage, _ := New(S3(this.address, "access", "secret"), MaxRetries(3),
+		SkipUnchangedWrites(), MaxConcurrentRequests(4)).Build()
+	prefixed := persist.NewPrefixedReadWriter(storage, "rebuild")
+
+	signer, ok := prefixed.ReadWriter.(persist.URLSigner)
+	this.So(ok, should.BeTrue)
+	signed, err := signer.SignURL("/orders.json", persist.SignedURLOptions{Expires: time.Minute})
+	this.So(err, should.BeNil)
+	this.So(signed, should.StartWith, this.server.URL+"/bucket/orders.json?")
+
+	signed, err = prefixed.SignURL("/orders.json", persist.SignedURLOptions{Expires: time.Minute})
+	this.So(err, should.BeNil)
+	this.So(signed, should.StartWith, this.server.URL+"/bucket/rebuild/orders.json?")
+}
+
+func (this *EngineFixture) TestGCSTokensSignURLsWithServiceAccountKey() {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	encoded, _ := x509.MarshalPKCS8PrivateKey(key)
+	serviceAccount, _ := json.Marshal(map[string]string{
+		"client_email": "projector@example.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: encoded})),
+	})
+	storage, err := New(GoogleCloudStorage(context.Background(), "bucket", "", serviceAccount),
+		GoogleCloudStorageTokens()).Build()
+	this.So(err, should.BeNil)
+
+	signed, err := storage.(persist.URLSigner).SignURL("/orders.json", persist.SignedURLOptions{Expires: time.Minute})
+
+	this.So(err, should.BeNil)
+	this.So(signed, should.ContainSubstring, "GoogleAccessId=projector%40example.com")
+}
+
+func (this *EngineFixture) TestEnginesUnableToSignReportIt() {
+	storage, _ := New(Memory(), SkipUnchangedWrites()).Build()
+
+	signed, err := storage.(persist.URLSigner).SignURL("/orders.json", persist.SignedURLOptions{Expires: time.Minute})
+
+	this.So(signed, should.BeBlank)
+	this.So(err, should.Equal, persist.ErrSigningUnsupported)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// FakeS3 serves a single object, answering conditional reads as S3 does.
+type FakeS3 struct {
+	*httptest.Server
+	mutex      sync.Mutex
+	body       string
+	unmodified int
+}
+
+func NewFakeS3(body string) *FakeS3 {
+	this := &FakeS3{body: body}
+	this.Server = httptest.NewServer(this)
+	return this
+}
+
+func (this *FakeS3) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	sum := md5.Sum([]byte(this.body))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if request.Header.Get("If-None-Match") == etag {
+		this.unmodified++
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.Header().Set("ETag", etag)
+	_, _ = io.WriteString(response, this.body)
+}
+func (this *FakeS3) notModified() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.unmodified
+}
+
+type OrdersDocument struct {
+	projector.VersionInfo
+	Orders int
+}
+
+func (this *OrdersDocument) Lapse(time.Time) projector.Document { return this }
+func (this *OrdersDocument) Apply(interface{}) bool             { return false }
+func (this *OrdersDocument) Path() string                       { return "/orders.json" }
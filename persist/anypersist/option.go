@@ -3,10 +3,15 @@ package anypersist
 import (
 	"context"
 	"encoding/base64"
+	"fmt"
 	"math"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/projector/persist/s3persist"
 )
 
 type Option func(*Wireup)
@@ -15,6 +20,10 @@ func Defaults() Option {
 	return func(this *Wireup) {
 		TimeoutAfter(time.Second * 10)(this)
 		MaxRetries(math.MaxUint32)(this)
+		KeepAlives(true)(this)
+		MaxIdleConnections(32, 16)(this)
+		MaxConnectionsPerHost(64)(this)
+		IdleConnectionTimeout(time.Second * 120)(this)
 	}
 }
 func TimeoutAfter(httpTimeout time.Duration) Option {
@@ -24,12 +33,57 @@ func MaxRetries(max uint64) Option {
 	return func(this *Wireup) { this.maxRetries = max }
 }
 
+// KeepAlives controls whether connections to the storage engine are pooled and reused.
+func KeepAlives(enabled bool) Option {
+	return func(this *Wireup) { this.keepAlives = enabled }
+}
+func MaxIdleConnections(total, perHost int) Option {
+	return func(this *Wireup) { this.maxIdleConns = total; this.maxIdleConnsPerHost = perHost }
+}
+func MaxConnectionsPerHost(max int) Option {
+	return func(this *Wireup) { this.maxConnsPerHost = max }
+}
+func IdleConnectionTimeout(timeout time.Duration) Option {
+	return func(this *Wireup) { this.idleConnTimeout = timeout }
+}
+
+// HTTP2 attempts to negotiate HTTP/2 with the storage engine (supported by Google Cloud Storage).
+func HTTP2(enabled bool) Option {
+	return func(this *Wireup) { this.http2 = enabled }
+}
+
+// Proxy routes all storage requests through the proxy at the address provided.
+func Proxy(address *url.URL) Option {
+	return func(this *Wireup) { this.proxy = http.ProxyURL(address) }
+}
+
+// ProxyFromEnvironment routes storage requests according to the HTTP_PROXY, HTTPS_PROXY,
+// and NO_PROXY environment variables.
+func ProxyFromEnvironment() Option {
+	return func(this *Wireup) { this.proxy = http.ProxyFromEnvironment }
+}
+
+// RootCertificateAuthorities trusts the PEM-encoded certificates provided in addition to the system roots.
+func RootCertificateAuthorities(certificates []byte) Option {
+	return func(this *Wireup) { this.rootCAs = certificates }
+}
+
+// ClientCertificate presents the PEM-encoded certificate and private key to the storage engine.
+func ClientCertificate(certificate, key []byte) Option {
+	return func(this *Wireup) { this.clientCertificate = certificate; this.clientKey = key }
+}
+
 func Choose(engine string, address *url.URL, accessKey, secretKey string,
 	ctx context.Context, bucketName, pathPrefix, serviceAccountKey string,
 ) Option {
 	if engine == "gcs" {
-		raw, _ := base64.StdEncoding.DecodeString(serviceAccountKey)
-		return GoogleCloudStorage(ctx, bucketName, pathPrefix, raw)
+		raw, err := base64.StdEncoding.DecodeString(serviceAccountKey)
+		return func(this *Wireup) {
+			if err != nil {
+				this.problems = append(this.problems, fmt.Errorf("unable to decode base64 service account key: %s", err))
+			}
+			GoogleCloudStorage(ctx, bucketName, pathPrefix, raw)(this)
+		}
 	} else {
 		return S3(address, accessKey, secretKey)
 	}
@@ -42,6 +96,21 @@ func S3(address *url.URL, accessKey, secretKey string) Option {
 		this.awsSecretKey = strings.TrimSpace(secretKey)
 	}
 }
+
+// S3Credentials signs S3 requests using the credentials supplied by the provider
+// rather than the static access and secret keys.
+func S3Credentials(provider s3persist.CredentialProvider) Option {
+	return func(this *Wireup) { this.awsCredentials, this.ambientCredentials = provider, false }
+}
+
+// AmbientS3Credentials signs S3 requests with credentials discovered from the environment,
+// the shared credentials file, a web identity token, or the container/instance metadata
+// endpoints; temporary credentials are refreshed before they expire. The credential endpoints
+// are reached with the HTTP client configured for storage (timeout, proxy, TLS).
+func AmbientS3Credentials() Option {
+	return func(this *Wireup) { this.awsCredentials, this.ambientCredentials = nil, true }
+}
+
 func GoogleCloudStorage(ctx context.Context, bucketName, pathPrefix string, serviceAccountKey []byte) Option {
 	if ctx == nil {
 		ctx = context.Background()
@@ -55,3 +124,49 @@ func GoogleCloudStorage(ctx context.Context, bucketName, pathPrefix string, serv
 		this.serviceAccountKey = serviceAccountKey
 	}
 }
+
+// GoogleCloudStorageTokens authorizes GCS requests with OAuth2 bearer tokens instead of
+// signed URLs. Tokens are obtained with the JWT grant of the service account key, if one
+// was provided, otherwise from the GCE metadata server (e.g. workload identity). Signing URLs
+// (see persist.URLSigner) still requires the service account key, which the metadata server
+// doesn't provide.
+func GoogleCloudStorageTokens() Option {
+	return func(this *Wireup) { this.gcsTokens = true }
+}
+
+// WriteOptions configures encryption, storage class, caching, access control, and user
+// metadata of every document written; documents may override them individually by
+// implementing persist.WriteOptionsDocument.
+func WriteOptions(options persist.WriteOptions) Option {
+	return func(this *Wireup) { this.writeOptions = options }
+}
+
+// LargeDocuments configures the size (after compression) above which documents are written
+// using S3 multipart or GCS resumable uploads, along with the size of each part or chunk (a
+// multiple of 256 KiB for GCS).
+func LargeDocuments(threshold, partSize int64) Option {
+	return func(this *Wireup) { this.largeThreshold = threshold; this.largePartSize = partSize }
+}
+
+// SkipUnchangedWrites skips writing documents whose serialized content is identical to that
+// most recently read or written at the same path and version. The number of writes skipped
+// is reported by the SkippedWrites method of the persist.SkipUnchanged provided by Build.
+func SkipUnchangedWrites() Option {
+	return func(this *Wireup) { this.skipUnchanged = true }
+}
+
+// MaxConcurrentRequests bounds the number of documents read or written at the same time by
+// every handler given the ReadWriter built, e.g. to stay within MaxConnectionsPerHost.
+func MaxConcurrentRequests(max int) Option {
+	return func(this *Wireup) { this.maxConcurrentRequests = max }
+}
+
+func LocalFiles(root string) Option {
+	return func(this *Wireup) {
+		this.engine = engineFile
+		this.root = strings.TrimSpace(root)
+	}
+}
+func Memory() Option {
+	return func(this *Wireup) { this.engine = engineMemory }
+}
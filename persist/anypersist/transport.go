@@ -0,0 +1,69 @@
+package anypersist
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/smartystreets/projector/persist"
+)
+
+func (this *Wireup) buildHTTPClient() persist.HTTPClient {
+	return &http.Client{
+		Timeout:   this.timeout,
+		Transport: this.buildTransport(),
+	}
+}
+func (this *Wireup) buildTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: this.proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:        this.tlsConfig,
+		TLSHandshakeTimeout:    5 * time.Second,
+		DisableKeepAlives:      !this.keepAlives,
+		MaxIdleConns:           this.maxIdleConns,
+		MaxIdleConnsPerHost:    this.maxIdleConnsPerHost,
+		MaxConnsPerHost:        this.maxConnsPerHost,
+		IdleConnTimeout:        this.idleConnTimeout,
+		ResponseHeaderTimeout:  time.Second * 15,
+		MaxResponseHeaderBytes: 4096,
+		ForceAttemptHTTP2:      this.http2,
+	}
+}
+
+// buildTLSConfig returns nil (the transport's defaults) unless custom roots or a client certificate were provided.
+func (this *Wireup) buildTLSConfig() (*tls.Config, error) {
+	if len(this.rootCAs) == 0 && len(this.clientCertificate) == 0 && len(this.clientKey) == 0 {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if len(this.rootCAs) > 0 {
+		roots, err := x509.SystemCertPool()
+		if err != nil || roots == nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(this.rootCAs) {
+			return nil, errors.New("no valid PEM-encoded root certificate authorities provided")
+		}
+		config.RootCAs = roots
+	}
+
+	if len(this.clientCertificate) > 0 || len(this.clientKey) > 0 {
+		certificate, err := tls.X509KeyPair(this.clientCertificate, this.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("malformed client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,58 @@
+package anypersist
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+)
+
+func TestTransportFixture(t *testing.T) {
+	gunit.Run(new(TransportFixture), t)
+}
+
+type TransportFixture struct {
+	*gunit.Fixture
+}
+
+func (this *TransportFixture) TestConnectionsPooledByDefault() {
+	transport := New(Memory()).buildTransport()
+
+	this.So(transport.DisableKeepAlives, should.BeFalse)
+	this.So(transport.MaxIdleConnsPerHost, should.Equal, 16)
+	this.So(transport.ForceAttemptHTTP2, should.BeFalse)
+	this.So(transport.Proxy, should.BeNil)
+	this.So(transport.TLSClientConfig, should.BeNil)
+}
+
+func (this *TransportFixture) TestTransportOptions() {
+	proxy, _ := url.Parse("http://proxy:3128")
+	wireup := New(Memory(),
+		KeepAlives(false),
+		MaxIdleConnections(4, 2),
+		MaxConnectionsPerHost(8),
+		IdleConnectionTimeout(time.Second),
+		HTTP2(true),
+		Proxy(proxy))
+
+	transport := wireup.buildTransport()
+
+	this.So(transport.DisableKeepAlives, should.BeTrue)
+	this.So(transport.MaxIdleConns, should.Equal, 4)
+	this.So(transport.MaxIdleConnsPerHost, should.Equal, 2)
+	this.So(transport.MaxConnsPerHost, should.Equal, 8)
+	this.So(transport.IdleConnTimeout, should.Equal, time.Second)
+	this.So(transport.ForceAttemptHTTP2, should.BeTrue)
+	this.So(transport.Proxy, should.NotBeNil)
+}
+
+func (this *TransportFixture) TestMalformedCertificatesReportedByBuild() {
+	_, err := New(Memory(),
+		RootCertificateAuthorities([]byte("not a certificate")),
+	).Build()
+
+	this.So(err, should.NotBeNil)
+	this.So(err.Error(), should.ContainSubstring, "root certificate authorities")
+}
@@ -2,35 +2,68 @@ package anypersist
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"net"
+	"fmt"
 	"net/http"
 	"net/url"
+	"os"
 	"time"
 
 	"github.com/smartystreets/gcs"
 	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/projector/persist/filepersist"
 	"github.com/smartystreets/projector/persist/gcspersist"
+	"github.com/smartystreets/projector/persist/mempersist"
 	"github.com/smartystreets/projector/persist/s3persist"
 )
 
 type Wireup struct {
 	engine int
 
-	s3address    *url.URL
-	awsAccessKey string
-	awsSecretKey string
-	timeout      time.Duration
-	maxRetries   uint64
+	s3address          *url.URL
+	awsAccessKey       string
+	awsSecretKey       string
+	awsCredentials     s3persist.CredentialProvider
+	ambientCredentials bool
+	timeout            time.Duration
+	maxRetries         uint64
+
+	keepAlives          bool
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+	http2               bool
+	proxy               func(*http.Request) (*url.URL, error)
+	rootCAs             []byte
+	clientCertificate   []byte
+	clientKey           []byte
+	tlsConfig           *tls.Config
 
 	context           context.Context
 	bucketName        string
 	pathPrefix        string
 	serviceAccountKey []byte
+	gcsCredentials    gcs.Credentials
+	gcsTokens         bool
+
+	root string
+
+	writeOptions   persist.WriteOptions
+	largeThreshold int64
+	largePartSize  int64
+	skipUnchanged  bool
+
+	maxConcurrentRequests int
+
+	dsn      string
+	lookup   func(string) (string, bool)
+	problems []error
 }
 
 func New(options ...Option) *Wireup {
-	this := &Wireup{engine: engineUnknown}
+	this := &Wireup{engine: engineUnknown, lookup: os.LookupEnv}
 	Defaults()(this)
 	for _, option := range options {
 		option(this)
@@ -39,74 +72,165 @@ func New(options ...Option) *Wireup {
 }
 
 func (this *Wireup) Build() (persist.ReadWriter, error) {
+	problems := append([]error{}, this.problems...)
+	if len(this.dsn) > 0 {
+		problems = append(problems, this.applyDSN()...)
+	}
+	problems = append(problems, this.validate()...)
+	if tlsConfig, err := this.buildTLSConfig(); err != nil {
+		problems = append(problems, err)
+	} else {
+		this.tlsConfig = tlsConfig
+	}
+	if credentials, err := this.buildGCSCredentials(); err != nil {
+		problems = append(problems, err)
+	} else {
+		this.gcsCredentials = credentials
+	}
+	if len(problems) > 0 {
+		return nil, ConfigurationError(problems)
+	}
+
+	engine, err := this.buildEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	if this.maxConcurrentRequests > 0 {
+		engine = persist.NewConcurrencyLimit(engine, this.maxConcurrentRequests)
+	}
+	if this.skipUnchanged {
+		engine = persist.NewSkipUnchanged(engine)
+	}
+
+	return engine, nil
+}
+func (this *Wireup) buildEngine() (persist.ReadWriter, error) {
 	switch this.engine {
 	case engineS3:
 		return this.buildS3()
 	case engineGCS:
 		return this.buildGCS()
+	case engineFile:
+		return filepersist.NewReadWriter(this.root), nil
 	default:
-		return nil, errors.New("storage engine to build not specified")
+		return mempersist.NewReadWriter(), nil
 	}
 }
 
-func (this *Wireup) buildS3() (persist.ReadWriter, error) {
-	if this.s3address == nil {
-		return nil, errors.New("no storage address specified for S3")
-	} else if len(this.awsAccessKey) == 0 {
-		return nil, errors.New("credentials for S3 not provided: AWS Access Key")
-	} else if len(this.awsSecretKey) == 0 {
-		return nil, errors.New("credentials for S3 not provided: AWS Secret Key")
+func (this *Wireup) validate() (problems []error) {
+	switch this.engine {
+	case engineS3:
+		if this.s3address == nil || len(this.s3address.Host) == 0 {
+			problems = append(problems, errors.New("no storage address specified for S3"))
+		}
+		if this.awsCredentials != nil || this.ambientCredentials {
+			break
+		}
+		if len(this.awsAccessKey) == 0 {
+			problems = append(problems, errors.New("credentials for S3 not provided: AWS Access Key"))
+		}
+		if len(this.awsSecretKey) == 0 {
+			problems = append(problems, errors.New("credentials for S3 not provided: AWS Secret Key"))
+		}
+	case engineGCS:
+		if len(this.bucketName) == 0 {
+			problems = append(problems, errors.New("no target bucket specified for Google Cloud Storage"))
+		}
+		if len(this.serviceAccountKey) == 0 && !this.gcsTokens {
+			problems = append(problems, errors.New("credentials for Google Cloud Storage not provided: Service Account Key"))
+		}
+		if this.largeThreshold > 0 && this.largePartSize > 0 && this.largePartSize%gcspersist.ChunkSizeMultiple != 0 {
+			problems = append(problems, fmt.Errorf("the chunk size of resumable uploads to Google Cloud Storage must be a multiple of 256 KiB: %d", this.largePartSize))
+		}
+	case engineFile:
+		if len(this.root) == 0 {
+			problems = append(problems, errors.New("no root directory specified for local file storage"))
+		}
+	case engineMemory:
+	default:
+		problems = append(problems, errors.New("storage engine to build not specified"))
 	}
 
+	return problems
+}
+
+func (this *Wireup) buildS3() (persist.ReadWriter, error) {
 	var httpClient persist.HTTPClient
 	httpClient = this.buildHTTPClient()
 	httpClient = this.appendRetryClient(httpClient)
-	engine := s3persist.NewStorage(this.s3address, this.awsAccessKey, this.awsSecretKey, httpClient)
 
-	return engine, nil
-}
-func (this *Wireup) buildGCS() (persist.ReadWriter, error) {
-	if len(this.bucketName) == 0 {
-		return nil, errors.New("no target bucket specified for Google Cloud Storage")
-	} else if len(this.serviceAccountKey) == 0 {
-		return nil, errors.New("credentials for Google Cloud Storage not provided: Service Account Key")
+	var credentials s3persist.CredentialProvider = s3persist.NewStaticCredentials(this.awsAccessKey, this.awsSecretKey)
+	if this.awsCredentials != nil {
+		credentials = this.awsCredentials
+	} else if this.ambientCredentials {
+		credentials = s3persist.NewAmbientCredentials(this.buildHTTPClient())
 	}
 
-	credentials, err := gcs.ParseCredentialsFromJSON(this.serviceAccountKey)
-	if err != nil {
-		return nil, err
+	engine := s3persist.NewStorageWithCredentials(this.s3address, credentials, httpClient)
+	if this.largeThreshold > 0 && this.largePartSize > 0 {
+		engine.Writer.WithMultipart(this.largeThreshold, this.largePartSize)
 	}
 
-	return gcspersist.NewReadWriter(func() gcspersist.StorageSettings {
+	return this.appendIntegrityRetry(engine.WithWriteOptions(this.writeOptions)), nil
+}
+func (this *Wireup) buildGCS() (persist.ReadWriter, error) {
+	var tokens gcspersist.TokenSource
+	if this.gcsTokens {
+		var err error
+		if tokens, err = this.buildTokenSource(); err != nil {
+			return nil, err
+		}
+	}
+
+	httpClient := this.appendRetryClient(this.buildHTTPClient())
+	engine := gcspersist.NewReadWriter(func() gcspersist.StorageSettings {
 		return gcspersist.StorageSettings{
-			HTTPClient:  this.appendRetryClient(this.buildHTTPClient()),
+			HTTPClient:  httpClient,
 			BucketName:  this.bucketName,
 			PathPrefix:  this.pathPrefix,
 			Context:     this.context,
-			Credentials: credentials,
+			Credentials: this.gcsCredentials, // signs URLs alongside tokens
+			TokenSource: tokens,
+
+			WriteOptions: this.writeOptions,
 		}
-	}, utcNow), nil
+	}, utcNow)
+
+	if this.largeThreshold > 0 && this.largePartSize > 0 {
+		engine.WithResumable(this.largeThreshold, this.largePartSize)
+	}
+
+	return this.appendIntegrityRetry(engine), nil
+}
+
+// buildGCSCredentials parses the service account key, if any, so that a malformed key is
+// reported along with the other problems of the configuration.
+func (this *Wireup) buildGCSCredentials() (gcs.Credentials, error) {
+	if this.engine != engineGCS || len(this.serviceAccountKey) == 0 {
+		return gcs.Credentials{}, nil
+	}
+
+	credentials, err := gcs.ParseCredentialsFromJSON(this.serviceAccountKey)
+	if err != nil {
+		return gcs.Credentials{}, fmt.Errorf("malformed service account key for Google Cloud Storage: %s", err)
+	}
+	return credentials, nil
 }
+func (this *Wireup) buildTokenSource() (gcspersist.TokenSource, error) {
+	var inner gcspersist.TokenSource = gcspersist.NewMetadataTokenSource(this.context, this.buildHTTPClient(), "", utcNow)
 
-func (this *Wireup) buildHTTPClient() persist.HTTPClient {
-	return &http.Client{
-		Timeout: this.timeout,
-		Transport: &http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout:   5 * time.Second,
-				KeepAlive: 1 * time.Second,
-			}).DialContext,
-			DisableKeepAlives:      true,
-			MaxIdleConns:           32,
-			MaxIdleConnsPerHost:    16,
-			MaxConnsPerHost:        64,
-			IdleConnTimeout:        time.Second * 120,
-			ResponseHeaderTimeout:  time.Second * 15,
-			MaxResponseHeaderBytes: 4096,
-			ForceAttemptHTTP2:      false,
-		},
+	if len(this.serviceAccountKey) > 0 {
+		source, err := gcspersist.NewServiceAccountTokenSource(this.context, this.buildHTTPClient(), this.serviceAccountKey, utcNow)
+		if err != nil {
+			return nil, err
+		}
+		inner = source
 	}
+
+	return gcspersist.NewRefreshingTokenSource(inner, time.Minute*5, utcNow), nil
 }
+
 func (this *Wireup) appendRetryClient(client persist.HTTPClient) persist.HTTPClient {
 	if this.maxRetries == 0 {
 		return client
@@ -117,10 +241,22 @@ func (this *Wireup) appendRetryClient(client persist.HTTPClient) persist.HTTPCli
 	return client
 }
 
+// appendIntegrityRetry downloads the document again when its content doesn't match the
+// checksums published by the storage engine, e.g. because the body was damaged in transit.
+func (this *Wireup) appendIntegrityRetry(engine persist.ReadWriter) persist.ReadWriter {
+	if this.maxRetries == 0 {
+		return engine
+	}
+
+	return persist.NewIntegrityRetry(engine, int(this.maxRetries), time.Sleep)
+}
+
 const (
 	engineUnknown int = iota
 	engineS3
 	engineGCS
+	engineFile
+	engineMemory
 )
 
 func utcNow() time.Time {
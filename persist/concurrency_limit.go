@@ -0,0 +1,52 @@
+package persist
+
+import "github.com/smartystreets/projector"
+
+// ConcurrencyLimit bounds the number of reads and writes in flight against the inner
+// ReadWriter. Handlers (or documents) sharing one instance share the limit, keeping
+// them from overwhelming the transport of the storage engine they have in common.
+type ConcurrencyLimit struct {
+	ReadWriter
+	slots chan struct{} // nil when unlimited
+}
+
+// NewConcurrencyLimit allows max reads and writes in flight; a max of zero (or less) doesn't
+// limit them at all.
+func NewConcurrencyLimit(inner ReadWriter, max int) *ConcurrencyLimit {
+	this := &ConcurrencyLimit{ReadWriter: inner}
+	if max > 0 {
+		this.slots = make(chan struct{}, max)
+	}
+	return this
+}
+
+func (this *ConcurrencyLimit) ReadPanic(document projector.Document) {
+	this.acquire()
+	defer this.release()
+	this.ReadWriter.ReadPanic(document)
+}
+func (this *ConcurrencyLimit) Read(document projector.Document) error {
+	this.acquire()
+	defer this.release()
+	return this.ReadWriter.Read(document)
+}
+func (this *ConcurrencyLimit) Write(document projector.Document) error {
+	this.acquire()
+	defer this.release()
+	return this.ReadWriter.Write(document)
+}
+
+func (this *ConcurrencyLimit) SignURL(path string, options SignedURLOptions) (string, error) {
+	return signURL(this.ReadWriter, path, options)
+}
+
+func (this *ConcurrencyLimit) acquire() {
+	if this.slots != nil {
+		this.slots <- struct{}{}
+	}
+}
+func (this *ConcurrencyLimit) release() {
+	if this.slots != nil {
+		<-this.slots
+	}
+}
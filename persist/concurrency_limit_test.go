@@ -0,0 +1,81 @@
+package persist
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+)
+
+func TestConcurrencyLimitFixture(t *testing.T) {
+	gunit.Run(new(ConcurrencyLimitFixture), t)
+}
+
+type ConcurrencyLimitFixture struct {
+	*gunit.Fixture
+
+	inner *FakeBlockingStorage
+	limit *ConcurrencyLimit
+}
+
+func (this *ConcurrencyLimitFixture) Setup() {
+	this.inner = &FakeBlockingStorage{entered: make(chan struct{}, 8), proceed: make(chan struct{})}
+	this.limit = NewConcurrencyLimit(this.inner, 2)
+}
+
+func (this *ConcurrencyLimitFixture) TestRequestsBeyondLimitWait() {
+	waiter := sync.WaitGroup{}
+	waiter.Add(3)
+	go func() { _ = this.limit.Write(&FakeDocument{}); waiter.Done() }()
+	go func() { _ = this.limit.Read(&FakeDocument{}); waiter.Done() }()
+	go func() { _ = this.limit.Write(&FakeDocument{}); waiter.Done() }()
+
+	<-this.inner.entered
+	<-this.inner.entered
+	this.So(len(this.inner.entered), should.Equal, 0)
+	this.So(len(this.limit.slots), should.Equal, 2)
+
+	close(this.inner.proceed)
+	waiter.Wait()
+	this.So(len(this.inner.entered), should.Equal, 1) // the third, once a slot was released
+	this.So(len(this.limit.slots), should.Equal, 0)
+}
+
+func (this *ConcurrencyLimitFixture) TestNoLimitUnlessPositive() {
+	for _, max := range []int{0, -1} {
+		this.limit = NewConcurrencyLimit(this.inner, max)
+		this.inner.proceed = make(chan struct{})
+		waiter := sync.WaitGroup{}
+		waiter.Add(3)
+		for i := 0; i < 3; i++ {
+			go func() { _ = this.limit.Write(&FakeDocument{}); waiter.Done() }()
+		}
+
+		<-this.inner.entered
+		<-this.inner.entered
+		<-this.inner.entered // none waits for another to finish
+
+		close(this.inner.proceed)
+		waiter.Wait()
+	}
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeBlockingStorage struct {
+	entered chan struct{}
+	proceed chan struct{}
+}
+
+func (this *FakeBlockingStorage) Read(projector.Document) error {
+	this.entered <- struct{}{}
+	<-this.proceed
+	return nil
+}
+func (this *FakeBlockingStorage) ReadPanic(projector.Document) {}
+func (this *FakeBlockingStorage) Write(document projector.Document) error {
+	return this.Read(document)
+}
+func (this *FakeBlockingStorage) Name() string { return "Fake" }
@@ -0,0 +1,155 @@
+package filepersist
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+// ReadWriter stores gzipped documents as files beneath a root directory. The version
+// of a document is the MD5 checksum of its stored bytes, so optimistic concurrency
+// is honored within the process and, best effort, between processes sharing the directory.
+type ReadWriter struct {
+	root  string
+	mutex sync.Mutex
+}
+
+func NewReadWriter(root string) *ReadWriter {
+	return &ReadWriter{root: root}
+}
+
+func (this *ReadWriter) Name() string { return "Local File System" }
+
+func (this *ReadWriter) ReadPanic(document projector.Document) {
+	if err := this.Read(document); err != nil {
+		log.Panic(err)
+	}
+}
+func (this *ReadWriter) Read(document projector.Document) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	body, err := ioutil.ReadFile(this.filename(document))
+	if os.IsNotExist(err) {
+		log.Printf("[INFO] Document not found at '%s'\n", document.Path())
+		document.SetVersion("")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("file read error: '%s'", err)
+	} else if version, ok := persist.ConditionalVersion(document); ok && version == checksum(body) {
+		return persist.ErrNotModified
+	}
+
+	if err = this.decode(document, body); corrupted(err) {
+		document.Reset()
+		return &persist.IntegrityError{Path: document.Path(), Algorithm: "gzip crc32"}
+	} else if err != nil {
+		return fmt.Errorf("document read error: '%s'", err)
+	}
+
+	document.SetVersion(checksum(body))
+	return nil
+}
+
+func (this *ReadWriter) decode(document projector.Document, body []byte) error {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if err = json.NewDecoder(reader).Decode(document); err != nil {
+		return err
+	}
+
+	// the checksum in the gzip trailer is only verified once the stream has been read to its end
+	_, err = io.Copy(ioutil.Discard, reader)
+	return err
+}
+
+func (this *ReadWriter) Write(document projector.Document) error {
+	body := this.serialize(document)
+	filename := this.filename(document)
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if expected, _ := document.Version().(string); len(expected) > 0 && expected != this.currentVersion(filename) {
+		log.Printf("[INFO] Document on remote storage has changed '%s'\n", document.Path())
+		return persist.ErrConcurrentWrite
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("file write error: '%s'", err)
+	}
+
+	// writing to a temporary file and renaming it means readers never observe a partial document;
+	// the temporary file is unique so that other processes writing the same document don't collide
+	if err := replaceFile(filename, body); err != nil {
+		return fmt.Errorf("file write error: '%s'", err)
+	}
+
+	document.SetVersion(checksum(body))
+	return nil
+}
+func replaceFile(filename string, body []byte) error {
+	temporary, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(temporary.Name()) }() // once renamed, there's nothing to remove
+
+	if _, err = temporary.Write(body); err != nil {
+		_ = temporary.Close()
+		return err
+	} else if err = temporary.Chmod(0644); err != nil {
+		_ = temporary.Close()
+		return err
+	} else if err = temporary.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temporary.Name(), filename)
+}
+func (this *ReadWriter) serialize(document projector.Document) []byte {
+	buffer := bytes.NewBuffer([]byte{})
+	writer, _ := gzip.NewWriterLevel(buffer, gzip.BestCompression)
+
+	if err := json.NewEncoder(writer).Encode(document); err != nil {
+		log.Panic(err)
+	}
+
+	_ = writer.Close()
+	return buffer.Bytes()
+}
+func (this *ReadWriter) currentVersion(filename string) string {
+	if body, err := ioutil.ReadFile(filename); err == nil {
+		return checksum(body)
+	}
+	return ""
+}
+
+func (this *ReadWriter) filename(document projector.Document) string {
+	return filepath.Join(this.root, filepath.FromSlash(filepath.Clean("/"+document.Path())))
+}
+
+// corrupted reports whether the error indicates a damaged or truncated file.
+func corrupted(err error) bool {
+	return err == gzip.ErrChecksum || err == gzip.ErrHeader || err == io.ErrUnexpectedEOF || err == io.EOF
+}
+
+func checksum(body []byte) string {
+	sum := md5.Sum(body)
+	return hex.EncodeToString(sum[:])
+}
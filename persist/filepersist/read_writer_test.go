@@ -0,0 +1,106 @@
+package filepersist
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+func TestReadWriterFixture(t *testing.T) {
+	gunit.Run(new(ReadWriterFixture), t)
+}
+
+type ReadWriterFixture struct {
+	*gunit.Fixture
+
+	root    string
+	storage *ReadWriter
+}
+
+func (this *ReadWriterFixture) Setup() {
+	this.root, _ = ioutil.TempDir("", "filepersist")
+	this.storage = NewReadWriter(this.root)
+}
+func (this *ReadWriterFixture) Teardown() {
+	_ = os.RemoveAll(this.root)
+}
+
+func (this *ReadWriterFixture) TestMissingDocumentHasNoVersion() {
+	document := &Document{}
+
+	err := this.storage.Read(document)
+
+	this.So(err, should.BeNil)
+	this.So(document.version, should.Equal, "")
+}
+
+func (this *ReadWriterFixture) TestWrittenDocumentCanBeRead() {
+	written := &Document{Value: 42}
+	this.So(this.storage.Write(written), should.BeNil)
+
+	read := &Document{}
+	this.So(this.storage.Read(read), should.BeNil)
+
+	this.So(read.Value, should.Equal, 42)
+	this.So(read.version, should.NotBeBlank)
+	this.So(read.version, should.Equal, written.version)
+}
+
+func (this *ReadWriterFixture) TestStaleVersionRejected() {
+	first := &Document{Value: 1}
+	_ = this.storage.Write(first)
+	stale := &Document{Value: 2, version: first.version}
+	_ = this.storage.Write(&Document{Value: 3, version: first.version})
+
+	err := this.storage.Write(stale)
+
+	this.So(err, should.Equal, persist.ErrConcurrentWrite)
+}
+
+func (this *ReadWriterFixture) TestNoTemporaryFilesLeftBehind() {
+	_ = this.storage.Write(&Document{Value: 1})
+	_ = this.storage.Write(&Document{Value: 2})
+
+	files, _ := ioutil.ReadDir(filepath.Dir(this.storage.filename(&Document{})))
+
+	if this.So(files, should.HaveLength, 1) {
+		this.So(files[0].Name(), should.Equal, "document.json")
+		this.So(files[0].Mode().Perm(), should.Equal, os.FileMode(0644))
+	}
+}
+
+func (this *ReadWriterFixture) TestCorruptedFileReportsIntegrityError() {
+	_ = this.storage.Write(&Document{Value: 42})
+	filename := this.storage.filename(&Document{})
+	body, _ := ioutil.ReadFile(filename)
+	body[len(body)-8]++ // the CRC-32 of the gzip trailer
+	_ = ioutil.WriteFile(filename, body, 0644)
+
+	document := &Document{}
+	err := this.storage.Read(document)
+
+	this.So(errors.Is(err, persist.ErrIntegrity), should.BeTrue)
+	this.So(document.Value, should.Equal, 0)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type Document struct {
+	Value   int
+	version interface{}
+}
+
+func (this *Document) Lapse(time.Time) projector.Document { return this }
+func (this *Document) Apply(interface{}) bool             { return false }
+func (this *Document) Path() string                       { return "/nested/path/document.json" }
+func (this *Document) Reset()                             { this.Value = 0 }
+func (this *Document) SetVersion(value interface{})       { this.version = value }
+func (this *Document) Version() interface{}               { return this.version }
@@ -0,0 +1,143 @@
+package gcspersist
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smartystreets/gcs"
+	"github.com/smartystreets/projector/persist"
+)
+
+func appendWriteHeaders(headers http.Header, options persist.WriteOptions) {
+	appendCustomerKeyHeaders(headers, options.CustomerKey)
+	appendHeader(headers, "Cache-Control", options.CacheControl)
+	appendHeader(headers, "x-goog-encryption-kms-key-name", options.KMSKeyID)
+	appendHeader(headers, "x-goog-storage-class", options.StorageClass)
+	appendHeader(headers, "x-goog-acl", options.ACL)
+	for key, value := range options.Metadata {
+		appendHeader(headers, "x-goog-meta-"+strings.ToLower(key), value)
+	}
+}
+func appendCustomerKeyHeaders(headers http.Header, key []byte) {
+	if len(key) == 0 {
+		return
+	}
+
+	checksum := sha256.Sum256(key)
+	headers.Set("x-goog-encryption-algorithm", "AES256")
+	headers.Set("x-goog-encryption-key", base64.StdEncoding.EncodeToString(key))
+	headers.Set("x-goog-encryption-key-sha256", base64.StdEncoding.EncodeToString(checksum[:]))
+}
+func appendHeader(headers http.Header, name, value string) {
+	if len(value) > 0 {
+		headers.Set(name, value)
+	}
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// signer calculates the V2 signature of a signed URL just as the gcs package does, but
+// includes all of the extension (x-goog-*) headers present on the request, which must
+// be part of the signature and for which the gcs package has no options.
+type signer struct {
+	credentials gcs.Credentials
+	expiration  time.Time
+}
+
+func newSigner(credentials gcs.Credentials, expiration time.Time) *signer {
+	return &signer{credentials: credentials, expiration: expiration}
+}
+
+func (this *signer) Sign(request *http.Request) error {
+	if len(this.credentials.BearerToken) > 0 {
+		return nil // bearer tokens don't sign the request
+	}
+
+	epoch := strconv.FormatInt(this.expiration.Unix(), 10)
+	buffer := bytes.NewBuffer(nil)
+	_, _ = fmt.Fprintf(buffer, "%s\n%s\n%s\n%s\n",
+		request.Method, request.Header.Get("Content-MD5"), request.Header.Get("Content-Type"), epoch)
+	buffer.WriteString(canonicalExtensionHeaders(request.Header))
+	buffer.WriteString(request.URL.Path)
+
+	signature, err := this.credentials.PrivateKey.Sign(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+
+	query := request.URL.Query()
+	query.Set("GoogleAccessId", this.credentials.AccessID)
+	query.Set("Expires", epoch)
+	query.Set("Signature", base64.StdEncoding.EncodeToString(signature))
+	request.URL.RawQuery = query.Encode()
+	return nil
+}
+
+func canonicalExtensionHeaders(headers http.Header) string {
+	values := map[string]string{}
+	var names []string
+	for name := range headers {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-goog-") {
+			values[lower] = strings.Join(headers[name], ",")
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+
+	builder := new(strings.Builder)
+	for _, name := range names {
+		builder.WriteString(name + ":" + values[name] + "\n")
+	}
+	return builder.String()
+}
+
+func firstNonBlank(values ...string) string {
+	for _, value := range values {
+		if len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// expectedChecksums gives back the checksums of the stored bytes published with the object:
+// the CRC32C and, except for composite objects, the MD5 of x-goog-hash, along with the SHA-256
+// embedded in the user metadata, if any. Nothing can be verified once the body was decompressed.
+func expectedChecksums(response *http.Response) persist.Checksums {
+	if response.Uncompressed {
+		return persist.Checksums{} // the transport decompressed the body
+	}
+	if stored := response.Header.Get("x-goog-stored-content-encoding"); len(stored) > 0 &&
+		stored != firstNonBlank(response.Header.Get("Content-Encoding"), "identity") {
+		return persist.Checksums{} // the storage engine transcoded the body
+	}
+
+	checksums := parseHashes(response.Header)
+	checksums.SHA256 = persist.DecodeChecksum(response.Header.Get("x-goog-meta-" + persist.ChecksumMetadataKey))
+	return checksums
+}
+
+// parseHashes reads the "x-goog-hash" headers, e.g. "crc32c=n03x6A==, md5=Ojk9c3dhfxgoKVVHYwFbHQ==",
+// which may be sent as separate headers or as a single comma-separated header.
+func parseHashes(headers http.Header) (checksums persist.Checksums) {
+	for _, header := range headers[http.CanonicalHeaderKey("x-goog-hash")] {
+		for _, value := range strings.Split(header, ",") {
+			value = strings.TrimSpace(value)
+			if strings.HasPrefix(value, "md5=") {
+				checksums.MD5 = persist.DecodeChecksum(value[len("md5="):])
+			} else if strings.HasPrefix(value, "crc32c=") {
+				checksums.CRC32C = persist.DecodeChecksum(value[len("crc32c="):])
+			}
+		}
+	}
+	return checksums
+}
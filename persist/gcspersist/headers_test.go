@@ -0,0 +1,190 @@
+package gcspersist
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gcs"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector/persist"
+)
+
+func TestWriteOptionsFixture(t *testing.T) {
+	gunit.Run(new(WriteOptionsFixture), t)
+}
+
+type WriteOptionsFixture struct {
+	*gunit.Fixture
+
+	now         time.Time
+	credentials gcs.Credentials
+	client      *FakeHTTPClient
+	settings    StorageSettings
+	readWriter  *ReadWriter
+}
+
+func (this *WriteOptionsFixture) Setup() {
+	this.now = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	encoded, _ := x509.MarshalPKCS8PrivateKey(key)
+	this.credentials, _ = gcs.NewCredentials("projector@example.com", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: encoded}))
+	this.client = &FakeHTTPClient{}
+	this.settings = StorageSettings{HTTPClient: this.client, BucketName: "bucket", Credentials: this.credentials}
+	this.readWriter = NewReadWriter(func() StorageSettings { return this.settings }, func() time.Time { return this.now })
+}
+
+func (this *WriteOptionsFixture) TestSignerReproducesSignatureOfGCSPackage() {
+	expiration := this.now.Add(time.Hour)
+	request, _ := gcs.NewRequest(gcs.PUT,
+		gcs.WithCredentials(this.credentials),
+		gcs.WithBucket("bucket"),
+		gcs.WithResource("/path/document.json"),
+		gcs.WithSignedExpiration(expiration),
+		gcs.PutWithGeneration("42"),
+		gcs.PutWithContentString("content"),
+		gcs.PutWithContentType("application/json"),
+		gcs.PutWithContentMD5([]byte("checksum")))
+	expected := request.URL.Query().Get("Signature")
+
+	_ = newSigner(this.credentials, expiration).Sign(request)
+
+	this.So(request.URL.Query().Get("Signature"), should.Equal, expected)
+}
+
+func (this *WriteOptionsFixture) TestWriteOptionsSentAndSigned() {
+	this.settings.WriteOptions = persist.WriteOptions{
+		CacheControl: "no-cache",
+		StorageClass: "NEARLINE",
+		ACL:          "projectPrivate",
+		Metadata:     map[string]string{"Projection": "daily"},
+		KMSKeyID:     "projects/p/locations/l/keyRings/r/cryptoKeys/k",
+	}
+
+	_ = this.readWriter.Write(&FakeDocument{})
+
+	headers := this.client.request.Header
+	this.So(headers.Get("Cache-Control"), should.Equal, "no-cache")
+	this.So(headers.Get("x-goog-storage-class"), should.Equal, "NEARLINE")
+	this.So(headers.Get("x-goog-acl"), should.Equal, "projectPrivate")
+	this.So(headers.Get("x-goog-meta-projection"), should.Equal, "daily")
+	this.So(headers.Get("x-goog-encryption-kms-key-name"), should.Equal, "projects/p/locations/l/keyRings/r/cryptoKeys/k")
+
+	request, _ := gcs.NewRequest(gcs.PUT, gcs.WithCredentials(this.credentials), gcs.WithBucket("bucket"),
+		gcs.WithResource("/document.json"), gcs.PutWithContentString("content"))
+	this.So(this.client.request.URL.Query().Get("Signature"), should.NotEqual, request.URL.Query().Get("Signature"))
+}
+
+func (this *WriteOptionsFixture) TestCustomerKeySentWhenReading() {
+	this.settings.WriteOptions = persist.WriteOptions{CustomerKey: []byte("0123456789abcdef0123456789abcdef")}
+
+	_ = this.readWriter.Read(&FakeDocument{})
+
+	headers := this.client.request.Header
+	this.So(headers.Get("x-goog-encryption-algorithm"), should.Equal, "AES256")
+	this.So(headers.Get("x-goog-encryption-key"), should.Equal, "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	this.So(headers.Get("x-goog-encryption-key-sha256"), should.NotBeBlank)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+func TestIntegrityFixture(t *testing.T) {
+	gunit.Run(new(IntegrityFixture), t)
+}
+
+type IntegrityFixture struct {
+	*gunit.Fixture
+
+	client     *FakeHTTPClient
+	settings   StorageSettings
+	readWriter *ReadWriter
+	document   *LargeDocument
+}
+
+func (this *IntegrityFixture) Setup() {
+	this.client = &FakeHTTPClient{}
+	this.settings = StorageSettings{HTTPClient: this.client, BucketName: "bucket", TokenSource: &FakeTokenSource{}}
+	this.readWriter = NewReadWriter(func() StorageSettings { return this.settings }, time.Now)
+	this.document = &LargeDocument{}
+}
+
+func (this *IntegrityFixture) TestMatchingHashesAccepted() {
+	this.respond(`{"Text":"hello"}`, hashHeader(`{"Text":"hello"}`))
+
+	err := this.readWriter.Read(this.document)
+
+	this.So(err, should.BeNil)
+	this.So(this.document.Text, should.Equal, "hello")
+	this.So(this.client.request.Header.Get("Accept-Encoding"), should.Equal, "gzip")
+}
+func (this *IntegrityFixture) TestCorruptedBodyReportsIntegrityError() {
+	this.respond(`{"Text":"hellO"}`, hashHeader(`{"Text":"hello"}`))
+
+	err := this.readWriter.Read(this.document)
+
+	this.So(errors.Is(err, persist.ErrIntegrity), should.BeTrue)
+	this.So(this.document.Text, should.BeBlank)
+}
+func (this *IntegrityFixture) TestCompositeObjectVerifiedByCRC32COnly() {
+	this.respond(`{"Text":"hello"}`, strings.Split(hashHeader(`{"Text":"hello"}`), ",")[0])
+
+	this.So(this.readWriter.Read(this.document), should.BeNil)
+}
+func (this *IntegrityFixture) TestTranscodedBodyNotVerified() {
+	this.respond(`{"Text":"hello"}`, hashHeader("stored, compressed bytes"))
+	this.client.response.Header.Set("x-goog-stored-content-encoding", "gzip")
+
+	this.So(this.readWriter.Read(this.document), should.BeNil)
+}
+func (this *IntegrityFixture) TestMetadataChecksumVerified() {
+	sum := sha256.Sum256([]byte("something else"))
+	this.respond(`{"Text":"hello"}`, "")
+	this.client.response.Header.Set("x-goog-meta-"+persist.ChecksumMetadataKey, base64.StdEncoding.EncodeToString(sum[:]))
+
+	err := this.readWriter.Read(this.document)
+
+	this.So(errors.Is(err, persist.ErrIntegrity), should.BeTrue)
+}
+func (this *IntegrityFixture) TestChecksumEmbeddedInMetadataWhenWriting() {
+	this.settings.WriteOptions = persist.WriteOptions{Checksum: true, Metadata: map[string]string{"owner": "team"}}
+	this.client.response = &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: ioutil.NopCloser(strings.NewReader(""))}
+
+	_ = this.readWriter.Write(&LargeDocument{Text: "hello"})
+
+	this.So(this.client.request.Header.Get("x-goog-meta-"+persist.ChecksumMetadataKey), should.NotBeBlank)
+	this.So(this.client.request.Header.Get("x-goog-meta-owner"), should.Equal, "team")
+	this.So(this.settings.WriteOptions.Metadata, should.HaveLength, 1)
+}
+
+func (this *IntegrityFixture) respond(body, hashes string) {
+	this.client.response = &http.Response{
+		StatusCode:    http.StatusOK,
+		ContentLength: int64(len(body)),
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+	}
+	if len(hashes) > 0 {
+		this.client.response.Header.Set("x-goog-hash", hashes)
+	}
+}
+
+func hashHeader(body string) string {
+	checksum := crc32.Checksum([]byte(body), crc32.MakeTable(crc32.Castagnoli))
+	encoded := make([]byte, 4)
+	binary.BigEndian.PutUint32(encoded, checksum)
+	sum := md5.Sum([]byte(body))
+	return "crc32c=" + base64.StdEncoding.EncodeToString(encoded) + ",md5=" + base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -1,13 +1,12 @@
 package gcspersist
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
-	"crypto/md5"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"path"
@@ -21,10 +20,26 @@ import (
 type ReadWriter struct {
 	settings func() StorageSettings
 	now      func() time.Time
+
+	resumableThreshold int64
+	chunkSize          int64
 }
 
 func NewReadWriter(settings func() StorageSettings, now func() time.Time) *ReadWriter {
-	return &ReadWriter{settings: settings, now: now}
+	return &ReadWriter{
+		settings:           settings,
+		now:                now,
+		resumableThreshold: defaultResumableThreshold,
+		chunkSize:          defaultChunkSize,
+	}
+}
+
+// WithResumable uploads documents larger than the threshold (after compression) using a
+// resumable upload in chunks of the size provided, which must be a multiple of 256 KiB.
+func (this *ReadWriter) WithResumable(threshold, chunkSize int64) *ReadWriter {
+	this.resumableThreshold = threshold
+	this.chunkSize = chunkSize
+	return this
 }
 
 func (this *ReadWriter) Name() string { return "Google Cloud Storage" }
@@ -34,13 +49,25 @@ func (this *ReadWriter) ReadPanic(document projector.Document) {
 		log.Panic(err)
 	}
 }
+
+// Read reads the document in full every time: conditional reads (see persist.ConditionalDocument)
+// aren't supported because the XML API only honors If-None-Match with the ETag of the object (its
+// MD5), not with the generation, which is the version of the document.
 func (this *ReadWriter) Read(document projector.Document) error {
 	settings := this.settings()
 	resource := path.Join("/", settings.PathPrefix, document.Path())
 	expiration := this.now().Add(time.Hour * 24)
+	options := persist.ResolveWriteOptions(settings.WriteOptions, document)
+	credentials, err := this.credentials(settings)
+	if err != nil {
+		return err
+	}
 
-	return this.execute(resource, document, settings.HTTPClient, gcs.GET,
-		gcs.WithCredentials(settings.Credentials),
+	headers := make(http.Header)
+	appendCustomerKeyHeaders(headers, options.CustomerKey)
+
+	return this.execute(resource, document, settings.HTTPClient, newSigner(credentials, expiration), headers, gcs.GET,
+		gcs.WithCredentials(credentials),
 		gcs.WithBucket(settings.BucketName),
 		gcs.WithResource(resource),
 		gcs.WithExpiration(expiration))
@@ -51,32 +78,67 @@ func (this *ReadWriter) Write(document projector.Document) error {
 	expiration := this.now().Add(time.Hour * 24)
 	generation, _ := document.Version().(string)
 	body := this.serialize(document)
-	checksum := md5.Sum(body)
+	defer func() { _ = body.Close() }()
+	options := persist.ResolveWriteOptions(settings.WriteOptions, document).WithChecksum(body.SHA256())
+	credentials, err := this.credentials(settings)
+	if err != nil {
+		return err
+	}
 
-	return this.execute(resource, document, settings.HTTPClient, gcs.PUT,
-		gcs.WithCredentials(settings.Credentials),
+	headers := make(http.Header)
+	appendWriteHeaders(headers, options)
+
+	if body.Size() > this.resumableThreshold {
+		upload := newResumableUpload(settings.HTTPClient, newSigner(credentials, expiration), body, this.chunkSize)
+		return upload.Write(document, headers,
+			gcs.WithCredentials(credentials),
+			gcs.WithBucket(settings.BucketName),
+			gcs.WithResource(resource),
+			gcs.WithExpiration(expiration),
+			gcs.PutWithGeneration(generation),
+			gcs.PutWithContentEncoding("gzip"),
+			gcs.PutWithContentType(firstNonBlank(options.ContentType, "application/json")))
+	}
+
+	return this.execute(resource, document, settings.HTTPClient, newSigner(credentials, expiration), headers, gcs.PUT,
+		gcs.WithCredentials(credentials),
 		gcs.WithBucket(settings.BucketName),
 		gcs.WithResource(resource),
 		gcs.WithExpiration(expiration),
 		gcs.PutWithGeneration(generation),
-		gcs.PutWithContentBytes(body),
+		gcs.PutWithContentBytes(body.Bytes()),
 		gcs.PutWithContentEncoding("gzip"),
-		gcs.PutWithContentType("application/json"),
-		gcs.PutWithContentMD5(checksum[:]))
+		gcs.PutWithContentType(firstNonBlank(options.ContentType, "application/json")),
+		gcs.PutWithContentMD5(body.MD5()))
+}
+
+func (this *ReadWriter) credentials(settings StorageSettings) (gcs.Credentials, error) {
+	if settings.TokenSource == nil {
+		return settings.Credentials, nil
+	}
+
+	token, err := settings.TokenSource.Token()
+	if err != nil {
+		return gcs.Credentials{}, fmt.Errorf("could not obtain access token: %s", err)
+	}
+
+	return gcs.Credentials{BearerToken: token.authorization()}, nil
 }
 
-func (this *ReadWriter) serialize(document projector.Document) []byte {
-	buffer := bytes.NewBuffer([]byte{})
-	writer, _ := gzip.NewWriterLevel(buffer, gzip.BestCompression)
+// serialize streams the document through gzip into a spool which only holds documents
+// at or below the resumable threshold in memory.
+func (this *ReadWriter) serialize(document projector.Document) *persist.Spool {
+	spool := persist.NewSpool(this.resumableThreshold)
+	writer, _ := gzip.NewWriterLevel(spool, gzip.BestCompression)
 
 	if err := json.NewEncoder(writer).Encode(document); err != nil {
+		_ = spool.Close()
 		log.Panic(err)
 		return nil
 	}
 
 	_ = writer.Close() // flush the buffer too
-	return buffer.Bytes()
-
+	return spool
 }
 func (this *ReadWriter) deserialize(document projector.Document, reader io.Reader) error {
 	err := json.NewDecoder(reader).Decode(document)
@@ -88,13 +150,28 @@ func (this *ReadWriter) deserialize(document projector.Document, reader io.Reade
 }
 
 func (this *ReadWriter) execute(
-	resource string, document projector.Document, client persist.HTTPClient, method string, options ...gcs.Option,
+	resource string, document projector.Document, client persist.HTTPClient,
+	signer *signer, headers http.Header, method string, options ...gcs.Option,
 ) error {
 	request, err := gcs.NewRequest(method, options...)
 	if err != nil {
 		return fmt.Errorf("could not create signed request: %s\n", err)
 	}
 
+	if len(headers) > 0 {
+		for name, values := range headers {
+			request.Header[name] = values
+		}
+		if err = signer.Sign(request); err != nil {
+			return fmt.Errorf("could not create signed request: %s\n", err)
+		}
+	}
+	if method == gcs.GET {
+		// asking for gzip explicitly prevents both decompressive transcoding by the storage engine
+		// and transparent decompression by the transport, either of which defeats verification.
+		request.Header.Set("Accept-Encoding", "gzip")
+	}
+
 	response, err := client.Do(request)
 	if err != nil {
 		return fmt.Errorf("http client error: '%s'", err)
@@ -118,7 +195,7 @@ func (this *ReadWriter) handleResponse(
 
 	switch response.StatusCode {
 	case http.StatusOK:
-		return response.Header.Get("x-goog-generation"), this.handleResponseBody(document, response)
+		return response.Header.Get("x-goog-generation"), this.handleResponseBody(method, document, response)
 	case http.StatusNotFound:
 		log.Printf("[INFO] Document not found at '%s'\n", document.Path())
 		return "", nil
@@ -129,24 +206,42 @@ func (this *ReadWriter) handleResponse(
 		return "", fmt.Errorf("non-200 http status code: %s", response.Status)
 	}
 }
-func (this *ReadWriter) handleResponseBody(document projector.Document, response *http.Response) error {
+func (this *ReadWriter) handleResponseBody(method string, document projector.Document, response *http.Response) error {
 	defer func() { _ = response.Body.Close() }()
 
 	// note "response.ContentLength == -1" means unknown length
-	if response.ContentLength == 0 {
+	if response.ContentLength == 0 || method != gcs.GET {
 		return nil // no body
 	}
 
-	payload, err := ioutil.ReadAll(response.Body)
-	if err != nil {
+	verifier := persist.NewVerifier(document.Path(), response.Body, expectedChecksums(response))
+	decodeErr := this.decode(document, verifier)
+	if err := verifier.Verify(); err != nil {
+		document.Reset() // the integrity error explains any decode error
 		return err
+	} else if decodeErr != nil {
+		return decodeErr
 	}
 
-	if err := this.deserialize(document, bytes.NewBuffer(payload)); err == nil {
-		return nil
+	if described, ok := document.(persist.MetadataDocument); ok {
+		described.SetMetadata(response.Header)
+	}
+
+	return nil
+}
+func (this *ReadWriter) decode(document projector.Document, body io.Reader) error {
+	// the body is decoded as it streams in; gzip is detected by its magic number, which covers
+	// objects that are served compressed regardless of the Content-Encoding reported.
+	buffered := bufio.NewReader(body)
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, gzipMagic) {
+		reader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return fmt.Errorf("document read error: '%s'", err.Error())
+		}
+		return this.deserialize(document, reader)
 	}
 
-	log.Printf("[WARN] Deserialization failed for [%s], trying to gunzip first before deserializing.", document.Path())
-	reader, _ := gzip.NewReader(bytes.NewBuffer(payload))
-	return this.deserialize(document, reader)
+	return this.deserialize(document, buffered)
 }
+
+var gzipMagic = []byte{0x1f, 0x8b}
@@ -0,0 +1,161 @@
+package gcspersist
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/smartystreets/gcs"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+// resumableUpload writes a large document using the resumable upload protocol of the XML API:
+// a signed POST establishes the session (and checks the generation precondition) after which
+// the chunks are PUT to the session URI, one at a time, so that only a single chunk is held
+// in memory. Because every chunk is a PUT, each is retried by the PutRetryClient. Each chunk
+// starts where the bytes persisted so far end, as reported by storage, which may have kept
+// only part of the previous chunk.
+type resumableUpload struct {
+	client    persist.HTTPClient
+	signer    *signer
+	body      *persist.Spool
+	chunkSize int64
+}
+
+func newResumableUpload(client persist.HTTPClient, signer *signer, body *persist.Spool, chunkSize int64) *resumableUpload {
+	return &resumableUpload{client: client, signer: signer, body: body, chunkSize: chunkSize}
+}
+
+func (this *resumableUpload) Write(document projector.Document, headers http.Header, options ...gcs.Option) error {
+	session, err := this.initiate(document, headers, options)
+	if err != nil {
+		return err
+	}
+
+	for offset, stalled := int64(0), 0; offset < this.body.Size(); {
+		response, err := this.upload(session, offset)
+		if err != nil {
+			return fmt.Errorf("http client error: '%s'", err)
+		}
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		_ = response.Body.Close()
+
+		switch response.StatusCode {
+		case http.StatusPermanentRedirect: // "308 Resume Incomplete"
+			next, err := persistedThrough(response.Header)
+			if err != nil {
+				return err
+			}
+			if next <= offset {
+				stalled++
+			} else {
+				offset, stalled = next, 0
+			}
+			if stalled >= maxStalledChunks {
+				return fmt.Errorf("resumable upload of '%s' made no progress at offset %d", document.Path(), offset)
+			}
+		case http.StatusOK, http.StatusCreated:
+			if err := this.verify(response); err != nil {
+				return err
+			}
+			document.SetVersion(response.Header.Get("x-goog-generation"))
+			return nil
+		case http.StatusPreconditionFailed:
+			log.Printf("[INFO] Document on remote storage has changed '%s'\n", document.Path())
+			return persist.ErrConcurrentWrite
+		default:
+			return fmt.Errorf("non-200 http status code: %s", response.Status)
+		}
+	}
+
+	return fmt.Errorf("resumable upload of '%s' was not finalized", document.Path())
+}
+
+func (this *resumableUpload) initiate(document projector.Document, headers http.Header, options []gcs.Option) (string, error) {
+	// the gcs package only builds GET and PUT requests, so the POST starts out as a PUT
+	request, err := gcs.NewRequest(gcs.PUT, append(options, gcs.PutWithContentBytes(nil))...)
+	if err != nil {
+		return "", fmt.Errorf("could not create signed request: %s\n", err)
+	}
+
+	request.Method = "POST"
+	request.Header.Del("Content-MD5")
+	request.Header.Set("x-goog-resumable", "start")
+	for name, values := range headers {
+		request.Header[name] = values
+	}
+	if err = this.signer.Sign(request); err != nil {
+		return "", fmt.Errorf("could not create signed request: %s\n", err)
+	}
+
+	response, err := this.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("http client error: '%s'", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	switch response.StatusCode {
+	case http.StatusCreated, http.StatusOK:
+		return response.Header.Get("Location"), nil
+	case http.StatusPreconditionFailed:
+		log.Printf("[INFO] Document on remote storage has changed '%s'\n", document.Path())
+		return "", persist.ErrConcurrentWrite
+	default:
+		return "", fmt.Errorf("resumable upload could not be started: %s", response.Status)
+	}
+}
+
+func (this *resumableUpload) upload(session string, offset int64) (*http.Response, error) {
+	raw, _ := ioutil.ReadAll(this.body.Section(offset, this.chunkSize))
+
+	request, err := http.NewRequest("PUT", session, bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	request.ContentLength = int64(len(raw))
+	request.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(len(raw))-1, this.body.Size()))
+	return this.client.Do(request)
+}
+
+// persistedThrough gives back the offset following the bytes persisted so far, as reported by
+// the Range header (e.g. "bytes=0-262143") of a "308 Resume Incomplete" response, which is
+// absent when no bytes have been persisted.
+func persistedThrough(header http.Header) (int64, error) {
+	value := header.Get("Range")
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	var first, last int64
+	if _, err := fmt.Sscanf(value, "bytes=%d-%d", &first, &last); err != nil || first != 0 || last < 0 {
+		return 0, fmt.Errorf("malformed range of resumable upload: '%s'", value)
+	}
+	return last + 1, nil
+}
+
+// verify compares the MD5 reported by the storage engine with that of the bytes sent, as
+// the individual chunks of a resumable upload do not carry a Content-MD5.
+func (this *resumableUpload) verify(response *http.Response) error {
+	expected := this.body.MD5()
+	if actual := parseHashes(response.Header).MD5; len(actual) > 0 && !bytes.Equal(actual, expected) {
+		return fmt.Errorf("uploaded content does not match: md5 '%s', expected '%s'",
+			base64.StdEncoding.EncodeToString(actual), base64.StdEncoding.EncodeToString(expected))
+	}
+	return nil
+}
+
+const (
+	defaultResumableThreshold = 1024 * 1024 * 16
+	defaultChunkSize          = 1024 * 1024 * 8
+	maxStalledChunks          = 3
+)
+
+// ChunkSizeMultiple is the size of which every chunk of a resumable upload, but the last, must
+// be a multiple.
+const ChunkSizeMultiple = 1024 * 256
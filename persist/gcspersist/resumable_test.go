@@ -0,0 +1,219 @@
+package gcspersist
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+func TestResumableFixture(t *testing.T) {
+	gunit.Run(new(ResumableFixture), t)
+}
+
+type ResumableFixture struct {
+	*gunit.Fixture
+
+	client     *FakeHTTPClientForResumable
+	readWriter *ReadWriter
+	document   *LargeDocument
+}
+
+func (this *ResumableFixture) Setup() {
+	this.client = &FakeHTTPClientForResumable{}
+	settings := StorageSettings{HTTPClient: this.client, BucketName: "bucket", TokenSource: &FakeTokenSource{}}
+	this.readWriter = NewReadWriter(func() StorageSettings { return settings }, time.Now).WithResumable(1024, 256)
+	this.document = newLargeDocument(2048)
+}
+
+func (this *ResumableFixture) TestLargeDocumentUploadedInChunks() {
+	err := this.readWriter.Write(this.document)
+
+	this.So(err, should.BeNil)
+	this.So(this.document.version, should.Equal, "42")
+	this.So(this.client.initiation.Method, should.Equal, "POST")
+	this.So(this.client.initiation.Header.Get("x-goog-resumable"), should.Equal, "start")
+	this.So(this.client.initiation.Header.Get("Authorization"), should.Equal, "Bearer token")
+	this.So(len(this.client.ranges), should.BeGreaterThan, 2)
+	this.So(this.client.ranges[0], should.StartWith, "bytes 0-255/")
+	this.So(this.decode(this.client.received.Bytes()), should.Equal, this.document.Text)
+}
+
+func (this *ResumableFixture) TestUploadResumedWhereBytesPersistedEnd() {
+	this.client.partial = true
+
+	err := this.readWriter.Write(this.document)
+
+	this.So(err, should.BeNil)
+	this.So(this.client.ranges[0], should.StartWith, "bytes 0-255/")
+	this.So(this.client.ranges[1], should.StartWith, "bytes 128-383/")
+	this.So(this.decode(this.client.received.Bytes()), should.Equal, this.document.Text)
+}
+
+func (this *ResumableFixture) TestChecksumMismatchReported() {
+	this.client.corruptHash = true
+
+	err := this.readWriter.Write(this.document)
+
+	this.So(err, should.NotBeNil)
+	this.So(this.document.version, should.Equal, "41")
+}
+
+func (this *ResumableFixture) TestConcurrentWriteDetectedWhenStarting() {
+	this.client.preconditionFailed = true
+
+	err := this.readWriter.Write(this.document)
+
+	this.So(err, should.Equal, persist.ErrConcurrentWrite)
+	this.So(this.client.ranges, should.BeEmpty)
+}
+
+func (this *ResumableFixture) TestSmallDocumentWrittenWithSinglePut() {
+	this.document = newLargeDocument(16)
+	this.client.small = true
+
+	err := this.readWriter.Write(this.document)
+
+	this.So(err, should.BeNil)
+	this.So(this.client.initiation, should.BeNil)
+	this.So(this.client.ranges, should.BeEmpty)
+	this.So(this.decode(this.client.received.Bytes()), should.Equal, this.document.Text)
+}
+
+func (this *ResumableFixture) TestStreamingReadOfCompressedAndPlainDocuments() {
+	compressed := bytes.NewBuffer(nil)
+	writer := gzip.NewWriter(compressed)
+	_, _ = writer.Write([]byte(`{"Text":"compressed"}`))
+	_ = writer.Close()
+
+	for _, body := range [][]byte{compressed.Bytes(), []byte(`{"Text":"plain"}`)} {
+		client := &FakeHTTPClient{response: &http.Response{
+			StatusCode:    http.StatusOK,
+			ContentLength: -1,
+			Header:        make(http.Header),
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		}}
+		settings := StorageSettings{HTTPClient: client, BucketName: "bucket", TokenSource: &FakeTokenSource{}}
+		readWriter := NewReadWriter(func() StorageSettings { return settings }, time.Now)
+		document := &LargeDocument{}
+
+		this.So(readWriter.Read(document), should.BeNil)
+		this.So(document.Text, should.BeIn, "compressed", "plain")
+	}
+}
+
+func (this *ResumableFixture) decode(raw []byte) string {
+	reader, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return err.Error()
+	}
+	document := &LargeDocument{}
+	_ = json.NewDecoder(reader).Decode(document)
+	return document.Text
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeHTTPClientForResumable struct {
+	initiation         *http.Request
+	ranges             []string
+	received           bytes.Buffer
+	small              bool
+	corruptHash        bool
+	preconditionFailed bool
+	partial            bool // only half of the next chunk is persisted
+}
+
+func (this *FakeHTTPClientForResumable) Do(request *http.Request) (*http.Response, error) {
+	response := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: ioutil.NopCloser(strings.NewReader(""))}
+
+	if request.Method == http.MethodPost {
+		this.initiation = request
+		if this.preconditionFailed {
+			response.StatusCode = http.StatusPreconditionFailed
+			return response, nil
+		}
+		response.StatusCode = http.StatusCreated
+		response.Header.Set("Location", "https://storage.googleapis.com/upload/session")
+		return response, nil
+	}
+
+	raw, _ := ioutil.ReadAll(request.Body)
+	if this.small {
+		this.received.Write(raw)
+		response.Header.Set("x-goog-generation", "42")
+		return response, nil
+	}
+
+	contentRange := request.Header.Get("Content-Range")
+	this.ranges = append(this.ranges, contentRange)
+	if start, _, _ := parseContentRange(contentRange); start != this.received.Len() {
+		response.StatusCode = http.StatusBadRequest // not where the bytes persisted end
+		return response, nil
+	}
+	if this.partial {
+		this.partial, raw = false, raw[:len(raw)/2]
+	}
+	this.received.Write(raw)
+	if _, end, total := parseContentRange(contentRange); end != total-1 || this.received.Len() != total {
+		response.StatusCode = http.StatusPermanentRedirect
+		response.Header.Set("Range", "bytes=0-"+strconv.Itoa(this.received.Len()-1))
+		return response, nil
+	}
+
+	sum := md5.Sum(this.received.Bytes())
+	if this.corruptHash {
+		sum[0]++
+	}
+	response.Header.Set("x-goog-generation", "42")
+	response.Header.Set("x-goog-hash", "crc32c=AAAAAA==,md5="+base64.StdEncoding.EncodeToString(sum[:]))
+	return response, nil
+}
+func parseContentRange(contentRange string) (start, end, total int) {
+	// e.g. "bytes 256-511/1400"
+	fields := strings.FieldsFunc(strings.TrimPrefix(contentRange, "bytes "), func(r rune) bool { return r == '-' || r == '/' })
+	if len(fields) != 3 {
+		return -1, -1, -1
+	}
+	start, _ = strconv.Atoi(fields[0])
+	end, _ = strconv.Atoi(fields[1])
+	total, _ = strconv.Atoi(fields[2])
+	return start, end, total
+}
+
+type FakeTokenSource struct{}
+
+func (this *FakeTokenSource) Token() (Token, error) {
+	return Token{Value: "token", Type: "Bearer"}, nil
+}
+
+type LargeDocument struct {
+	Text    string
+	version interface{}
+}
+
+func newLargeDocument(size int) *LargeDocument {
+	random := make([]byte, size)
+	_, _ = rand.New(rand.NewSource(1)).Read(random)
+	return &LargeDocument{Text: base64.StdEncoding.EncodeToString(random), version: "41"}
+}
+
+func (this *LargeDocument) Lapse(time.Time) projector.Document { return this }
+func (this *LargeDocument) Apply(interface{}) bool             { return false }
+func (this *LargeDocument) Path() string                       { return "/large.json" }
+func (this *LargeDocument) Reset()                             { this.Text = "" }
+func (this *LargeDocument) SetVersion(value interface{})       { this.version = value }
+func (this *LargeDocument) Version() interface{}               { return this.version }
@@ -13,4 +13,11 @@ type StorageSettings struct {
 	PathPrefix  string
 	Context     context.Context
 	Credentials gcs.Credentials
+
+	// TokenSource, when present, authorizes each request with an OAuth2 bearer
+	// token rather than a URL signed by the service account in Credentials, which
+	// is then only used, if provided, to sign URLs (see ReadWriter.SignURL).
+	TokenSource TokenSource
+
+	WriteOptions persist.WriteOptions
 }
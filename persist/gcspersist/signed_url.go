@@ -0,0 +1,47 @@
+package gcspersist
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/smartystreets/gcs"
+	"github.com/smartystreets/projector/persist"
+)
+
+// SignURL gives back a URL, signed by the service account of the credentials, through which
+// the document at the path may be read directly from storage until it expires. Only the path
+// is covered by the (V2) signature; the response overrides are appended to the URL as given.
+// With a TokenSource, URLs are signed by the service account in Credentials, if any, because
+// bearer tokens can't sign.
+func (this *ReadWriter) SignURL(documentPath string, options persist.SignedURLOptions) (string, error) {
+	if options.Expires < time.Second {
+		return "", persist.ErrInvalidExpiry
+	}
+
+	settings := this.settings()
+	if len(settings.Credentials.AccessID) == 0 {
+		return "", errServiceAccountRequired
+	}
+
+	request, err := gcs.NewRequest(gcs.GET,
+		gcs.WithCredentials(settings.Credentials),
+		gcs.WithBucket(settings.BucketName),
+		gcs.WithResource(path.Join("/", settings.PathPrefix, documentPath)),
+		gcs.WithSignedExpiration(this.now().Add(options.Expires)))
+	if err != nil {
+		return "", fmt.Errorf("could not create signed URL: %s", err)
+	}
+
+	query := request.URL.Query()
+	for name, values := range options.ResponseOverrides() {
+		query[name] = values
+	}
+	request.URL.RawQuery = query.Encode()
+	return request.URL.String(), nil
+}
+
+var _ persist.URLSigner = new(ReadWriter)
+
+var errServiceAccountRequired = errors.New("signed URLs require the private key of a service account, which bearer tokens (e.g. from the metadata server) don't provide")
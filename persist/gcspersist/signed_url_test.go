@@ -0,0 +1,86 @@
+package gcspersist
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gcs"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector/persist"
+)
+
+func TestSignedURLFixture(t *testing.T) {
+	gunit.Run(new(SignedURLFixture), t)
+}
+
+type SignedURLFixture struct {
+	*gunit.Fixture
+
+	now        time.Time
+	key        *rsa.PrivateKey
+	settings   StorageSettings
+	readWriter *ReadWriter
+}
+
+func (this *SignedURLFixture) Setup() {
+	this.now = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	this.key, _ = rsa.GenerateKey(rand.Reader, 1024)
+	encoded, _ := x509.MarshalPKCS8PrivateKey(this.key)
+	credentials, _ := gcs.NewCredentials("projector@example.com", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: encoded}))
+	this.settings = StorageSettings{BucketName: "bucket", PathPrefix: "prefix", Credentials: credentials}
+	this.readWriter = NewReadWriter(func() StorageSettings { return this.settings }, func() time.Time { return this.now })
+}
+
+func (this *SignedURLFixture) TestURLSignedByServiceAccountWithResponseOverrides() {
+	raw, err := this.readWriter.SignURL("/orders/1.json", persist.SignedURLOptions{
+		Expires:            time.Hour,
+		ContentDisposition: `attachment; filename="1.json"`,
+	})
+
+	this.So(err, should.BeNil)
+	signed, _ := url.Parse(raw)
+	this.So(signed.Host, should.Equal, "storage.googleapis.com")
+	this.So(signed.Path, should.Equal, "/bucket/prefix/orders/1.json")
+	this.So(signed.Query().Get("GoogleAccessId"), should.Equal, "projector@example.com")
+	this.So(signed.Query().Get("Expires"), should.Equal, "1577840400")
+	this.So(signed.Query().Get("response-content-disposition"), should.Equal, `attachment; filename="1.json"`)
+
+	signature, _ := base64.StdEncoding.DecodeString(signed.Query().Get("Signature"))
+	sum := sha256.Sum256([]byte("GET\n\n\n1577840400\n/bucket/prefix/orders/1.json"))
+	this.So(rsa.VerifyPKCS1v15(&this.key.PublicKey, crypto.SHA256, sum[:], signature), should.BeNil)
+}
+
+func (this *SignedURLFixture) TestSignedWithServiceAccountAlongsideTokens() {
+	this.settings.TokenSource = NewRefreshingTokenSource(nil, time.Minute, time.Now)
+
+	raw, err := this.readWriter.SignURL("/orders/1.json", persist.SignedURLOptions{Expires: time.Hour})
+
+	this.So(err, should.BeNil)
+	this.So(raw, should.ContainSubstring, "Signature=")
+}
+
+func (this *SignedURLFixture) TestBearerTokensAloneCannotSign() {
+	this.settings.TokenSource = NewRefreshingTokenSource(nil, time.Minute, time.Now)
+	this.settings.Credentials = gcs.Credentials{}
+
+	raw, err := this.readWriter.SignURL("/orders/1.json", persist.SignedURLOptions{Expires: time.Hour})
+
+	this.So(raw, should.BeBlank)
+	this.So(err, should.Equal, errServiceAccountRequired)
+}
+
+func (this *SignedURLFixture) TestExpiryRequired() {
+	raw, err := this.readWriter.SignURL("/orders/1.json", persist.SignedURLOptions{})
+
+	this.So(raw, should.BeBlank)
+	this.So(err, should.Equal, persist.ErrInvalidExpiry)
+}
@@ -0,0 +1,227 @@
+package gcspersist
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smartystreets/gcs"
+	"github.com/smartystreets/projector/persist"
+)
+
+type Token struct {
+	Value      string
+	Type       string
+	Expiration time.Time
+}
+
+func (this Token) authorization() string { return this.Type + " " + this.Value }
+
+// TokenSource supplies OAuth2 access tokens which are sent in the Authorization header
+// instead of signing each request with the private key of a service account.
+type TokenSource interface {
+	Token() (Token, error)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// ServiceAccountTokenSource obtains access tokens using the JWT bearer grant of a service account key.
+// Token requests are made within the context provided (e.g. StorageSettings.Context), if any.
+type ServiceAccountTokenSource struct {
+	ctx         context.Context
+	client      persist.HTTPClient
+	now         func() time.Time
+	credentials gcs.Credentials
+	tokenURI    string
+	scope       string
+}
+
+func NewServiceAccountTokenSource(
+	ctx context.Context, client persist.HTTPClient, serviceAccountKey []byte, now func() time.Time,
+) (*ServiceAccountTokenSource, error) {
+	var parsed struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(serviceAccountKey, &parsed); err != nil {
+		return nil, fmt.Errorf("malformed service account key: %s", err)
+	}
+
+	credentials, err := gcs.NewCredentials(parsed.ClientEmail, []byte(parsed.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parsed.TokenURI) == 0 {
+		parsed.TokenURI = defaultTokenURI
+	}
+
+	return &ServiceAccountTokenSource{
+		ctx:         orBackground(ctx),
+		client:      client,
+		now:         now,
+		credentials: credentials,
+		tokenURI:    parsed.TokenURI,
+		scope:       defaultScope,
+	}, nil
+}
+
+func (this *ServiceAccountTokenSource) Token() (Token, error) {
+	assertion, err := this.assertion()
+	if err != nil {
+		return Token{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	request, _ := http.NewRequestWithContext(this.ctx, "POST", this.tokenURI, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return requestToken(this.client, request, this.now)
+}
+func (this *ServiceAccountTokenSource) assertion() (string, error) {
+	issued := this.now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   this.credentials.AccessID,
+		"scope": this.scope,
+		"aud":   this.tokenURI,
+		"iat":   issued.Unix(),
+		"exp":   issued.Add(time.Hour).Unix(),
+	})
+
+	unsigned := encodeSegment(header) + "." + encodeSegment(claims)
+	signature, err := this.credentials.PrivateKey.Sign([]byte(unsigned))
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + encodeSegment(signature), nil
+}
+
+func encodeSegment(raw []byte) string {
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// MetadataTokenSource obtains access tokens of the default service account (e.g. via
+// workload identity) from the GCE metadata server, so no private key is required.
+type MetadataTokenSource struct {
+	ctx      context.Context
+	client   persist.HTTPClient
+	endpoint string
+	now      func() time.Time
+}
+
+func NewMetadataTokenSource(ctx context.Context, client persist.HTTPClient, endpoint string, now func() time.Time) *MetadataTokenSource {
+	if len(endpoint) == 0 {
+		endpoint = defaultMetadataEndpoint
+	}
+	return &MetadataTokenSource{ctx: orBackground(ctx), client: client, endpoint: strings.TrimSuffix(endpoint, "/"), now: now}
+}
+
+func (this *MetadataTokenSource) Token() (Token, error) {
+	request, _ := http.NewRequestWithContext(this.ctx, "GET", this.endpoint+metadataTokenPath, nil)
+	request.Header.Set("Metadata-Flavor", "Google")
+	return requestToken(this.client, request, this.now)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// RefreshingTokenSource caches the token of the inner source until it is within the refresh window of its expiration.
+type RefreshingTokenSource struct {
+	inner  TokenSource
+	window time.Duration
+	now    func() time.Time
+
+	mutex   sync.Mutex
+	current Token
+}
+
+func NewRefreshingTokenSource(inner TokenSource, window time.Duration, now func() time.Time) *RefreshingTokenSource {
+	return &RefreshingTokenSource{inner: inner, window: window, now: now}
+}
+
+func (this *RefreshingTokenSource) Token() (Token, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if len(this.current.Value) > 0 && this.now().Before(this.current.Expiration.Add(-this.window)) {
+		return this.current, nil
+	}
+
+	token, err := this.inner.Token()
+	if err != nil {
+		return Token{}, err
+	}
+
+	this.current = token
+	return token, nil
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+func requestToken(client persist.HTTPClient, request *http.Request, now func() time.Time) (Token, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return Token{}, fmt.Errorf("token request error: '%s'", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	body, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("token request failed: %s %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	var parsed struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		TokenType   string `json:"token_type"`
+	}
+	if err = json.Unmarshal(body, &parsed); err != nil {
+		return Token{}, fmt.Errorf("malformed token response: %s", err)
+	} else if len(parsed.AccessToken) == 0 {
+		return Token{}, errors.New("token response did not include an access token")
+	}
+
+	if len(parsed.TokenType) == 0 {
+		parsed.TokenType = "Bearer"
+	}
+
+	lifetime := time.Second * time.Duration(parsed.ExpiresIn)
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime // otherwise the token would be requested again for every request
+	}
+
+	return Token{
+		Value:      parsed.AccessToken,
+		Type:       parsed.TokenType,
+		Expiration: now().Add(lifetime),
+	}, nil
+}
+
+func orBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+const (
+	defaultTokenURI         = "https://oauth2.googleapis.com/token"
+	defaultScope            = "https://www.googleapis.com/auth/devstorage.read_write"
+	defaultMetadataEndpoint = "http://metadata.google.internal"
+	metadataTokenPath       = "/computeMetadata/v1/instance/service-accounts/default/token"
+	defaultTokenLifetime    = time.Minute * 15
+)
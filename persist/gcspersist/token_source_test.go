@@ -0,0 +1,184 @@
+package gcspersist
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+)
+
+func TestTokenSourceFixture(t *testing.T) {
+	gunit.Run(new(TokenSourceFixture), t)
+}
+
+type TokenSourceFixture struct {
+	*gunit.Fixture
+
+	now      time.Time
+	server   *httptest.Server
+	request  *http.Request
+	response string
+}
+
+func (this *TokenSourceFixture) Setup() {
+	this.now = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	this.response = `{"access_token":"access-token","expires_in":3600,"token_type":"Bearer"}`
+	this.server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		_ = request.ParseForm()
+		this.request = request
+		_, _ = fmt.Fprint(response, this.response)
+	}))
+}
+func (this *TokenSourceFixture) Teardown() {
+	this.server.Close()
+}
+func (this *TokenSourceFixture) clock() time.Time { return this.now }
+
+func (this *TokenSourceFixture) TestMetadataServerToken() {
+	source := NewMetadataTokenSource(context.Background(), this.server.Client(), this.server.URL, this.clock)
+
+	token, err := source.Token()
+
+	this.So(err, should.BeNil)
+	this.So(token, should.Resemble, Token{Value: "access-token", Type: "Bearer", Expiration: this.now.Add(time.Hour)})
+	this.So(this.request.URL.Path, should.Equal, metadataTokenPath)
+	this.So(this.request.Header.Get("Metadata-Flavor"), should.Equal, "Google")
+}
+
+func (this *TokenSourceFixture) TestServiceAccountJWTGrant() {
+	source, err := NewServiceAccountTokenSource(context.Background(), this.server.Client(), this.serviceAccountKey(), this.clock)
+	this.So(err, should.BeNil)
+
+	token, err := source.Token()
+
+	this.So(err, should.BeNil)
+	this.So(token.authorization(), should.Equal, "Bearer access-token")
+	this.So(this.request.Form.Get("grant_type"), should.Equal, "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	segments := strings.Split(this.request.Form.Get("assertion"), ".")
+	if this.So(segments, should.HaveLength, 3) {
+		claims := this.decodeClaims(segments[1])
+		this.So(claims["iss"], should.Equal, "projector@example.iam.gserviceaccount.com")
+		this.So(claims["aud"], should.Equal, this.server.URL)
+		this.So(claims["exp"], should.Equal, this.now.Add(time.Hour).Unix())
+	}
+}
+func (this *TokenSourceFixture) TestMalformedServiceAccountKey() {
+	_, err := NewServiceAccountTokenSource(context.Background(), this.server.Client(), []byte(`{"private_key":"nope"}`), this.clock)
+
+	this.So(err, should.NotBeNil)
+}
+
+func (this *TokenSourceFixture) TestTokenWithoutLifetimeGivenDefaultLifetime() {
+	this.response = `{"access_token":"access-token"}`
+	source := NewMetadataTokenSource(context.Background(), this.server.Client(), this.server.URL, this.clock)
+
+	token, err := source.Token()
+
+	this.So(err, should.BeNil)
+	this.So(token.Expiration, should.Equal, this.now.Add(defaultTokenLifetime))
+}
+func (this *TokenSourceFixture) TestTokenRequestedWithinContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	source, _ := NewServiceAccountTokenSource(ctx, this.server.Client(), this.serviceAccountKey(), this.clock)
+
+	_, err := source.Token()
+
+	this.So(err, should.NotBeNil)
+	this.So(this.request, should.BeNil)
+}
+
+func (this *TokenSourceFixture) TestRefreshingTokenSource() {
+	source := NewRefreshingTokenSource(NewMetadataTokenSource(context.Background(), this.server.Client(), this.server.URL, this.clock), time.Minute*5, this.clock)
+
+	_, _ = source.Token()
+	this.request = nil
+	this.now = this.now.Add(time.Minute * 54)
+	_, _ = source.Token()
+	this.So(this.request, should.BeNil)
+
+	this.now = this.now.Add(time.Minute)
+	_, _ = source.Token()
+	this.So(this.request, should.NotBeNil)
+}
+
+func (this *TokenSourceFixture) TestReadWriterSendsBearerToken() {
+	client := &FakeHTTPClient{}
+	source := NewMetadataTokenSource(context.Background(), this.server.Client(), this.server.URL, this.clock)
+	readWriter := NewReadWriter(func() StorageSettings {
+		return StorageSettings{HTTPClient: client, BucketName: "bucket", TokenSource: source}
+	}, this.clock)
+
+	_ = readWriter.Read(&FakeDocument{})
+
+	this.So(client.request.Header.Get("Authorization"), should.Equal, "Bearer access-token")
+	this.So(client.request.URL.Query().Get("Signature"), should.BeBlank)
+}
+
+func (this *TokenSourceFixture) serviceAccountKey() []byte {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	encoded, _ := x509.MarshalPKCS8PrivateKey(key)
+	raw, _ := json.Marshal(map[string]string{
+		"client_email": "projector@example.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: encoded})),
+		"token_uri":    this.server.URL,
+	})
+	return raw
+}
+func (this *TokenSourceFixture) decodeClaims(segment string) (claims map[string]interface{}) {
+	raw, _ := decodeSegment(segment)
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	_ = decoder.Decode(&claims)
+	for key, value := range claims {
+		if number, ok := value.(json.Number); ok {
+			claims[key], _ = number.Int64()
+		}
+	}
+	return claims
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeHTTPClient struct {
+	request  *http.Request
+	response *http.Response
+}
+
+func (this *FakeHTTPClient) Do(request *http.Request) (*http.Response, error) {
+	this.request = request
+	if this.response != nil {
+		return this.response, nil
+	}
+	return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+}
+
+type FakeDocument struct {
+	Value   int
+	version interface{}
+}
+
+func (this *FakeDocument) Lapse(time.Time) projector.Document { return this }
+func (this *FakeDocument) Apply(interface{}) bool             { return false }
+func (this *FakeDocument) Path() string                       { return "/document.json" }
+func (this *FakeDocument) Reset()                             { this.Value = 0 }
+func (this *FakeDocument) SetVersion(value interface{})       { this.version = value }
+func (this *FakeDocument) Version() interface{}               { return this.version }
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(segment)
+}
@@ -0,0 +1,160 @@
+package persist
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/smartystreets/projector"
+)
+
+// ErrIntegrity is matched (via errors.Is) by every *IntegrityError.
+var ErrIntegrity = errors.New("the document content does not match its checksum")
+
+// ChecksumMetadataKey names the user metadata entry holding the base64 SHA-256 of the
+// stored bytes when WriteOptions.Checksum is set.
+const ChecksumMetadataKey = "projector-sha256"
+
+// IntegrityError reports a document whose content, as downloaded, differs from the
+// checksum published by the storage engine. The download is usually worth retrying.
+type IntegrityError struct {
+	Path      string
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (this *IntegrityError) Error() string {
+	if len(this.Expected) == 0 {
+		return fmt.Sprintf("%s: '%s' (%s)", ErrIntegrity, this.Path, this.Algorithm)
+	}
+	return fmt.Sprintf("%s: '%s' %s '%s', expected '%s'", ErrIntegrity, this.Path, this.Algorithm, this.Actual, this.Expected)
+}
+func (this *IntegrityError) Is(target error) bool { return target == ErrIntegrity }
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// Checksums are the digests, as published by the storage engine, of the stored bytes.
+// Those left nil are not verified.
+type Checksums struct {
+	MD5    []byte
+	CRC32C []byte
+	SHA256 []byte
+}
+
+// DecodeChecksum decodes a base64 checksum, giving back nil when the value is malformed.
+func DecodeChecksum(value string) []byte {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(decoded) == 0 {
+		return nil
+	}
+	return decoded
+}
+
+// Verifier calculates the checksums of the bytes read through it. Verify consumes the
+// remainder of the content, which the decoder may have left unread, before comparing.
+type Verifier struct {
+	path     string
+	reader   io.Reader
+	expected []expectedChecksum
+}
+
+type expectedChecksum struct {
+	algorithm string
+	value     []byte
+	hash      hash.Hash
+}
+
+func NewVerifier(path string, reader io.Reader, checksums Checksums) *Verifier {
+	this := &Verifier{path: path}
+	this.expect("md5", checksums.MD5, md5.New)
+	this.expect("crc32c", checksums.CRC32C, newCRC32C)
+	this.expect("sha256", checksums.SHA256, sha256.New)
+
+	writers := make([]io.Writer, 0, len(this.expected))
+	for _, item := range this.expected {
+		writers = append(writers, item.hash)
+	}
+	this.reader = io.TeeReader(reader, io.MultiWriter(writers...))
+	return this
+}
+func (this *Verifier) expect(algorithm string, value []byte, factory func() hash.Hash) {
+	if len(value) > 0 {
+		this.expected = append(this.expected, expectedChecksum{algorithm: algorithm, value: value, hash: factory()})
+	}
+}
+
+func (this *Verifier) Read(buffer []byte) (int, error) { return this.reader.Read(buffer) }
+
+func (this *Verifier) Verify() error {
+	if len(this.expected) == 0 {
+		return nil
+	}
+
+	if _, err := io.Copy(ioutil.Discard, this.reader); err != nil {
+		return fmt.Errorf("document read error: '%s'", err)
+	}
+
+	for _, item := range this.expected {
+		if actual := item.hash.Sum(nil); !bytes.Equal(actual, item.value) {
+			return &IntegrityError{
+				Path:      this.path,
+				Algorithm: item.algorithm,
+				Expected:  base64.StdEncoding.EncodeToString(item.value),
+				Actual:    base64.StdEncoding.EncodeToString(actual),
+			}
+		}
+	}
+
+	return nil
+}
+
+func newCRC32C() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) }
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// IntegrityRetry reads the document again, up to the number of retries provided, whenever
+// the inner ReadWriter reports an integrity error; other errors are returned immediately.
+type IntegrityRetry struct {
+	ReadWriter
+	retries int
+	sleeper func(time.Duration)
+}
+
+func NewIntegrityRetry(inner ReadWriter, retries int, sleeper func(time.Duration)) *IntegrityRetry {
+	return &IntegrityRetry{ReadWriter: inner, retries: retries, sleeper: sleeper}
+}
+
+func (this *IntegrityRetry) SignURL(path string, options SignedURLOptions) (string, error) {
+	return signURL(this.ReadWriter, path, options)
+}
+
+func (this *IntegrityRetry) ReadPanic(document projector.Document) {
+	if err := this.Read(document); err != nil {
+		log.Panic(err)
+	}
+}
+func (this *IntegrityRetry) Read(document projector.Document) (err error) {
+	for current := 0; current <= this.retries; current++ {
+		if err = this.ReadWriter.Read(document); !errors.Is(err, ErrIntegrity) {
+			return err
+		}
+
+		log.Printf("[WARN] %s\n", err)
+		document.Reset()
+		if current < this.retries {
+			this.sleeper(time.Second)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,105 @@
+package persist
+
+import (
+	"crypto/md5"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+)
+
+func TestIntegrityFixture(t *testing.T) {
+	gunit.Run(new(IntegrityFixture), t)
+}
+
+type IntegrityFixture struct {
+	*gunit.Fixture
+
+	inner    *FakeReadWriter
+	retry    *IntegrityRetry
+	document *FakeDocument
+	slept    []time.Duration
+}
+
+func (this *IntegrityFixture) Setup() {
+	this.inner = &FakeReadWriter{}
+	this.retry = NewIntegrityRetry(this.inner, 2, func(duration time.Duration) { this.slept = append(this.slept, duration) })
+	this.document = &FakeDocument{}
+}
+
+func (this *IntegrityFixture) TestVerifierReadsRemainderBeforeComparing() {
+	sum := md5.Sum([]byte("content"))
+	verifier := NewVerifier("/path", strings.NewReader("content"), Checksums{MD5: sum[:]})
+
+	_, _ = verifier.Read(make([]byte, 3))
+
+	this.So(verifier.Verify(), should.BeNil)
+}
+func (this *IntegrityFixture) TestVerifierReportsMismatch() {
+	sum := md5.Sum([]byte("content"))
+	verifier := NewVerifier("/path", strings.NewReader("contents"), Checksums{MD5: sum[:]})
+
+	err := verifier.Verify()
+
+	this.So(err, should.HaveSameTypeAs, &IntegrityError{})
+	this.So(err.(*IntegrityError).Algorithm, should.Equal, "md5")
+}
+
+func (this *IntegrityFixture) TestIntegrityErrorsRetried() {
+	this.inner.failures = 2
+
+	err := this.retry.Read(this.document)
+
+	this.So(err, should.BeNil)
+	this.So(this.inner.reads, should.Equal, 3)
+	this.So(this.document.resets, should.Equal, 2)
+	this.So(this.slept, should.HaveLength, 2)
+}
+func (this *IntegrityFixture) TestIntegrityErrorReturnedWhenRetriesExhausted() {
+	this.inner.failures = 5
+
+	err := this.retry.Read(this.document)
+
+	this.So(err, should.HaveSameTypeAs, &IntegrityError{})
+	this.So(this.inner.reads, should.Equal, 3)
+	this.So(this.slept, should.HaveLength, 2)
+}
+func (this *IntegrityFixture) TestOtherErrorsNotRetried() {
+	this.inner.err = ErrConcurrentWrite
+
+	err := this.retry.Read(this.document)
+
+	this.So(err, should.Equal, ErrConcurrentWrite)
+	this.So(this.inner.reads, should.Equal, 1)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeReadWriter struct {
+	reads    int
+	failures int
+	err      error
+}
+
+func (this *FakeReadWriter) Read(projector.Document) error {
+	this.reads++
+	if this.reads <= this.failures {
+		return &IntegrityError{Path: "/path", Algorithm: "md5", Expected: "a", Actual: "b"}
+	}
+	return this.err
+}
+func (this *FakeReadWriter) ReadPanic(projector.Document)   {}
+func (this *FakeReadWriter) Write(projector.Document) error { return nil }
+func (this *FakeReadWriter) Name() string                   { return "Fake" }
+
+type FakeDocument struct{ resets int }
+
+func (this *FakeDocument) Lapse(time.Time) projector.Document { return this }
+func (this *FakeDocument) Apply(interface{}) bool             { return false }
+func (this *FakeDocument) Path() string                       { return "/path" }
+func (this *FakeDocument) Reset()                             { this.resets++ }
+func (this *FakeDocument) SetVersion(interface{})             {}
+func (this *FakeDocument) Version() interface{}               { return nil }
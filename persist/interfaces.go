@@ -24,8 +24,53 @@ type ReadWriter interface {
 	Name() string
 }
 
+// MetadataDocument is implemented by documents that want to observe the storage
+// metadata (response headers) which accompanied the most recent successful read.
+type MetadataDocument interface {
+	SetMetadata(http.Header)
+}
+
+// EncodedDocument is implemented by documents which want to keep the body as stored when it was
+// stored with a content encoding (e.g. gzip), alongside the document decoded from it. Readers
+// which support it provide the encoding and the encoded body once the read has been verified.
+type EncodedDocument interface {
+	SetEncoded(encoding string, body []byte)
+}
+
+// ConditionalDocument is implemented by documents which need only be read again once changed.
+// When ReadIfModified reports true and the document has a version, readers which support it
+// leave the document as is and return ErrNotModified while the version stored is the same;
+// other readers (e.g. gcspersist) read the document as usual.
+type ConditionalDocument interface {
+	ReadIfModified() bool
+}
+
+// ConditionalVersion gives back the version of a ConditionalDocument to be read only if modified.
+func ConditionalVersion(document projector.Document) (string, bool) {
+	conditional, ok := document.(ConditionalDocument)
+	if !ok || !conditional.ReadIfModified() {
+		return "", false
+	}
+	version, _ := document.Version().(string)
+	return version, len(version) > 0
+}
+
+// URLSigner is implemented by storage engines which can give back a time-limited URL through
+// which the document at the path is read (with GET) directly from storage, e.g. by a browser
+// or a partner, without the bytes passing through the application. The decorators of this
+// package implement it as well, giving back ErrSigningUnsupported when the engine can't sign.
+type URLSigner interface {
+	SignURL(path string, options SignedURLOptions) (string, error)
+}
+
 type HTTPClient interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
-var ErrConcurrentWrite = errors.New("the document has been updated by another process")
+var (
+	ErrConcurrentWrite = errors.New("the document has been updated by another process")
+	ErrNotModified     = errors.New("the document has not been modified")
+	ErrInvalidExpiry   = errors.New("the expiry of the signed URL is not within the limits of the storage engine")
+
+	ErrSigningUnsupported = errors.New("the storage engine cannot sign URLs")
+)
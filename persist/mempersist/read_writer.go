@@ -0,0 +1,83 @@
+package mempersist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+// ReadWriter keeps serialized documents in memory. It is intended for tests and
+// for local experimentation; every write increments the generation of the path.
+type ReadWriter struct {
+	mutex     sync.Mutex
+	documents map[string][]byte
+	versions  map[string]int64
+}
+
+func NewReadWriter() *ReadWriter {
+	return &ReadWriter{documents: map[string][]byte{}, versions: map[string]int64{}}
+}
+
+func (this *ReadWriter) Name() string { return "Memory" }
+
+func (this *ReadWriter) ReadPanic(document projector.Document) {
+	if err := this.Read(document); err != nil {
+		log.Panic(err)
+	}
+}
+func (this *ReadWriter) Read(document projector.Document) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	body, found := this.documents[document.Path()]
+	if !found {
+		log.Printf("[INFO] Document not found at '%s'\n", document.Path())
+		document.SetVersion("")
+		return nil
+	}
+
+	if version, ok := persist.ConditionalVersion(document); ok && version == formatVersion(this.versions[document.Path()]) {
+		return persist.ErrNotModified
+	}
+
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(document); err != nil {
+		return fmt.Errorf("document read error: '%s'", err.Error())
+	}
+
+	document.SetVersion(formatVersion(this.versions[document.Path()]))
+	return nil
+}
+
+func (this *ReadWriter) Write(document projector.Document) error {
+	body, err := json.Marshal(document)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	current := formatVersion(this.versions[document.Path()])
+	if expected, _ := document.Version().(string); len(expected) > 0 && expected != current {
+		log.Printf("[INFO] Document on remote storage has changed '%s'\n", document.Path())
+		return persist.ErrConcurrentWrite
+	}
+
+	this.documents[document.Path()] = body
+	this.versions[document.Path()]++
+	document.SetVersion(formatVersion(this.versions[document.Path()]))
+	return nil
+}
+
+func formatVersion(generation int64) string {
+	if generation == 0 {
+		return ""
+	}
+	return strconv.FormatInt(generation, 10)
+}
@@ -0,0 +1,97 @@
+package mempersist
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+func TestReadWriterFixture(t *testing.T) {
+	gunit.Run(new(ReadWriterFixture), t)
+}
+
+type ReadWriterFixture struct {
+	*gunit.Fixture
+
+	storage *ReadWriter
+}
+
+func (this *ReadWriterFixture) Setup() {
+	this.storage = NewReadWriter()
+}
+
+func (this *ReadWriterFixture) TestMissingDocumentHasNoVersion() {
+	document := &Document{}
+
+	err := this.storage.Read(document)
+
+	this.So(err, should.BeNil)
+	this.So(document.version, should.Equal, "")
+}
+
+func (this *ReadWriterFixture) TestEachWriteIncrementsGeneration() {
+	document := &Document{Value: 1}
+	this.So(this.storage.Write(document), should.BeNil)
+	this.So(document.version, should.Equal, "1")
+	document.Value = 2
+	this.So(this.storage.Write(document), should.BeNil)
+
+	read := &Document{}
+	this.So(this.storage.Read(read), should.BeNil)
+
+	this.So(read.Value, should.Equal, 2)
+	this.So(read.version, should.Equal, "2")
+}
+
+func (this *ReadWriterFixture) TestStaleVersionRejected() {
+	_ = this.storage.Write(&Document{Value: 1})
+	_ = this.storage.Write(&Document{Value: 2, version: "1"})
+
+	err := this.storage.Write(&Document{Value: 3, version: "1"})
+
+	this.So(err, should.Equal, persist.ErrConcurrentWrite)
+}
+
+func (this *ReadWriterFixture) TestUnmodifiedDocumentNotReadAgain() {
+	_ = this.storage.Write(&Document{Value: 1})
+	document := &ConditionalDocument{Document: Document{Value: 42, version: "1"}}
+
+	err := this.storage.Read(document)
+
+	this.So(err, should.Equal, persist.ErrNotModified)
+	this.So(document.Value, should.Equal, 42)
+}
+
+func (this *ReadWriterFixture) TestModifiedDocumentReadAgain() {
+	_ = this.storage.Write(&Document{Value: 1})
+	_ = this.storage.Write(&Document{Value: 2, version: "1"})
+	document := &ConditionalDocument{Document: Document{Value: 1, version: "1"}}
+
+	err := this.storage.Read(document)
+
+	this.So(err, should.BeNil)
+	this.So(document.Value, should.Equal, 2)
+	this.So(document.version, should.Equal, "2")
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type Document struct {
+	Value   int
+	version interface{}
+}
+
+func (this *Document) Lapse(time.Time) projector.Document { return this }
+func (this *Document) Apply(interface{}) bool             { return false }
+func (this *Document) Path() string                       { return "/document.json" }
+func (this *Document) Reset()                             { this.Value = 0 }
+func (this *Document) SetVersion(value interface{})       { this.version = value }
+func (this *Document) Version() interface{}               { return this.version }
+
+type ConditionalDocument struct{ Document }
+
+func (this *ConditionalDocument) ReadIfModified() bool { return true }
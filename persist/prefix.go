@@ -0,0 +1,84 @@
+package persist
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/smartystreets/projector"
+)
+
+// PrefixedReadWriter reads and writes every document beneath the prefix provided, e.g. to
+// rebuild projections alongside those in use without disturbing them.
+type PrefixedReadWriter struct {
+	ReadWriter
+	prefix string
+}
+
+func NewPrefixedReadWriter(inner ReadWriter, prefix string) *PrefixedReadWriter {
+	return &PrefixedReadWriter{ReadWriter: inner, prefix: prefix}
+}
+
+func (this *PrefixedReadWriter) ReadPanic(document projector.Document) {
+	if err := this.Read(document); err != nil {
+		log.Panic(err)
+	}
+}
+func (this *PrefixedReadWriter) Read(document projector.Document) error {
+	return this.ReadWriter.Read(newPrefixedDocument(document, this.prefix))
+}
+func (this *PrefixedReadWriter) Write(document projector.Document) error {
+	return this.ReadWriter.Write(newPrefixedDocument(document, this.prefix))
+}
+
+func (this *PrefixedReadWriter) SignURL(documentPath string, options SignedURLOptions) (string, error) {
+	return signURL(this.ReadWriter, path.Join("/", this.prefix, documentPath), options)
+}
+
+// prefixedDocument places the document beneath the prefix while serializing as the document does.
+type prefixedDocument struct {
+	projector.Document
+	prefix string
+}
+
+func newPrefixedDocument(document projector.Document, prefix string) *prefixedDocument {
+	return &prefixedDocument{Document: document, prefix: prefix}
+}
+
+func (this *prefixedDocument) Path() string { return path.Join("/", this.prefix, this.Document.Path()) }
+
+func (this *prefixedDocument) MarshalJSON() ([]byte, error) { return json.Marshal(this.Document) }
+func (this *prefixedDocument) UnmarshalJSON(raw []byte) error {
+	return json.Unmarshal(raw, this.Document)
+}
+
+func (this *prefixedDocument) SetMetadata(headers http.Header) {
+	if described, ok := this.Document.(MetadataDocument); ok {
+		described.SetMetadata(headers)
+	}
+}
+func (this *prefixedDocument) ReadIfModified() bool {
+	conditional, ok := this.Document.(ConditionalDocument)
+	return ok && conditional.ReadIfModified()
+}
+func (this *prefixedDocument) WriteOptions(defaults WriteOptions) WriteOptions {
+	return ResolveWriteOptions(defaults, this.Document)
+}
+
+// documentCopy serializes as the document does but is kept at another path with a version of
+// its own, e.g. to archive the document.
+type documentCopy struct {
+	*prefixedDocument
+	path    string
+	version interface{}
+}
+
+func NewDocumentCopy(document projector.Document, path string) projector.Document {
+	return &documentCopy{prefixedDocument: newPrefixedDocument(document, ""), path: path}
+}
+
+func (this *documentCopy) Path() string                 { return this.path }
+func (this *documentCopy) SetVersion(value interface{}) { this.version = value }
+func (this *documentCopy) Version() interface{}         { return this.version }
+func (this *documentCopy) Reset()                       {} // the document itself is left alone
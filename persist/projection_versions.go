@@ -0,0 +1,119 @@
+package persist
+
+import (
+	"errors"
+	"time"
+
+	"github.com/smartystreets/projector"
+)
+
+// ProjectionVersions keeps the documents of each version of the projections beneath a prefix
+// of its own (e.g. "/v2/orders/..."), along with a pointer document naming the version in use.
+// A rebuild writes to the next version (see At) while readers keep following the pointer to
+// the current one (see Current); once the rebuild is complete the pointer is switched with a
+// single write, and may later be rolled back to the version it replaced. The write is
+// conditional only where storage enforces the version read (e.g. Google Cloud Storage, but
+// not S3), so elsewhere the pointer must be switched (or rolled back) by one process at a time.
+type ProjectionVersions struct {
+	storage ReadWriter
+	path    string
+	now     func() time.Time
+}
+
+func NewProjectionVersions(storage ReadWriter, pointerPath string) *ProjectionVersions {
+	return &ProjectionVersions{storage: storage, path: pointerPath, now: time.Now}
+}
+
+// At gives back the storage of the documents of the version provided.
+func (this *ProjectionVersions) At(version string) *PrefixedReadWriter {
+	return NewPrefixedReadWriter(this.storage, version)
+}
+
+// Current gives back the storage of the documents of the version named by the pointer.
+func (this *ProjectionVersions) Current() (*PrefixedReadWriter, error) {
+	pointer, err := this.Pointer()
+	if err != nil {
+		return nil, err
+	}
+	if len(pointer.Current) == 0 {
+		return nil, ErrNoProjectionVersion
+	}
+	return this.At(pointer.Current), nil
+}
+
+func (this *ProjectionVersions) Pointer() (*VersionPointer, error) {
+	pointer := newVersionPointer(this.path)
+	if err := this.storage.Read(pointer); err != nil {
+		return nil, err
+	}
+	return pointer, nil
+}
+
+// Switch points readers at the version provided, remembering the version it replaces. When
+// another process has switched the pointer since it was read, storage which enforces versions
+// rejects the write with ErrConcurrentWrite; other storage keeps the last write, which drops
+// the version switched to by the other process from those to roll back to.
+func (this *ProjectionVersions) Switch(version string) error {
+	if len(version) == 0 {
+		return ErrNoProjectionVersion
+	}
+
+	pointer, err := this.Pointer()
+	if err != nil {
+		return err
+	}
+	if pointer.Current == version {
+		return nil
+	}
+
+	if len(pointer.Current) > 0 {
+		pointer.Previous = append(pointer.Previous, pointer.Current)
+	}
+	pointer.Current = version
+	pointer.Switched = this.now().UTC()
+	return this.storage.Write(pointer)
+}
+
+// Rollback points readers back at the version in use before the most recent switch; like
+// Switch, it is rejected with ErrConcurrentWrite only where storage enforces versions.
+func (this *ProjectionVersions) Rollback() error {
+	pointer, err := this.Pointer()
+	if err != nil {
+		return err
+	}
+	if len(pointer.Previous) == 0 {
+		return ErrNoPreviousVersion
+	}
+
+	last := len(pointer.Previous) - 1
+	pointer.Current, pointer.Previous = pointer.Previous[last], pointer.Previous[:last]
+	pointer.Switched = this.now().UTC()
+	return this.storage.Write(pointer)
+}
+
+var (
+	ErrNoProjectionVersion = errors.New("no projection version has been named")
+	ErrNoPreviousVersion   = errors.New("no previous projection version to roll back to")
+)
+
+// VersionPointer is the document naming the version of the projections in use, along with
+// those previously in use (most recent last).
+type VersionPointer struct {
+	projector.VersionInfo
+	path     string
+	Current  string
+	Previous []string `json:",omitempty"`
+	Switched time.Time
+}
+
+func newVersionPointer(path string) *VersionPointer {
+	return &VersionPointer{path: path}
+}
+
+func (this *VersionPointer) Lapse(time.Time) projector.Document { return this }
+func (this *VersionPointer) Apply(interface{}) bool             { return false }
+func (this *VersionPointer) Path() string                       { return this.path }
+func (this *VersionPointer) Reset() {
+	this.Current, this.Previous, this.Switched = "", nil, time.Time{}
+	this.VersionInfo.Reset()
+}
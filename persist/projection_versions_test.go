@@ -0,0 +1,133 @@
+package persist
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+)
+
+func TestProjectionVersionsFixture(t *testing.T) {
+	gunit.Run(new(ProjectionVersionsFixture), t)
+}
+
+type ProjectionVersionsFixture struct {
+	*gunit.Fixture
+
+	storage  *FakePathStorage
+	versions *ProjectionVersions
+}
+
+func (this *ProjectionVersionsFixture) Setup() {
+	this.storage = NewFakePathStorage()
+	this.versions = NewProjectionVersions(this.storage, "/projections.json")
+}
+
+func (this *ProjectionVersionsFixture) TestNoCurrentVersionUntilSwitched() {
+	current, err := this.versions.Current()
+
+	this.So(current, should.BeNil)
+	this.So(err, should.Equal, ErrNoProjectionVersion)
+}
+
+func (this *ProjectionVersionsFixture) TestReadersFollowPointerOnceSwitched() {
+	_ = this.versions.At("v1").Write(&CountingDocument{Count: 1})
+	_ = this.versions.Switch("v1")
+	_ = this.versions.At("v2").Write(&CountingDocument{Count: 2})
+
+	this.So(this.readCurrent(), should.Equal, 1) // v2 is still being rebuilt
+	this.So(this.versions.Switch("v2"), should.BeNil)
+	this.So(this.readCurrent(), should.Equal, 2)
+	this.So(this.storage.documents, should.ContainKey, "/v1/counting.json")
+	this.So(this.storage.documents, should.ContainKey, "/v2/counting.json")
+}
+func (this *ProjectionVersionsFixture) readCurrent() int {
+	current, err := this.versions.Current()
+	this.So(err, should.BeNil)
+	document := &CountingDocument{}
+	this.So(current.Read(document), should.BeNil)
+	return document.Count
+}
+
+func (this *ProjectionVersionsFixture) TestRollbackRestoresPreviousVersions() {
+	_ = this.versions.Switch("v1")
+	_ = this.versions.Switch("v2")
+	_ = this.versions.Switch("v3")
+
+	this.So(this.versions.Rollback(), should.BeNil)
+	this.So(this.current(), should.Equal, "v2")
+	this.So(this.versions.Rollback(), should.BeNil)
+	this.So(this.current(), should.Equal, "v1")
+	this.So(this.versions.Rollback(), should.Equal, ErrNoPreviousVersion)
+	this.So(this.current(), should.Equal, "v1")
+}
+func (this *ProjectionVersionsFixture) current() string {
+	pointer, _ := this.versions.Pointer()
+	return pointer.Current
+}
+
+func (this *ProjectionVersionsFixture) TestConcurrentSwitchRejected() {
+	_ = this.versions.Switch("v1")
+	this.storage.conflict = true
+
+	err := this.versions.Switch("v2")
+
+	this.So(err, should.Equal, ErrConcurrentWrite)
+	this.So(this.current(), should.Equal, "v1")
+}
+
+func (this *ProjectionVersionsFixture) TestConcurrentSwitchLastWriteWinsWhereVersionsNotEnforced() {
+	_ = this.versions.Switch("v1")
+	this.storage.unenforced = true
+	this.storage.beforeWrite = func() {
+		this.storage.beforeWrite = nil
+		this.So(NewProjectionVersions(this.storage, "/projections.json").Switch("v3"), should.BeNil)
+	}
+
+	err := this.versions.Switch("v2")
+
+	pointer, _ := this.versions.Pointer()
+	this.So(err, should.BeNil)
+	this.So(pointer.Current, should.Equal, "v2")
+	this.So(pointer.Previous, should.Resemble, []string{"v1"}) // v3 is lost
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakePathStorage struct {
+	documents   map[string][]byte
+	generations map[string]int
+	conflict    bool
+	unenforced  bool // the version read isn't a precondition of writing (e.g. S3)
+	beforeWrite func()
+}
+
+func NewFakePathStorage() *FakePathStorage {
+	return &FakePathStorage{documents: map[string][]byte{}, generations: map[string]int{}}
+}
+
+func (this *FakePathStorage) Read(document projector.Document) error {
+	if raw, found := this.documents[document.Path()]; found {
+		_ = json.Unmarshal(raw, document)
+	}
+	document.SetVersion(this.generations[document.Path()])
+	return nil
+}
+func (this *FakePathStorage) ReadPanic(projector.Document) {}
+func (this *FakePathStorage) Write(document projector.Document) error {
+	if this.beforeWrite != nil {
+		this.beforeWrite()
+	}
+
+	expected, _ := document.Version().(int)
+	if this.conflict || (!this.unenforced && expected != this.generations[document.Path()]) {
+		return ErrConcurrentWrite
+	}
+	this.documents[document.Path()], _ = json.Marshal(document)
+	this.generations[document.Path()]++
+	document.SetVersion(this.generations[document.Path()])
+	return nil
+}
+func (this *FakePathStorage) Name() string { return "Fake" }
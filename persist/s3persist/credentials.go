@@ -0,0 +1,151 @@
+package s3persist
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/s3"
+)
+
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time // zero for credentials that never expire
+}
+
+func (this Credentials) valid() bool {
+	return len(this.AccessKeyID) > 0 && len(this.SecretAccessKey) > 0
+}
+func (this Credentials) option() s3.Option {
+	return s3.STSCredentials(this.AccessKeyID, this.SecretAccessKey, this.SessionToken, this.Expiration)
+}
+
+// CredentialProvider supplies the credentials used to sign each request.
+type CredentialProvider interface {
+	Credentials() (Credentials, error)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type StaticCredentials Credentials
+
+func NewStaticCredentials(accessKey, secretKey string) StaticCredentials {
+	return StaticCredentials{AccessKeyID: accessKey, SecretAccessKey: secretKey}
+}
+func (this StaticCredentials) Credentials() (Credentials, error) { return Credentials(this), nil }
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// EnvironmentCredentials reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN
+// (or their legacy equivalents) from the environment.
+type EnvironmentCredentials struct {
+	lookup func(string) string
+}
+
+func NewEnvironmentCredentials(lookup func(string) string) *EnvironmentCredentials {
+	if lookup == nil {
+		lookup = os.Getenv
+	}
+	return &EnvironmentCredentials{lookup: lookup}
+}
+func (this *EnvironmentCredentials) Credentials() (Credentials, error) {
+	credentials := Credentials{
+		AccessKeyID:     this.first("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY"),
+		SecretAccessKey: this.first("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY"),
+		SessionToken:    this.first("AWS_SESSION_TOKEN", "AWS_SECURITY_TOKEN"),
+	}
+	if !credentials.valid() {
+		return Credentials{}, errors.New("no AWS credentials found in the environment")
+	}
+	return credentials, nil
+}
+func (this *EnvironmentCredentials) first(names ...string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(this.lookup(name)); len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// ChainCredentials asks each provider in turn and uses the credentials of the first that succeeds;
+// a provider giving back empty credentials has failed.
+type ChainCredentials []CredentialProvider
+
+func (this ChainCredentials) Credentials() (Credentials, error) {
+	var failures []string
+	for _, provider := range this {
+		credentials, err := provider.Credentials()
+		if err == nil && credentials.valid() {
+			return credentials, nil
+		} else if err == nil {
+			err = fmt.Errorf("%T provided empty credentials", provider)
+		}
+		failures = append(failures, err.Error())
+	}
+	return Credentials{}, fmt.Errorf("no AWS credentials available: [%s]", strings.Join(failures, "; "))
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// RefreshingCredentials caches the credentials of the inner provider and asks
+// for new ones when they are within the refresh window of their expiration.
+type RefreshingCredentials struct {
+	inner  CredentialProvider
+	window time.Duration
+	now    func() time.Time
+
+	mutex   sync.Mutex
+	current Credentials
+}
+
+func NewRefreshingCredentials(inner CredentialProvider, window time.Duration, now func() time.Time) *RefreshingCredentials {
+	return &RefreshingCredentials{inner: inner, window: window, now: now}
+}
+func (this *RefreshingCredentials) Credentials() (Credentials, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.current.valid() && !this.expiring() {
+		return this.current, nil
+	}
+
+	credentials, err := this.inner.Credentials()
+	if err != nil && this.current.valid() && this.now().Before(this.current.Expiration) {
+		return this.current, nil // refresh failed, but what we have still works for now
+	} else if err != nil {
+		return Credentials{}, err
+	}
+
+	this.current = credentials
+	return credentials, nil
+}
+func (this *RefreshingCredentials) expiring() bool {
+	if this.current.Expiration.IsZero() {
+		return false
+	}
+	return !this.now().Before(this.current.Expiration.Add(-this.window))
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// NewAmbientCredentials assembles the customary chain of providers (environment, shared
+// credentials file, web identity token, container endpoint, and instance metadata)
+// and refreshes the resulting credentials five minutes before they expire.
+func NewAmbientCredentials(client persist.HTTPClient) CredentialProvider {
+	return NewRefreshingCredentials(ChainCredentials{
+		NewEnvironmentCredentials(os.Getenv),
+		NewSharedFileCredentials("", ""),
+		NewWebIdentityCredentials(client, os.Getenv),
+		NewContainerCredentials(client, os.Getenv),
+		NewInstanceMetadataCredentials(client, defaultInstanceMetadataEndpoint),
+	}, time.Minute*5, time.Now)
+}
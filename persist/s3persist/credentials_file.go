@@ -0,0 +1,87 @@
+package s3persist
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SharedFileCredentials reads a profile from the shared credentials file (~/.aws/credentials)
+// or, failing that, from the shared config file (~/.aws/config).
+type SharedFileCredentials struct {
+	filenames []string
+	profile   string
+}
+
+// NewSharedFileCredentials uses AWS_SHARED_CREDENTIALS_FILE, AWS_CONFIG_FILE, and AWS_PROFILE
+// (or their customary defaults) for whichever of the filename and profile are left blank.
+func NewSharedFileCredentials(filename, profile string) *SharedFileCredentials {
+	filenames := []string{filename}
+	if len(filename) == 0 {
+		home, _ := os.UserHomeDir()
+		filenames = []string{
+			firstNonBlank(os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), filepath.Join(home, ".aws", "credentials")),
+			firstNonBlank(os.Getenv("AWS_CONFIG_FILE"), filepath.Join(home, ".aws", "config")),
+		}
+	}
+
+	return &SharedFileCredentials{
+		filenames: filenames,
+		profile:   firstNonBlank(profile, os.Getenv("AWS_PROFILE"), "default"),
+	}
+}
+
+func (this *SharedFileCredentials) Credentials() (Credentials, error) {
+	for _, filename := range this.filenames {
+		values, err := this.readProfile(filename)
+		if err != nil {
+			continue
+		}
+
+		credentials := Credentials{
+			AccessKeyID:     values["aws_access_key_id"],
+			SecretAccessKey: values["aws_secret_access_key"],
+			SessionToken:    values["aws_session_token"],
+		}
+		if credentials.valid() {
+			return credentials, nil
+		}
+	}
+
+	return Credentials{}, fmt.Errorf("no AWS credentials found in shared files for profile '%s'", this.profile)
+}
+
+func (this *SharedFileCredentials) readProfile(filename string) (map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	values := map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		} else if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(strings.TrimPrefix(strings.Trim(line, "[]"), "profile "))
+		} else if index := strings.Index(line, "="); index > 0 && section == this.profile {
+			values[strings.TrimSpace(line[:index])] = strings.TrimSpace(line[index+1:])
+		}
+	}
+
+	return values, scanner.Err()
+}
+
+func firstNonBlank(values ...string) string {
+	for _, value := range values {
+		if len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
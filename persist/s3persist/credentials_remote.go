@@ -0,0 +1,247 @@
+package s3persist
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smartystreets/projector/persist"
+)
+
+// InstanceMetadataCredentials obtains the credentials of the IAM role attached to an
+// EC2 instance from the instance metadata service (IMDSv2, falling back to IMDSv1). Once the
+// service can't be reached (e.g. when not running on EC2), it isn't asked again for a minute,
+// so that a chain of providers which ends with it doesn't wait on it for every request.
+type InstanceMetadataCredentials struct {
+	client   persist.HTTPClient
+	endpoint string
+	now      func() time.Time
+
+	mutex       sync.Mutex
+	unreachable time.Time // until when the service is taken to be unreachable
+}
+
+func NewInstanceMetadataCredentials(client persist.HTTPClient, endpoint string) *InstanceMetadataCredentials {
+	return &InstanceMetadataCredentials{client: client, endpoint: strings.TrimSuffix(endpoint, "/"), now: time.Now}
+}
+
+func (this *InstanceMetadataCredentials) Credentials() (Credentials, error) {
+	if this.now().Before(this.unreachableUntil()) {
+		return Credentials{}, errInstanceMetadataUnreachable
+	}
+
+	token, err := this.sessionToken()
+	if err != nil {
+		this.markUnreachable()
+		return Credentials{}, err
+	}
+
+	roles, err := this.get(this.endpoint+instanceMetadataCredentialsPath, token)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if len(role) == 0 {
+		return Credentials{}, errors.New("no IAM role attached to the instance")
+	}
+
+	body, err := this.get(this.endpoint+instanceMetadataCredentialsPath+role, token)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return decodeRemoteCredentials(body)
+}
+
+// sessionToken requests an IMDSv2 token; it is empty (for IMDSv1) when the service refuses
+// to issue one, and an error is returned only when the service can't be reached at all.
+func (this *InstanceMetadataCredentials) sessionToken() (string, error) {
+	request, _ := http.NewRequest("PUT", this.endpoint+"/latest/api/token", nil)
+	request.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+
+	response, err := this.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", errInstanceMetadataUnreachable, err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil || response.StatusCode != http.StatusOK {
+		return "", nil // IMDSv1
+	}
+	return string(body), nil
+}
+func (this *InstanceMetadataCredentials) unreachableUntil() time.Time {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.unreachable
+}
+func (this *InstanceMetadataCredentials) markUnreachable() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.unreachable = this.now().Add(instanceMetadataRetryInterval)
+}
+func (this *InstanceMetadataCredentials) get(address, token string) ([]byte, error) {
+	request, _ := http.NewRequest("GET", address, nil)
+	if len(token) > 0 {
+		request.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+	return do(this.client, request)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// ContainerCredentials obtains the credentials of an ECS task role (or any other
+// container credential endpoint) as advertised by the environment.
+type ContainerCredentials struct {
+	client persist.HTTPClient
+	lookup func(string) string
+}
+
+func NewContainerCredentials(client persist.HTTPClient, lookup func(string) string) *ContainerCredentials {
+	return &ContainerCredentials{client: client, lookup: lookup}
+}
+
+func (this *ContainerCredentials) Credentials() (Credentials, error) {
+	address := this.lookup("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := this.lookup("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); len(relative) > 0 {
+		address = containerCredentialsEndpoint + relative
+	}
+	if len(address) == 0 {
+		return Credentials{}, errors.New("no container credentials endpoint specified")
+	}
+
+	request, err := http.NewRequest("GET", address, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if token := this.lookup("AWS_CONTAINER_AUTHORIZATION_TOKEN"); len(token) > 0 {
+		request.Header.Set("Authorization", token)
+	}
+
+	body, err := do(this.client, request)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return decodeRemoteCredentials(body)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// WebIdentityCredentials exchanges the OIDC token found at AWS_WEB_IDENTITY_TOKEN_FILE for
+// temporary credentials of AWS_ROLE_ARN by way of STS AssumeRoleWithWebIdentity.
+type WebIdentityCredentials struct {
+	client   persist.HTTPClient
+	lookup   func(string) string
+	endpoint string
+}
+
+func NewWebIdentityCredentials(client persist.HTTPClient, lookup func(string) string) *WebIdentityCredentials {
+	return &WebIdentityCredentials{client: client, lookup: lookup, endpoint: defaultSecurityTokenEndpoint}
+}
+func (this *WebIdentityCredentials) WithEndpoint(endpoint string) *WebIdentityCredentials {
+	this.endpoint = endpoint
+	return this
+}
+
+func (this *WebIdentityCredentials) Credentials() (Credentials, error) {
+	filename, role := this.lookup("AWS_WEB_IDENTITY_TOKEN_FILE"), this.lookup("AWS_ROLE_ARN")
+	if len(filename) == 0 || len(role) == 0 {
+		return Credentials{}, errors.New("no web identity token file or role specified")
+	}
+
+	token, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	query := url.Values{}
+	query.Set("Action", "AssumeRoleWithWebIdentity")
+	query.Set("Version", "2011-06-15")
+	query.Set("RoleArn", role)
+	query.Set("RoleSessionName", firstNonBlank(this.lookup("AWS_ROLE_SESSION_NAME"), "projector"))
+	query.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+
+	request, _ := http.NewRequest("POST", this.endpoint, strings.NewReader(query.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := do(this.client, request)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	var response struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+			Expiration      time.Time
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err = xml.Unmarshal(body, &response); err != nil {
+		return Credentials{}, fmt.Errorf("malformed STS response: %s", err)
+	}
+
+	return Credentials{
+		AccessKeyID:     response.Credentials.AccessKeyId,
+		SecretAccessKey: response.Credentials.SecretAccessKey,
+		SessionToken:    response.Credentials.SessionToken,
+		Expiration:      response.Credentials.Expiration,
+	}, nil
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+func do(client persist.HTTPClient, request *http.Request) ([]byte, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	} else if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("credential endpoint responded with status: %d %s", response.StatusCode, request.URL.Path)
+	}
+
+	return body, nil
+}
+func decodeRemoteCredentials(body []byte) (Credentials, error) {
+	var remote struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal(body, &remote); err != nil {
+		return Credentials{}, fmt.Errorf("malformed credentials response: %s", err)
+	}
+
+	return Credentials{
+		AccessKeyID:     remote.AccessKeyId,
+		SecretAccessKey: remote.SecretAccessKey,
+		SessionToken:    remote.Token,
+		Expiration:      remote.Expiration,
+	}, nil
+}
+
+const (
+	defaultInstanceMetadataEndpoint = "http://169.254.169.254"
+	instanceMetadataCredentialsPath = "/latest/meta-data/iam/security-credentials/"
+	instanceMetadataRetryInterval   = time.Minute
+	containerCredentialsEndpoint    = "http://169.254.170.2"
+	defaultSecurityTokenEndpoint    = "https://sts.amazonaws.com/"
+)
+
+var errInstanceMetadataUnreachable = errors.New("instance metadata service unreachable")
@@ -0,0 +1,271 @@
+package s3persist
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+)
+
+func TestCredentialsFixture(t *testing.T) {
+	gunit.Run(new(CredentialsFixture), t)
+}
+
+type CredentialsFixture struct {
+	*gunit.Fixture
+
+	environment map[string]string
+	folder      string
+	now         time.Time
+	expiration  time.Time
+}
+
+func (this *CredentialsFixture) Setup() {
+	this.environment = map[string]string{}
+	this.folder, _ = ioutil.TempDir("", "credentials")
+	this.now = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	this.expiration = this.now.Add(time.Hour)
+}
+func (this *CredentialsFixture) Teardown() {
+	_ = os.RemoveAll(this.folder)
+}
+func (this *CredentialsFixture) lookup(name string) string { return this.environment[name] }
+
+func (this *CredentialsFixture) TestEnvironmentCredentials() {
+	this.environment["AWS_ACCESS_KEY_ID"] = "access"
+	this.environment["AWS_SECRET_ACCESS_KEY"] = "secret"
+	this.environment["AWS_SESSION_TOKEN"] = "token"
+
+	credentials, err := NewEnvironmentCredentials(this.lookup).Credentials()
+
+	this.So(err, should.BeNil)
+	this.So(credentials, should.Resemble, Credentials{AccessKeyID: "access", SecretAccessKey: "secret", SessionToken: "token"})
+}
+func (this *CredentialsFixture) TestEnvironmentCredentialsMissing() {
+	_, err := NewEnvironmentCredentials(this.lookup).Credentials()
+
+	this.So(err, should.NotBeNil)
+}
+
+func (this *CredentialsFixture) TestSharedFileCredentialsForProfile() {
+	filename := filepath.Join(this.folder, "credentials")
+	_ = ioutil.WriteFile(filename, []byte(sharedCredentialsFile), 0600)
+
+	credentials, err := NewSharedFileCredentials(filename, "other").Credentials()
+
+	this.So(err, should.BeNil)
+	this.So(credentials.AccessKeyID, should.Equal, "other-access")
+	this.So(credentials.SecretAccessKey, should.Equal, "other-secret")
+	this.So(credentials.SessionToken, should.Equal, "other-token")
+}
+
+const sharedCredentialsFile = `
+[default]
+aws_access_key_id = default-access
+aws_secret_access_key = default-secret
+
+# comment
+[profile other]
+aws_access_key_id = other-access
+aws_secret_access_key = other-secret
+aws_session_token = other-token
+`
+
+func (this *CredentialsFixture) TestInstanceMetadataCredentials() {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.Method == "PUT" && request.URL.Path == "/latest/api/token" {
+			_, _ = fmt.Fprint(response, "imds-token")
+		} else if request.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			response.WriteHeader(http.StatusUnauthorized)
+		} else if request.URL.Path == instanceMetadataCredentialsPath {
+			_, _ = fmt.Fprint(response, "my-role\n")
+		} else if request.URL.Path == instanceMetadataCredentialsPath+"my-role" {
+			_, _ = fmt.Fprint(response, this.remoteCredentials())
+		} else {
+			response.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	credentials, err := NewInstanceMetadataCredentials(server.Client(), server.URL).Credentials()
+
+	this.So(err, should.BeNil)
+	this.assertRemoteCredentials(credentials)
+}
+
+func (this *CredentialsFixture) TestContainerCredentials() {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Authorization") != "container-token" {
+			response.WriteHeader(http.StatusUnauthorized)
+		} else {
+			_, _ = fmt.Fprint(response, this.remoteCredentials())
+		}
+	}))
+	defer server.Close()
+	this.environment["AWS_CONTAINER_CREDENTIALS_FULL_URI"] = server.URL + "/credentials"
+	this.environment["AWS_CONTAINER_AUTHORIZATION_TOKEN"] = "container-token"
+
+	credentials, err := NewContainerCredentials(server.Client(), this.lookup).Credentials()
+
+	this.So(err, should.BeNil)
+	this.assertRemoteCredentials(credentials)
+}
+
+func (this *CredentialsFixture) TestWebIdentityCredentials() {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		_ = request.ParseForm()
+		if request.Form.Get("WebIdentityToken") != "oidc-token" || request.Form.Get("RoleArn") != "arn:role" {
+			response.WriteHeader(http.StatusForbidden)
+		} else {
+			_, _ = fmt.Fprintf(response, webIdentityResponse, this.expiration.Format(time.RFC3339))
+		}
+	}))
+	defer server.Close()
+	tokenFile := filepath.Join(this.folder, "token")
+	_ = ioutil.WriteFile(tokenFile, []byte("oidc-token\n"), 0600)
+	this.environment["AWS_WEB_IDENTITY_TOKEN_FILE"] = tokenFile
+	this.environment["AWS_ROLE_ARN"] = "arn:role"
+
+	credentials, err := NewWebIdentityCredentials(server.Client(), this.lookup).WithEndpoint(server.URL).Credentials()
+
+	this.So(err, should.BeNil)
+	this.assertRemoteCredentials(credentials)
+}
+
+const webIdentityResponse = `<AssumeRoleWithWebIdentityResponse>
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>remote-access</AccessKeyId>
+      <SecretAccessKey>remote-secret</SecretAccessKey>
+      <SessionToken>remote-token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`
+
+func (this *CredentialsFixture) TestChainUsesFirstSuccessfulProvider() {
+	chain := ChainCredentials{
+		NewEnvironmentCredentials(this.lookup),
+		NewStaticCredentials("static-access", "static-secret"),
+	}
+
+	credentials, err := chain.Credentials()
+
+	this.So(err, should.BeNil)
+	this.So(credentials.AccessKeyID, should.Equal, "static-access")
+}
+func (this *CredentialsFixture) TestChainFailsWhenNoProviderSucceeds() {
+	_, err := ChainCredentials{NewEnvironmentCredentials(this.lookup)}.Credentials()
+
+	this.So(err, should.NotBeNil)
+}
+
+func (this *CredentialsFixture) TestChainReportsEmptyCredentials() {
+	_, err := ChainCredentials{NewStaticCredentials("", "")}.Credentials()
+
+	this.So(err, should.NotBeNil)
+	this.So(err.Error(), should.ContainSubstring, "empty credentials")
+}
+func (this *CredentialsFixture) TestUnreachableInstanceMetadataNotAskedAgainForAWhile() {
+	client := &FakeUnreachableClient{}
+	provider := NewInstanceMetadataCredentials(client, defaultInstanceMetadataEndpoint)
+	provider.now = func() time.Time { return this.now }
+
+	_, first := provider.Credentials()
+	_, second := provider.Credentials()
+	this.now = this.now.Add(instanceMetadataRetryInterval)
+	_, _ = provider.Credentials()
+
+	this.So(first, should.NotBeNil)
+	this.So(second, should.Equal, errInstanceMetadataUnreachable)
+	this.So(client.calls, should.Equal, 2)
+}
+
+func (this *CredentialsFixture) TestRefreshingCredentialsCachedUntilWindow() {
+	inner := &FakeCredentialProvider{expiration: this.expiration}
+	refreshing := NewRefreshingCredentials(inner, time.Minute*5, func() time.Time { return this.now })
+
+	_, _ = refreshing.Credentials()
+	this.now = this.expiration.Add(-time.Minute * 6)
+	_, _ = refreshing.Credentials()
+	this.So(inner.calls, should.Equal, 1)
+
+	this.now = this.expiration.Add(-time.Minute * 5)
+	credentials, _ := refreshing.Credentials()
+	this.So(inner.calls, should.Equal, 2)
+	this.So(credentials.SessionToken, should.Equal, "token-2")
+}
+func (this *CredentialsFixture) TestRefreshFailureKeepsUnexpiredCredentials() {
+	inner := &FakeCredentialProvider{expiration: this.expiration}
+	refreshing := NewRefreshingCredentials(inner, time.Minute*5, func() time.Time { return this.now })
+	_, _ = refreshing.Credentials()
+	inner.err = errors.New("unavailable")
+
+	this.now = this.expiration.Add(-time.Minute)
+	credentials, err := refreshing.Credentials()
+	this.So(err, should.BeNil)
+	this.So(credentials.SessionToken, should.Equal, "token-1")
+
+	this.now = this.expiration
+	_, err = refreshing.Credentials()
+	this.So(err, should.NotBeNil)
+}
+
+func (this *CredentialsFixture) TestReaderSignsWithSessionToken() {
+	client := &FakeHTTPGetClient{response: &http.Response{StatusCode: 404, Body: newHTTPBody("")}}
+	address := urlParsed("https://bucket.s3-us-west-1.amazonaws.com/")
+	provider := StaticCredentials{AccessKeyID: "access", SecretAccessKey: "secret", SessionToken: "session"}
+	reader := NewReader(address, "", "", client).WithCredentials(provider)
+
+	_ = reader.Read(&Document{})
+
+	this.So(client.request.Header.Get("X-Amz-Security-Token"), should.Equal, "session")
+	this.So(client.request.Header.Get("Authorization"), should.ContainSubstring, "Credential=access/")
+}
+
+func (this *CredentialsFixture) remoteCredentials() string {
+	return fmt.Sprintf(`{"AccessKeyId":"remote-access","SecretAccessKey":"remote-secret","Token":"remote-token","Expiration":"%s"}`,
+		this.expiration.Format(time.RFC3339))
+}
+func (this *CredentialsFixture) assertRemoteCredentials(credentials Credentials) {
+	this.So(credentials.AccessKeyID, should.Equal, "remote-access")
+	this.So(credentials.SecretAccessKey, should.Equal, "remote-secret")
+	this.So(credentials.SessionToken, should.Equal, "remote-token")
+	this.So(credentials.Expiration, should.Equal, this.expiration)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeCredentialProvider struct {
+	calls      int
+	expiration time.Time
+	err        error
+}
+
+func (this *FakeCredentialProvider) Credentials() (Credentials, error) {
+	if this.err != nil {
+		return Credentials{}, this.err
+	}
+	this.calls++
+	return Credentials{
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		SessionToken:    fmt.Sprintf("token-%d", this.calls),
+		Expiration:      this.expiration,
+	}, nil
+}
+
+type FakeUnreachableClient struct{ calls int }
+
+func (this *FakeUnreachableClient) Do(*http.Request) (*http.Response, error) {
+	this.calls++
+	return nil, errors.New("no route to host")
+}
@@ -0,0 +1,88 @@
+package s3persist
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/s3"
+)
+
+func serverSideEncryption(options persist.WriteOptions) s3.Option {
+	value := serverSideEncryptionValue(options)
+	return s3.ConditionalOption(s3.ServerSideEncryption(value), len(value) > 0)
+}
+func serverSideEncryptionValue(options persist.WriteOptions) s3.ServerSideEncryptionValue {
+	if len(options.CustomerKey) > 0 {
+		return "" // SSE-C is exclusive of the other modes
+	} else if len(options.KMSKeyID) > 0 {
+		return s3.ServerSideEncryptionAWSKMS
+	} else {
+		return s3.ServerSideEncryptionAES256
+	}
+}
+
+// appendWriteHeaders adds the headers for which the s3 package has no option and
+// reports whether any of them must be signed.
+func appendWriteHeaders(headers http.Header, options persist.WriteOptions) (signed bool) {
+	if len(options.CacheControl) > 0 {
+		headers.Set("Cache-Control", options.CacheControl)
+	}
+
+	signed = appendCustomerKeyHeaders(headers, options.CustomerKey)
+	signed = appendHeader(headers, "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", options.KMSKeyID) || signed
+	signed = appendHeader(headers, "X-Amz-Storage-Class", options.StorageClass) || signed
+	signed = appendHeader(headers, "X-Amz-Acl", options.ACL) || signed
+	for key, value := range options.Metadata {
+		signed = appendHeader(headers, "X-Amz-Meta-"+strings.ToLower(key), value) || signed
+	}
+
+	return signed
+}
+func appendCustomerKeyHeaders(headers http.Header, key []byte) bool {
+	if len(key) == 0 {
+		return false
+	}
+
+	checksum := md5.Sum(key)
+	headers.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	headers.Set("X-Amz-Server-Side-Encryption-Customer-Key", base64.StdEncoding.EncodeToString(key))
+	headers.Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", base64.StdEncoding.EncodeToString(checksum[:]))
+	return true
+}
+func appendHeader(headers http.Header, name, value string) bool {
+	if len(value) == 0 {
+		return false
+	}
+	headers.Set(name, value)
+	return true
+}
+
+// expectedChecksums gives back the checksums of the stored bytes published with the object:
+// Content-MD5, if present, otherwise the ETag, which is the MD5 only for objects that were
+// neither uploaded in parts nor encrypted with SSE-KMS or SSE-C, and the SHA-256 embedded
+// in the user metadata, if any.
+func expectedChecksums(response *http.Response) (checksums persist.Checksums) {
+	if response.Uncompressed {
+		return checksums // the transport decompressed the body
+	}
+
+	checksums.SHA256 = persist.DecodeChecksum(response.Header.Get("X-Amz-Meta-" + persist.ChecksumMetadataKey))
+	if checksums.MD5 = persist.DecodeChecksum(response.Header.Get("Content-MD5")); len(checksums.MD5) > 0 {
+		return checksums
+	}
+
+	if response.Header.Get("X-Amz-Server-Side-Encryption") == string(s3.ServerSideEncryptionAWSKMS) ||
+		len(response.Header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm")) > 0 {
+		return checksums
+	}
+
+	if etag := strings.Trim(response.Header.Get("ETag"), `"`); len(etag) == md5.Size*2 {
+		checksums.MD5, _ = hex.DecodeString(etag) // multipart ETags carry a "-N" suffix and fail to decode
+	}
+
+	return checksums
+}
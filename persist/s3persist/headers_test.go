@@ -0,0 +1,118 @@
+package s3persist
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/s3"
+)
+
+func TestWriteOptionsFixture(t *testing.T) {
+	gunit.Run(new(WriteOptionsFixture), t)
+}
+
+type WriteOptionsFixture struct {
+	*gunit.Fixture
+	client *FakeHTTPClientForWriting
+	writer *Writer
+}
+
+func (this *WriteOptionsFixture) Setup() {
+	this.client = NewFakeHTTPClientForWriting()
+	address := urlParsed("https://bucket.s3-us-west-1.amazonaws.com/")
+	this.writer = NewWriter(address, "access", "secret", this.client)
+}
+
+func (this *WriteOptionsFixture) TestSignerReproducesSignatureOfS3Package() {
+	request, _ := s3.NewRequest(s3.PUT,
+		s3.Credentials("access", "secret"),
+		s3.StorageAddress(urlParsed("https://bucket.s3-us-west-1.amazonaws.com/")),
+		s3.Key("/some path/with spaces~and-symbols.json"),
+		s3.ContentString("content"),
+		s3.ContentType("application/json"),
+		s3.ContentMD5("checksum"),
+		s3.ServerSideEncryption(s3.ServerSideEncryptionAES256))
+	expected := request.Header.Get("Authorization")
+
+	newSigner("us-west-1", Credentials{AccessKeyID: "access", SecretAccessKey: "secret"}).Sign(request)
+
+	this.So(request.Header.Get("Authorization"), should.Equal, expected)
+}
+
+func (this *WriteOptionsFixture) TestDefaultsRetainServerSideEncryptionAES256() {
+	_ = this.writer.Write(writableDocument)
+
+	this.So(this.client.received.Header.Get("X-Amz-Server-Side-Encryption"), should.Equal, "AES256")
+	this.So(this.client.received.Header.Get("X-Amz-Storage-Class"), should.BeBlank)
+}
+
+func (this *WriteOptionsFixture) TestKMSEncryptionAndMetadata() {
+	this.writer.WithWriteOptions(persist.WriteOptions{
+		ContentType:  "application/vnd.projection+json",
+		CacheControl: "max-age=60",
+		StorageClass: "STANDARD_IA",
+		ACL:          "bucket-owner-full-control",
+		Metadata:     map[string]string{"Projection": "daily"},
+		KMSKeyID:     "key-id",
+	})
+
+	_ = this.writer.Write(writableDocument)
+
+	headers := this.client.received.Header
+	this.So(headers.Get("Content-Type"), should.Equal, "application/vnd.projection+json")
+	this.So(headers.Get("Cache-Control"), should.Equal, "max-age=60")
+	this.So(headers.Get("X-Amz-Storage-Class"), should.Equal, "STANDARD_IA")
+	this.So(headers.Get("X-Amz-Acl"), should.Equal, "bucket-owner-full-control")
+	this.So(headers.Get("X-Amz-Meta-Projection"), should.Equal, "daily")
+	this.So(headers.Get("X-Amz-Server-Side-Encryption"), should.Equal, "aws:kms")
+	this.So(headers.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"), should.Equal, "key-id")
+	this.So(headers.Get("Authorization"), should.ContainSubstring, "x-amz-meta-projection;x-amz-server-side-encryption;")
+}
+
+func (this *WriteOptionsFixture) TestCustomerKeyReplacesOtherEncryption() {
+	this.writer.WithWriteOptions(persist.WriteOptions{CustomerKey: []byte("0123456789abcdef0123456789abcdef")})
+
+	_ = this.writer.Write(writableDocument)
+
+	headers := this.client.received.Header
+	this.So(headers.Get("X-Amz-Server-Side-Encryption"), should.BeBlank)
+	this.So(headers.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"), should.Equal, "AES256")
+	this.So(headers.Get("X-Amz-Server-Side-Encryption-Customer-Key"), should.Equal, "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	this.So(headers.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"), should.NotBeBlank)
+}
+
+func (this *WriteOptionsFixture) TestDocumentOverridesConfiguredOptions() {
+	this.writer.WithWriteOptions(persist.WriteOptions{StorageClass: "STANDARD_IA", CacheControl: "max-age=60"})
+
+	_ = this.writer.Write(&DocumentWithWriteOptions{})
+
+	this.So(this.client.received.Header.Get("X-Amz-Storage-Class"), should.Equal, "GLACIER")
+	this.So(this.client.received.Header.Get("Cache-Control"), should.Equal, "max-age=60")
+}
+
+func (this *WriteOptionsFixture) TestReaderSendsCustomerKey() {
+	client := &FakeHTTPGetClient{response: &http.Response{StatusCode: 404, Body: newHTTPBody("")}}
+	address := urlParsed("https://bucket.s3-us-west-1.amazonaws.com/")
+	reader := NewReader(address, "access", "secret", client).
+		WithWriteOptions(persist.WriteOptions{CustomerKey: []byte("0123456789abcdef0123456789abcdef")})
+
+	_ = reader.Read(&Document{})
+
+	this.So(client.request.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key"), should.NotBeBlank)
+	this.So(client.request.Header.Get("Authorization"), should.ContainSubstring, "x-amz-server-side-encryption-customer-key")
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type DocumentWithWriteOptions struct{ DocumentForWriting }
+
+func (this *DocumentWithWriteOptions) WriteOptions(defaults persist.WriteOptions) persist.WriteOptions {
+	defaults.StorageClass = "GLACIER"
+	return defaults
+}
+func (this *DocumentWithWriteOptions) Lapse(time.Time) projector.Document { return this }
@@ -0,0 +1,175 @@
+package s3persist
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/s3"
+)
+
+// writeMultipart uploads the body in parts, each with its own Content-MD5, such that no
+// more than a single part is held in memory at a time. The parts are PUT requests and
+// are therefore retried by the PutRetryClient like any other document write.
+func (this *Writer) writeMultipart(
+	credentials Credentials, path string, body *persist.Spool, options persist.WriteOptions,
+) (interface{}, error) {
+	uploadID, err := this.initiateMultipart(credentials, path, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []completedPart
+	for offset, number := int64(0), 1; offset < body.Size(); offset, number = offset+this.partSize, number+1 {
+		raw, _ := ioutil.ReadAll(body.Section(offset, this.partSize))
+		etag, err := this.uploadPart(credentials, path, uploadID, number, raw, options)
+		if err != nil {
+			this.abortMultipart(credentials, path, uploadID)
+			return nil, err
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+	}
+
+	etag, err := this.completeMultipart(credentials, path, uploadID, parts)
+	if err != nil {
+		this.abortMultipart(credentials, path, uploadID)
+		return nil, err
+	}
+
+	return etag, nil
+}
+
+func (this *Writer) initiateMultipart(credentials Credentials, path string, options persist.WriteOptions) (string, error) {
+	request, err := this.newRequest(credentials, "POST", path, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("Content-Type", firstNonBlank(options.ContentType, "application/json"))
+	request.Header.Set("Content-Encoding", "gzip")
+	appendHeader(request.Header, "X-Amz-Server-Side-Encryption", string(serverSideEncryptionValue(options)))
+	appendWriteHeaders(request.Header, options)
+	newSigner(this.region, credentials).Sign(request)
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err = this.send(request, &result); err != nil {
+		return "", err
+	}
+	return result.UploadID, nil
+}
+func (this *Writer) uploadPart(
+	credentials Credentials, path, uploadID string, number int, raw []byte, options persist.WriteOptions,
+) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+	request, err := this.newRequest(credentials, "PUT", path, query, raw)
+	if err != nil {
+		return "", err
+	}
+
+	checksum := md5.Sum(raw)
+	request.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(checksum[:]))
+	appendCustomerKeyHeaders(request.Header, options.CustomerKey) // SSE-C must accompany every part
+	newSigner(this.region, credentials).Sign(request)
+
+	response, err := this.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("multipart upload of part %d failed: %s", number, response.Status)
+	}
+	return response.Header.Get("ETag"), nil
+}
+func (this *Writer) completeMultipart(credentials Credentials, path, uploadID string, parts []completedPart) (string, error) {
+	raw, _ := xml.Marshal(completeMultipartUpload{Parts: parts})
+	request, err := this.newRequest(credentials, "POST", path, url.Values{"uploadId": {uploadID}}, raw)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/xml")
+	newSigner(this.region, credentials).Sign(request)
+
+	// S3 may report a failure in the body of a 200 OK response to this request.
+	var result struct {
+		XMLName xml.Name
+		ETag    string `xml:"ETag"`
+		Message string `xml:"Message"`
+	}
+	if err = this.send(request, &result); err != nil {
+		return "", err
+	} else if result.XMLName.Local == "Error" {
+		return "", fmt.Errorf("multipart upload could not be completed: %s", result.Message)
+	}
+	return result.ETag, nil
+}
+func (this *Writer) abortMultipart(credentials Credentials, path, uploadID string) {
+	request, err := this.newRequest(credentials, "DELETE", path, url.Values{"uploadId": {uploadID}}, nil)
+	if err != nil {
+		return
+	}
+	newSigner(this.region, credentials).Sign(request)
+
+	if response, err := this.client.Do(request); err == nil {
+		_ = response.Body.Close()
+	} else {
+		log.Printf("[WARN] Unable to abort multipart upload of [%s]: %s", path, err)
+	}
+}
+
+// newRequest builds a request for a method or query string which the s3 package doesn't support
+// by starting from one that it does; the caller adds any remaining headers and signs the request.
+func (this *Writer) newRequest(credentials Credentials, method, path string, query url.Values, body []byte) (*http.Request, error) {
+	request, err := s3.NewRequest(s3.HEAD, credentials.option(), this.storage, s3.Key(path))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Method = method
+	request.URL.RawQuery = query.Encode()
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	request.GetBody = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(body)), nil }
+	request.ContentLength = int64(len(body))
+	request.Header.Del("Content-Type")
+	request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	request.Header.Set("X-Amz-Content-Sha256", hashSHA256(string(body)))
+	return request, nil
+}
+func (this *Writer) send(request *http.Request, result interface{}) error {
+	response, err := this.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("multipart upload request failed: %s %s", response.Status, readResponse(response))
+	}
+	return xml.NewDecoder(response.Body).Decode(result)
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+const (
+	defaultMultipartThreshold = 1024 * 1024 * 16
+	defaultPartSize           = 1024 * 1024 * 8
+)
@@ -0,0 +1,136 @@
+package s3persist
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+)
+
+func TestMultipartFixture(t *testing.T) {
+	gunit.Run(new(MultipartFixture), t)
+}
+
+type MultipartFixture struct {
+	*gunit.Fixture
+	client   *FakeHTTPClientForMultipart
+	writer   *Writer
+	document *LargeDocument
+}
+
+func (this *MultipartFixture) Setup() {
+	this.client = &FakeHTTPClientForMultipart{}
+	address := urlParsed("https://bucket.s3-us-west-1.amazonaws.com/")
+	this.writer = NewWriter(address, "access", "secret", this.client).WithMultipart(1024, 512)
+	this.document = newLargeDocument(4096)
+}
+
+func (this *MultipartFixture) TestLargeDocumentUploadedInParts() {
+	err := this.writer.Write(this.document)
+
+	this.So(err, should.BeNil)
+	this.So(this.document.version, should.Equal, `"multipart-etag"`)
+	this.So(this.client.requests[0], should.Equal, "POST uploads=")
+	this.So(this.client.requests[len(this.client.requests)-1], should.Equal, "POST uploadId=upload-id")
+	this.So(len(this.client.parts), should.BeGreaterThan, 2)
+	this.So(this.client.complete, should.ContainSubstring, "<Part><PartNumber>1</PartNumber><ETag>part-1</ETag></Part>")
+	this.So(this.decode(bytes.Join(this.client.parts, nil)), should.Equal, this.document.Payload)
+}
+
+func (this *MultipartFixture) TestEveryPartCarriesItsChecksum() {
+	_ = this.writer.Write(this.document)
+
+	for i, part := range this.client.parts {
+		sum := md5.Sum(part)
+		this.So(this.client.checksums[i], should.Equal, base64.StdEncoding.EncodeToString(sum[:]))
+		this.So(len(part), should.BeLessThanOrEqualTo, 512)
+	}
+}
+
+func (this *MultipartFixture) TestFailedPartAbortsUpload() {
+	this.client.failPart = 2
+
+	err := this.writer.Write(this.document)
+
+	this.So(err, should.NotBeNil)
+	this.So(this.client.requests[len(this.client.requests)-1], should.Equal, "DELETE uploadId=upload-id")
+}
+
+func (this *MultipartFixture) TestSmallDocumentUsesSinglePut() {
+	_ = this.writer.Write(newLargeDocument(8))
+
+	this.So(this.client.requests, should.Resemble, []string{"PUT "})
+}
+
+func (this *MultipartFixture) decode(raw []byte) string {
+	reader, _ := gzip.NewReader(bytes.NewReader(raw))
+	document := &LargeDocument{}
+	_ = json.NewDecoder(reader).Decode(document)
+	return document.Payload
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeHTTPClientForMultipart struct {
+	requests  []string
+	parts     [][]byte
+	checksums []string
+	complete  string
+	failPart  int
+}
+
+func (this *FakeHTTPClientForMultipart) Do(request *http.Request) (*http.Response, error) {
+	this.requests = append(this.requests, request.Method+" "+request.URL.RawQuery)
+	body, _ := ioutil.ReadAll(request.Body)
+	response := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: newFakeBody("")}
+
+	switch {
+	case request.Method == "POST" && request.URL.RawQuery == "uploads=":
+		response.Body = newFakeBody("<InitiateMultipartUploadResult><UploadId>upload-id</UploadId></InitiateMultipartUploadResult>")
+	case request.Method == "PUT" && strings.Contains(request.URL.RawQuery, "partNumber"):
+		number := len(this.parts) + 1
+		if number == this.failPart {
+			response.StatusCode = http.StatusInternalServerError
+			return response, nil
+		}
+		this.parts = append(this.parts, body)
+		this.checksums = append(this.checksums, request.Header.Get("Content-MD5"))
+		response.Header.Set("ETag", fmt.Sprintf("part-%d", number))
+	case request.Method == "POST":
+		this.complete = string(body)
+		response.Body = newFakeBody(`<CompleteMultipartUploadResult><ETag>"multipart-etag"</ETag></CompleteMultipartUploadResult>`)
+	}
+
+	return response, nil
+}
+
+type LargeDocument struct {
+	Payload string
+	version interface{}
+}
+
+func newLargeDocument(length int) *LargeDocument {
+	random := rand.New(rand.NewSource(42))
+	raw := make([]byte, length)
+	_, _ = random.Read(raw)
+	return &LargeDocument{Payload: base64.StdEncoding.EncodeToString(raw)}
+}
+
+func (this *LargeDocument) Lapse(time.Time) projector.Document { return this }
+func (this *LargeDocument) Apply(interface{}) bool             { return false }
+func (this *LargeDocument) Path() string                       { return "/large.json" }
+func (this *LargeDocument) Reset()                             {}
+func (this *LargeDocument) SetVersion(value interface{})       { this.version = value }
+func (this *LargeDocument) Version() interface{}               { return this.version }
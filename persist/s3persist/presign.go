@@ -0,0 +1,58 @@
+package s3persist
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/s3"
+)
+
+// SignURL gives back a presigned URL through which the document at the path may be read
+// directly from S3 until it expires. Unless the storage address names an alternate endpoint,
+// the URL addresses the bucket as a virtual host of the regional endpoint, as AWS recommends
+// for presigned URLs, or by path when the bucket name has a dot (which the certificate of
+// the virtual host wouldn't match).
+// Documents encrypted with a customer-supplied key (SSE-C) cannot be read through it without
+// the key being sent as headers, which browsers won't do.
+func (this *Reader) SignURL(documentPath string, options persist.SignedURLOptions) (string, error) {
+	if options.Expires < time.Second || options.Expires > maxPresignedExpiry {
+		return "", persist.ErrInvalidExpiry
+	}
+
+	credentials, err := this.credentials.Credentials()
+	if err != nil {
+		return "", fmt.Errorf("Could not obtain credentials: '%s'", err.Error())
+	}
+
+	target := this.objectURL(documentPath)
+	target.RawQuery = options.ResponseOverrides().Encode()
+	newSigner(this.region, credentials).Presign(target, this.now(), options.Expires)
+	return target.String(), nil
+}
+func (this *Reader) objectURL(documentPath string) *url.URL {
+	endpoint, region, bucket, prefix := s3.EndpointRegionBucketKey(this.address)
+	key := s3.TrimKey(path.Join(prefix, documentPath))
+
+	if len(endpoint) > 0 {
+		target, _ := url.Parse(endpoint)
+		target.Path = path.Join("/", bucket, key)
+		return target
+	}
+
+	host := "s3.amazonaws.com"
+	if len(region) > 0 && region != "us-east-1" {
+		host = "s3." + region + ".amazonaws.com"
+	}
+	if strings.Contains(bucket, ".") {
+		return &url.URL{Scheme: "https", Host: host, Path: "/" + bucket + "/" + key}
+	}
+	return &url.URL{Scheme: "https", Host: bucket + "." + host, Path: "/" + key}
+}
+
+var _ persist.URLSigner = new(ReadWriter)
+
+const maxPresignedExpiry = time.Hour * 24 * 7
@@ -34,7 +34,7 @@ func (this *PutRetryClient) Do(request *http.Request) (*http.Response, error) {
 	for current := 0; current <= this.retries; current++ {
 		response, err := this.inner.Do(request)
 
-		if err == nil && response.StatusCode == http.StatusOK {
+		if err == nil && isSuccessfulPut(response.StatusCode) {
 			return response, nil
 		} else if err != nil && response == nil && current > logAfterAttempts {
 			log.Println("[WARN] Unexpected response from target storage:", err)
@@ -46,12 +46,28 @@ func (this *PutRetryClient) Do(request *http.Request) (*http.Response, error) {
 			log.Printf("[WARN] Target host rejected request ('%s'):\n%s\n", request.URL.Path, readResponse(response))
 		}
 
+		discard(response)
 		this.sleeper(sleepTime)
 	}
 
 	return nil, errors.New("Max retries exceeded. Unable to connect.")
 }
 
+// isSuccessfulPut includes the responses to the chunks of a GCS resumable upload,
+// where "308 Resume Incomplete" acknowledges each chunk but the last.
+func isSuccessfulPut(statusCode int) bool {
+	return statusCode == http.StatusOK || statusCode == http.StatusCreated || statusCode == http.StatusPermanentRedirect
+}
+
+// discard drains and closes the body of a response which isn't returned so that its connection
+// can be reused rather than being held (e.g. against the limit of connections per host).
+func discard(response *http.Response) {
+	if response != nil && response.Body != nil {
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		_ = response.Body.Close()
+	}
+}
+
 func readResponse(response *http.Response) string {
 	responseDump, _ := httputil.DumpResponse(response, true)
 	return string(responseDump) + "\n-------------------------------------------"
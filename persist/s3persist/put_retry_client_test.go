@@ -88,6 +88,21 @@ func (this *PutRetryClientFixture) TestClientRetriesBadStatus_ThenSucceeds() {
 
 // //////////////////////////////////////////////////////////////////
 
+func (this *PutRetryClientFixture) TestBodiesOfRejectedAttemptsClosed() {
+	request := buildRequestFromPath("/throttled")
+
+	this.response, this.err = this.retryClient.Do(request)
+
+	this.assertResponseAndNoError()
+	this.So(this.fakeClient.rejected, should.HaveLength, maxAttempts-1)
+	for _, body := range this.fakeClient.rejected {
+		this.So(body.closed, should.BeTrue)
+		this.So(body.Len(), should.Equal, 0) // drained
+	}
+}
+
+// //////////////////////////////////////////////////////////////////
+
 func buildRequestFromPath(path string) *http.Request {
 	request, _ := http.NewRequest("PUT", path, nil)
 	request.Body = newNopCloser([]byte(bodyPayload))
@@ -122,8 +137,9 @@ const bodyPayload = "Hello, World!"
 // //////////////////////////////////////////////////////////////////
 
 type FakeHTTPClientForPutRetry struct {
-	calls  int
-	bodies [][]byte
+	calls    int
+	bodies   [][]byte
+	rejected []*ClosingReader
 
 	putRetryNotFoundResponse *http.Response
 }
@@ -146,6 +162,10 @@ func (this *FakeHTTPClientForPutRetry) Do(request *http.Request) (*http.Response
 		return nil, errors.New("GOPHERS!")
 	} else if request.URL.Path == "/bad-status" && this.calls < maxAttempts {
 		return this.putRetryNotFoundResponse, nil
+	} else if request.URL.Path == "/throttled" && this.calls < maxAttempts {
+		body := &ClosingReader{Reader: strings.NewReader("SlowDown")}
+		this.rejected = append(this.rejected, body)
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: body}, nil
 	} else {
 		return &http.Response{StatusCode: 200}, nil
 	}
@@ -1,13 +1,16 @@
 package s3persist
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/smartystreets/projector"
 	"github.com/smartystreets/projector/persist"
@@ -16,24 +19,60 @@ import (
 
 type Reader struct {
 	storage     s3.Option
-	credentials s3.Option
+	address     *url.URL
+	region      string
+	credentials CredentialProvider
 	client      persist.HTTPClient
+	options     persist.WriteOptions
+	now         func() time.Time
 }
 
 func NewReader(storageAddress *url.URL, accessKey, secretKey string, client persist.HTTPClient) *Reader {
+	_, region, _, _ := s3.EndpointRegionBucketKey(storageAddress)
 	return &Reader{
 		storage:     s3.StorageAddress(storageAddress),
-		credentials: s3.Credentials(accessKey, secretKey),
+		address:     storageAddress,
+		region:      region,
+		credentials: NewStaticCredentials(accessKey, secretKey),
 		client:      client,
+		now:         time.Now,
 	}
 }
 
+func (this *Reader) WithCredentials(provider CredentialProvider) *Reader {
+	this.credentials = provider
+	return this
+}
+
+// WithWriteOptions provides the customer-supplied encryption key (SSE-C), if any,
+// with which the documents were written.
+func (this *Reader) WithWriteOptions(options persist.WriteOptions) *Reader {
+	this.options = options
+	return this
+}
+
 func (this *Reader) Read(document projector.Document) error {
-	request, err := s3.NewRequest(s3.GET, this.credentials, this.storage, s3.Key(document.Path()))
+	credentials, err := this.credentials.Credentials()
+	if err != nil {
+		return fmt.Errorf("Could not obtain credentials: '%s'", err.Error())
+	}
+
+	request, err := s3.NewRequest(s3.GET, credentials.option(), this.storage, s3.Key(document.Path()))
 	if err != nil {
 		return fmt.Errorf("Could not create signed request: '%s'", err.Error())
 	}
 
+	if options := persist.ResolveWriteOptions(this.options, document); appendCustomerKeyHeaders(request.Header, options.CustomerKey) {
+		newSigner(this.region, credentials).Sign(request)
+	}
+
+	// asking for gzip explicitly keeps the transport from transparently decompressing
+	// the body, which would leave nothing against which to verify the stored checksums.
+	request.Header.Set("Accept-Encoding", "gzip")
+	if version, ok := persist.ConditionalVersion(document); ok {
+		request.Header.Set("If-None-Match", version)
+	}
+
 	response, err := this.client.Do(request)
 	if err != nil {
 		return fmt.Errorf("HTTP Client Error: '%s'", err.Error())
@@ -44,20 +83,54 @@ func (this *Reader) Read(document projector.Document) error {
 	if response.StatusCode == http.StatusNotFound {
 		log.Printf("[INFO] Document not found at '%s'\n", document.Path())
 		return nil
+	} else if response.StatusCode == http.StatusNotModified {
+		return persist.ErrNotModified
 	}
 
-	reader := response.Body.(io.Reader)
-	if response.Header.Get("Content-Encoding") == "gzip" {
-		reader, _ = gzip.NewReader(reader)
+	verifier := persist.NewVerifier(document.Path(), response.Body, expectedChecksums(response))
+	encoded, decodeErr := this.decode(document, verifier, response.Header)
+	if err := verifier.Verify(); err != nil {
+		document.Reset() // the integrity error explains any decode error
+		return err
+	} else if decodeErr != nil {
+		return decodeErr
+	}
+
+	document.SetVersion(response.Header.Get("ETag"))
+	if described, ok := document.(persist.MetadataDocument); ok {
+		described.SetMetadata(response.Header)
+	}
+	if keeper, ok := document.(persist.EncodedDocument); ok && len(encoded) > 0 {
+		keeper.SetEncoded(response.Header.Get("Content-Encoding"), encoded)
+	}
+
+	return nil
+}
+
+// decode reads the document, decompressing it if stored with gzip; the compressed body is
+// returned as stored for documents which keep it (see persist.EncodedDocument).
+func (this *Reader) decode(document projector.Document, reader io.Reader, headers http.Header) (encoded []byte, err error) {
+	if headers.Get("Content-Encoding") == "gzip" {
+		if _, keeps := document.(persist.EncodedDocument); keeps {
+			if encoded, err = ioutil.ReadAll(reader); err != nil {
+				return nil, fmt.Errorf("Document read error: '%s'", err.Error())
+			}
+			reader = bytes.NewReader(encoded)
+		}
+
+		decompressor, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("Document read error: '%s'", err.Error())
+		}
+		reader = decompressor
 	}
 
 	decoder := json.NewDecoder(reader)
 	if err := decoder.Decode(document); err != nil {
-		return fmt.Errorf("Document read error: '%s'", err.Error())
+		return nil, fmt.Errorf("Document read error: '%s'", err.Error())
 	}
 
-	document.SetVersion(response.Header.Get("ETag"))
-	return nil
+	return encoded, nil
 }
 
 func (this *Reader) ReadPanic(document projector.Document) {
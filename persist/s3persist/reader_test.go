@@ -3,6 +3,10 @@ package s3persist
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -15,6 +19,7 @@ import (
 	"github.com/smartystreets/assertions/should"
 	"github.com/smartystreets/gunit"
 	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
 )
 
 func TestReaderFixture(t *testing.T) {
@@ -89,6 +94,81 @@ func (this *ReaderFixture) TestValidCompressedResponse_PopulatesDocument() {
 	this.read()
 	this.So(this.document.ID, should.Equal, 1234)
 }
+func (this *ReaderFixture) TestCompressedBodyKeptAsStored() {
+	stored := bytes.NewBuffer(nil)
+	writer := gzip.NewWriter(stored)
+	_, _ = io.WriteString(writer, `{"ID": 1234}`)
+	_ = writer.Close()
+	this.client.response = newChecksumResponse(stored.String(), "ETag", hexMD5(stored.String()))
+	this.client.response.Header.Set("Content-Encoding", "gzip")
+	document := &EncodedDocument{}
+
+	err := this.reader.Read(document)
+
+	this.So(err, should.BeNil)
+	this.So(document.ID, should.Equal, 1234)
+	this.So(document.encoding, should.Equal, "gzip")
+	this.So(document.encoded, should.Resemble, stored.Bytes())
+}
+func (this *ReaderFixture) TestMatchingETagAccepted() {
+	this.client.response = newChecksumResponse(`{"ID": 1234}`, "ETag", hexMD5(`{"ID": 1234}`))
+
+	err := this.reader.Read(this.document)
+
+	this.So(err, should.BeNil)
+	this.So(this.document.ID, should.Equal, 1234)
+	this.So(this.client.request.Header.Get("Accept-Encoding"), should.Equal, "gzip")
+}
+func (this *ReaderFixture) TestETagMismatchReportsIntegrityError() {
+	this.client.response = newChecksumResponse(`{"ID": 1234}`, "ETag", hexMD5(`{"ID": 4321}`))
+
+	err := this.reader.Read(this.document)
+
+	this.So(errors.Is(err, persist.ErrIntegrity), should.BeTrue)
+}
+func (this *ReaderFixture) TestTruncatedBodyReportsIntegrityRatherThanDecodeError() {
+	this.client.response = newChecksumResponse(`{"ID": 12`, "ETag", hexMD5(`{"ID": 1234}`))
+
+	err := this.reader.Read(this.document)
+
+	this.So(errors.Is(err, persist.ErrIntegrity), should.BeTrue)
+}
+func (this *ReaderFixture) TestMultipartETagNotVerified() {
+	this.client.response = newChecksumResponse(`{"ID": 1234}`, "ETag", `"`+strings.Repeat("0", 32)+`-3"`)
+
+	err := this.reader.Read(this.document)
+
+	this.So(err, should.BeNil)
+	this.So(this.document.ID, should.Equal, 1234)
+}
+func (this *ReaderFixture) TestKMSEncryptedETagNotVerified() {
+	this.client.response = newChecksumResponse(`{"ID": 1234}`, "ETag", hexMD5("other"))
+	this.client.response.Header.Set("X-Amz-Server-Side-Encryption", "aws:kms")
+
+	this.So(this.reader.Read(this.document), should.BeNil)
+}
+func (this *ReaderFixture) TestMetadataChecksumVerified() {
+	sum := sha256.Sum256([]byte(`{"ID": 4321}`))
+	this.client.response = newChecksumResponse(`{"ID": 1234}`,
+		"X-Amz-Meta-"+persist.ChecksumMetadataKey, base64.StdEncoding.EncodeToString(sum[:]))
+
+	err := this.reader.Read(this.document)
+
+	this.So(errors.Is(err, persist.ErrIntegrity), should.BeTrue)
+}
+
+func (this *ReaderFixture) TestConditionalDocumentNotModified() {
+	this.client.response = &http.Response{StatusCode: 304, Body: newHTTPBody("")}
+	document := &ConditionalDocument{}
+
+	err := this.reader.Read(document)
+
+	this.So(err, should.Equal, persist.ErrNotModified)
+	this.So(this.client.request.Header.Get("If-None-Match"), should.Equal, "etag")
+	_ = this.reader.Read(this.document) // unconditional
+	this.So(this.client.request.Header.Get("If-None-Match"), should.BeEmpty)
+}
+
 func (this *ReaderFixture) read() {
 	this.reader.ReadPanic(this.document)
 }
@@ -121,6 +201,20 @@ func (this *Document) Reset()                                        {}
 func (this *Document) SetVersion(interface{})                        {}
 func (this *Document) Version() interface{}                          { return "etag" }
 
+type ConditionalDocument struct{ Document }
+
+func (this *ConditionalDocument) ReadIfModified() bool { return true }
+
+type EncodedDocument struct {
+	Document
+	encoding string
+	encoded  []byte
+}
+
+func (this *EncodedDocument) SetEncoded(encoding string, body []byte) {
+	this.encoding, this.encoded = encoding, body
+}
+
 // //////////////////////////////////////////////////////////////////////////////////////////
 
 func newHTTPBody(message string) io.ReadCloser {
@@ -148,6 +242,15 @@ func (this *FakeHTTPResponseBody) Close() error {
 	this.closed = true
 	return nil
 }
+func newChecksumResponse(body, header, value string) *http.Response {
+	response := &http.Response{StatusCode: 200, Header: make(http.Header), Body: newHTTPBody(body)}
+	response.Header.Set(header, value)
+	return response
+}
+func hexMD5(body string) string {
+	sum := md5.Sum([]byte(body))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
 func urlParsed(value string) *url.URL {
 	parsed, err := url.Parse(value)
 	if err != nil {
@@ -0,0 +1,145 @@
+package s3persist
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signer calculates AWS Signature Version 4 in the same manner as the s3 package. It exists
+// so that headers which the s3 package has no option for (e.g. x-amz-meta-*) can be added
+// to a request after it has been built, at which point the request must be signed again.
+type signer struct {
+	region      string
+	credentials Credentials
+}
+
+func newSigner(region string, credentials Credentials) *signer {
+	if len(region) == 0 {
+		region = "us-east-1"
+	}
+	return &signer{region: region, credentials: credentials}
+}
+
+func (this *signer) Sign(request *http.Request) {
+	timestamp := request.Header.Get("X-Amz-Date")
+	canonicalHeaders, signedHeaders := this.canonicalHeaders(request.Header)
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		canonicalURI(request.URL.Path),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		request.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signatureAlgorithm, this.credentials.AccessKeyID, this.scope(timestamp), signedHeaders,
+		this.signature(timestamp, canonicalRequest)))
+}
+
+// Presign authenticates a GET of the URL with the signature in the query string rather than
+// in the Authorization header so that the URL may be handed out; only the host is signed.
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html
+func (this *signer) Presign(target *url.URL, now time.Time, expires time.Duration) {
+	timestamp := now.UTC().Format(timestampFormat)
+	query := target.Query()
+	query.Set("X-Amz-Algorithm", signatureAlgorithm)
+	query.Set("X-Amz-Credential", this.credentials.AccessKeyID+"/"+this.scope(timestamp))
+	query.Set("X-Amz-Date", timestamp)
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if len(this.credentials.SessionToken) > 0 {
+		query.Set("X-Amz-Security-Token", this.credentials.SessionToken)
+	}
+
+	canonicalHeaders, signedHeaders := this.canonicalHeaders(http.Header{"Host": {target.Host}})
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		canonicalURI(target.Path),
+		canonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	query.Set("X-Amz-Signature", this.signature(timestamp, canonicalRequest))
+	target.RawQuery = canonicalQuery(query)
+}
+
+func (this *signer) signature(timestamp, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		signatureAlgorithm,
+		timestamp,
+		this.scope(timestamp),
+		hashSHA256(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+this.credentials.SecretAccessKey), timestamp[:8])
+	key = hmacSHA256(key, this.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+func (this *signer) scope(timestamp string) string {
+	return strings.Join([]string{timestamp[:8], this.region, "s3", "aws4_request"}, "/")
+}
+
+func (this *signer) canonicalHeaders(headers http.Header) (canonical, signed string) {
+	var names []string
+	for name := range headers {
+		if name == "Content-Type" || name == "Content-Md5" || name == "Host" || strings.HasPrefix(name, "X-Amz") {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+
+	builder := new(strings.Builder)
+	lowercase := make([]string, 0, len(names))
+	for _, name := range names {
+		var values []string
+		for _, value := range headers[name] {
+			if name == "Host" {
+				value = strings.Split(value, ":")[0] // the port is not signed
+			}
+			values = append(values, strings.Join(strings.Fields(value), " "))
+		}
+		lowercase = append(lowercase, strings.ToLower(name))
+		builder.WriteString(strings.ToLower(name) + ":" + strings.Join(values, ",") + "\n")
+	}
+
+	return builder.String(), strings.Join(lowercase, ";")
+}
+
+func canonicalURI(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = strings.Replace(url.QueryEscape(segment), "+", "%20", -1)
+	}
+	return strings.Join(segments, "/")
+}
+func canonicalQuery(values url.Values) string {
+	return strings.Replace(values.Encode(), "+", "%20", -1)
+}
+func hmacSHA256(key []byte, content string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(content))
+	return mac.Sum(nil)
+}
+func hashSHA256(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+const (
+	signatureAlgorithm = "AWS4-HMAC-SHA256"
+	timestampFormat    = "20060102T150405Z"
+	unsignedPayload    = "UNSIGNED-PAYLOAD"
+)
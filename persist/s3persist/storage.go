@@ -18,4 +18,19 @@ func NewStorage(address *url.URL, accessKey, secretKey string, client persist.HT
 	}
 }
 
+// NewStorageWithCredentials signs requests with whatever credentials the provider
+// supplies at the time, e.g. temporary credentials of an assumed IAM role.
+func NewStorageWithCredentials(address *url.URL, provider CredentialProvider, client persist.HTTPClient) *ReadWriter {
+	return &ReadWriter{
+		Reader: NewReader(address, "", "", client).WithCredentials(provider),
+		Writer: NewWriter(address, "", "", client).WithCredentials(provider),
+	}
+}
+
+func (this *ReadWriter) WithWriteOptions(options persist.WriteOptions) *ReadWriter {
+	this.Reader.WithWriteOptions(options)
+	this.Writer.WithWriteOptions(options)
+	return this
+}
+
 func (this *ReadWriter) Name() string { return "AWS S3" }
@@ -1,9 +1,7 @@
 package s3persist
 
 import (
-	"bytes"
 	"compress/gzip"
-	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -17,23 +15,68 @@ import (
 )
 
 type Writer struct {
-	credentials s3.Option
+	credentials CredentialProvider
 	storage     s3.Option
+	region      string
 	client      persist.HTTPClient
+	options     persist.WriteOptions
+
+	multipartThreshold int64
+	partSize           int64
 }
 
 func NewWriter(storage *url.URL, accessKey, secretKey string, client persist.HTTPClient) *Writer {
+	_, region, _, _ := s3.EndpointRegionBucketKey(storage)
 	return &Writer{
-		credentials: s3.Credentials(accessKey, secretKey),
+		credentials: NewStaticCredentials(accessKey, secretKey),
 		storage:     s3.StorageAddress(storage),
+		region:      region,
 		client:      client,
+
+		multipartThreshold: defaultMultipartThreshold,
+		partSize:           defaultPartSize,
 	}
 }
 
+func (this *Writer) WithCredentials(provider CredentialProvider) *Writer {
+	this.credentials = provider
+	return this
+}
+
+func (this *Writer) WithWriteOptions(options persist.WriteOptions) *Writer {
+	this.options = options
+	return this
+}
+
+// WithMultipart uploads documents larger than the threshold (after compression) in parts of
+// the size provided. S3 requires every part but the last to be at least 5 MiB.
+func (this *Writer) WithMultipart(threshold, partSize int64) *Writer {
+	this.multipartThreshold = threshold
+	this.partSize = partSize
+	return this
+}
+
 func (this *Writer) Write(document projector.Document) error {
+	credentials, err := this.credentials.Credentials()
+	if err != nil {
+		return fmt.Errorf("Could not obtain credentials: '%s'", err.Error())
+	}
+
 	body := this.serialize(document)
-	checksum := this.md5Checksum(body)
-	request := this.buildRequest(document.Path(), body, checksum)
+	defer func() { _ = body.Close() }()
+
+	options := persist.ResolveWriteOptions(this.options, document).WithChecksum(body.SHA256())
+	if body.Size() > this.multipartThreshold {
+		etag, err := this.writeMultipart(credentials, document.Path(), body, options)
+		if err != nil {
+			return err
+		}
+		document.SetVersion(etag)
+		return nil
+	}
+
+	checksum := base64.StdEncoding.EncodeToString(body.MD5())
+	request := this.buildRequest(credentials, document.Path(), body.Bytes(), checksum, options)
 	response, err := this.client.Do(request)
 
 	if etag, err := this.handleResponse(response, err); err == nil {
@@ -45,39 +88,44 @@ func (this *Writer) Write(document projector.Document) error {
 	return nil
 }
 
-func (this *Writer) serialize(document projector.Document) []byte {
-	buffer := bytes.NewBuffer([]byte{})
-	gzipWriter, _ := gzip.NewWriterLevel(buffer, gzip.BestCompression)
+// serialize streams the document through gzip into a spool which only holds documents
+// at or below the multipart threshold in memory.
+func (this *Writer) serialize(document projector.Document) *persist.Spool {
+	spool := persist.NewSpool(this.multipartThreshold)
+	gzipWriter, _ := gzip.NewWriterLevel(spool, gzip.BestCompression)
 	encoder := json.NewEncoder(gzipWriter)
 
 	if err := encoder.Encode(document); err != nil {
+		_ = spool.Close()
 		log.Panic(err)
 	}
 
 	_ = gzipWriter.Close()
-	return buffer.Bytes()
+	return spool
 }
 
-func (this *Writer) md5Checksum(body []byte) string {
-	sum := md5.Sum(body)
-	return base64.StdEncoding.EncodeToString(sum[:])
-}
-
-func (this *Writer) buildRequest(path string, body []byte, checksum string) *http.Request {
+func (this *Writer) buildRequest(
+	credentials Credentials, path string, body []byte, checksum string, options persist.WriteOptions,
+) *http.Request {
 	request, err := s3.NewRequest(
 		s3.PUT,
-		this.credentials,
+		credentials.option(),
 		this.storage,
 		s3.Key(path),
 		s3.ContentBytes(body),
-		s3.ContentType("application/json"),
+		s3.ContentType(firstNonBlank(options.ContentType, "application/json")),
 		s3.ContentEncoding("gzip"),
 		s3.ContentMD5(checksum),
-		s3.ServerSideEncryption(s3.ServerSideEncryptionAES256),
+		serverSideEncryption(options),
 	)
 	if err != nil {
 		log.Panic(err)
 	}
+
+	if appendWriteHeaders(request.Header, options) {
+		newSigner(this.region, credentials).Sign(request)
+	}
+
 	return request
 }
 
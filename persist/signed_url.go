@@ -0,0 +1,37 @@
+package persist
+
+import (
+	"net/url"
+	"time"
+)
+
+// SignedURLOptions describe how long a signed URL remains valid and the response headers
+// which storage substitutes for those stored with the document when it is read through it.
+// Fields left blank retain the stored values.
+type SignedURLOptions struct {
+	Expires            time.Duration // required; at most 7 days with S3
+	ContentDisposition string        // e.g. `attachment; filename="orders.json"`
+	ContentType        string        // e.g. "application/json"
+}
+
+// signURL signs with the storage engine wrapped by a decorator, which forwards its SignURL so
+// that the engine remains able to sign however it is wrapped.
+func signURL(inner ReadWriter, path string, options SignedURLOptions) (string, error) {
+	if signer, ok := inner.(URLSigner); ok {
+		return signer.SignURL(path, options)
+	}
+	return "", ErrSigningUnsupported
+}
+
+// ResponseOverrides gives back the query string parameters, understood by both S3 and GCS,
+// which override the response headers.
+func (this SignedURLOptions) ResponseOverrides() url.Values {
+	overrides := make(url.Values)
+	if len(this.ContentDisposition) > 0 {
+		overrides.Set("response-content-disposition", this.ContentDisposition)
+	}
+	if len(this.ContentType) > 0 {
+		overrides.Set("response-content-type", this.ContentType)
+	}
+	return overrides
+}
@@ -0,0 +1,126 @@
+package persist
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/smartystreets/projector"
+)
+
+// SkipUnchanged remembers the digest of the canonical (JSON) serialization of the document
+// most recently read or written at each path along with its version. A write whose content
+// and version both match what was remembered is skipped, keeping the version, because storage
+// already holds exactly that content; Apply may report a modification that changed nothing.
+// A write which isn't skipped is given the serialization from which the digest was taken
+// rather than serializing the document once more.
+type SkipUnchanged struct {
+	ReadWriter
+	mutex   sync.Mutex
+	stored  map[string]storedDigest
+	skipped uint64
+}
+
+type storedDigest struct {
+	digest  []byte
+	version string
+}
+
+func NewSkipUnchanged(inner ReadWriter) *SkipUnchanged {
+	return &SkipUnchanged{ReadWriter: inner, stored: map[string]storedDigest{}}
+}
+
+// SkippedWrites is the number of writes skipped because the content was unchanged.
+func (this *SkipUnchanged) SkippedWrites() uint64 { return atomic.LoadUint64(&this.skipped) }
+
+func (this *SkipUnchanged) ReadPanic(document projector.Document) {
+	if err := this.Read(document); err != nil {
+		log.Panic(err)
+	}
+}
+func (this *SkipUnchanged) Read(document projector.Document) error {
+	err := this.ReadWriter.Read(document)
+	if err != nil {
+		this.forget(document.Path())
+	} else {
+		_, current := serialize(document)
+		this.remember(document, current)
+	}
+	return err
+}
+
+func (this *SkipUnchanged) Write(document projector.Document) error {
+	raw, current := serialize(document)
+	if this.unchanged(document, current) {
+		atomic.AddUint64(&this.skipped, 1)
+		return nil
+	}
+
+	var written projector.Document = document
+	if raw != nil {
+		written = &serializedDocument{Document: document, raw: raw}
+	}
+
+	err := this.ReadWriter.Write(written)
+	if err != nil {
+		this.forget(document.Path())
+	} else {
+		this.remember(document, current)
+	}
+	return err
+}
+
+func (this *SkipUnchanged) SignURL(path string, options SignedURLOptions) (string, error) {
+	return signURL(this.ReadWriter, path, options)
+}
+
+func (this *SkipUnchanged) unchanged(document projector.Document, current []byte) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	stored, found := this.stored[document.Path()]
+	return found && current != nil && bytes.Equal(stored.digest, current) && stored.version == fmt.Sprint(document.Version())
+}
+func (this *SkipUnchanged) remember(document projector.Document, current []byte) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if version := document.Version(); current == nil || version == nil || fmt.Sprint(version) == "" {
+		delete(this.stored, document.Path()) // never skip the write of a document not (yet) in storage
+	} else {
+		this.stored[document.Path()] = storedDigest{digest: current, version: fmt.Sprint(version)}
+	}
+}
+func (this *SkipUnchanged) forget(path string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	delete(this.stored, path)
+}
+
+// serialize gives back the serialization of the document and its digest, both nil when the
+// document cannot be serialized, in which case the write is attempted (so that the underlying
+// writer reports the problem).
+func serialize(document projector.Document) (raw, digest []byte) {
+	raw, err := json.Marshal(document)
+	if err != nil {
+		return nil, nil
+	}
+	sum := sha256.Sum256(raw)
+	return raw, sum[:]
+}
+
+// serializedDocument is written in place of the document, serializing as the document did
+// when its digest was taken.
+type serializedDocument struct {
+	projector.Document
+	raw []byte
+}
+
+func (this *serializedDocument) MarshalJSON() ([]byte, error) { return this.raw, nil }
+func (this *serializedDocument) WriteOptions(defaults WriteOptions) WriteOptions {
+	return ResolveWriteOptions(defaults, this.Document)
+}
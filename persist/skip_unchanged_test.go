@@ -0,0 +1,167 @@
+package persist
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+)
+
+func TestSkipUnchangedFixture(t *testing.T) {
+	gunit.Run(new(SkipUnchangedFixture), t)
+}
+
+type SkipUnchangedFixture struct {
+	*gunit.Fixture
+
+	inner   *FakeVersioningStorage
+	storage *SkipUnchanged
+}
+
+func (this *SkipUnchangedFixture) Setup() {
+	this.inner = &FakeVersioningStorage{}
+	this.storage = NewSkipUnchanged(this.inner)
+}
+
+func (this *SkipUnchangedFixture) TestFirstWriteAlwaysSent() {
+	_ = this.storage.Write(&CountingDocument{Count: 1})
+
+	this.So(this.inner.writes, should.Equal, 1)
+	this.So(this.storage.SkippedWrites(), should.Equal, 0)
+}
+func (this *SkipUnchangedFixture) TestIdenticalContentSkippedAndVersionKept() {
+	document := &CountingDocument{Count: 1}
+	_ = this.storage.Write(document)
+
+	err := this.storage.Write(document)
+
+	this.So(err, should.BeNil)
+	this.So(this.inner.writes, should.Equal, 1)
+	this.So(document.version, should.Equal, "1")
+	this.So(this.storage.SkippedWrites(), should.Equal, 1)
+}
+func (this *SkipUnchangedFixture) TestChangedContentWritten() {
+	document := &CountingDocument{Count: 1}
+	_ = this.storage.Write(document)
+	document.Count++
+
+	_ = this.storage.Write(document)
+
+	this.So(this.inner.writes, should.Equal, 2)
+	this.So(document.version, should.Equal, "2")
+}
+func (this *SkipUnchangedFixture) TestContentUnchangedSinceReadSkipped() {
+	this.inner.stored = 7
+	this.inner.version = "3"
+	document := &CountingDocument{}
+	_ = this.storage.Read(document)
+
+	_ = this.storage.Write(document)
+
+	this.So(this.inner.writes, should.Equal, 0)
+	this.So(this.storage.SkippedWrites(), should.Equal, 1)
+}
+func (this *SkipUnchangedFixture) TestDifferentVersionWritten() {
+	document := &CountingDocument{Count: 1}
+	_ = this.storage.Write(document)
+	document.version = "stale"
+
+	_ = this.storage.Write(document)
+
+	this.So(this.inner.writes, should.Equal, 2)
+}
+func (this *SkipUnchangedFixture) TestVersionsNeedNotBeComparable() {
+	document := &CountingDocument{Count: 1}
+	_ = this.storage.Write(document)
+	document.version = []string{"1"}
+
+	this.So(func() { _ = this.storage.Write(document) }, should.NotPanic)
+	this.So(this.inner.writes, should.Equal, 2)
+}
+func (this *SkipUnchangedFixture) TestWrittenAsSerializedForDigest() {
+	document := &CountingDocument{Count: 1}
+
+	_ = this.storage.Write(document)
+
+	this.So(document.marshals, should.Equal, 1)
+	this.So(this.inner.stored, should.Equal, 1)
+}
+func (this *SkipUnchangedFixture) TestFailedWriteForgotten() {
+	document := &CountingDocument{Count: 1}
+	_ = this.storage.Write(document)
+	this.inner.err = ErrConcurrentWrite
+	document.Count++
+	_ = this.storage.Write(document)
+	document.Count--
+	this.inner.err = nil
+
+	_ = this.storage.Write(document)
+
+	this.So(this.inner.writes, should.Equal, 3)
+}
+func (this *SkipUnchangedFixture) TestFailedReadForgotten() {
+	document := &CountingDocument{Count: 1}
+	_ = this.storage.Write(document)
+	this.inner.err = errors.New("read failure")
+	_ = this.storage.Read(&CountingDocument{})
+	this.inner.err = nil
+
+	_ = this.storage.Write(document)
+
+	this.So(this.inner.writes, should.Equal, 2)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeVersioningStorage struct {
+	writes  int
+	stored  int
+	version string
+	err     error
+}
+
+func (this *FakeVersioningStorage) Read(document projector.Document) error {
+	if this.err != nil {
+		return this.err
+	}
+	document.(*CountingDocument).Count = this.stored
+	document.SetVersion(this.version)
+	return nil
+}
+func (this *FakeVersioningStorage) ReadPanic(projector.Document) {}
+func (this *FakeVersioningStorage) Write(document projector.Document) error {
+	this.writes++
+	if this.err != nil {
+		return this.err
+	}
+	var written CountingDocument
+	raw, _ := json.Marshal(document)
+	_ = json.Unmarshal(raw, &written)
+	this.stored = written.Count
+	document.SetVersion(string(rune('0' + this.writes)))
+	return nil
+}
+func (this *FakeVersioningStorage) Name() string { return "Fake" }
+
+type CountingDocument struct {
+	Count    int
+	version  interface{}
+	marshals int
+}
+
+func (this *CountingDocument) MarshalJSON() ([]byte, error) {
+	this.marshals++
+	type plain CountingDocument
+	return json.Marshal((*plain)(this))
+}
+
+func (this *CountingDocument) Lapse(time.Time) projector.Document { return this }
+func (this *CountingDocument) Apply(interface{}) bool             { return true }
+func (this *CountingDocument) Path() string                       { return "/counting.json" }
+func (this *CountingDocument) Reset()                             { this.Count = 0 }
+func (this *CountingDocument) SetVersion(value interface{})       { this.version = value }
+func (this *CountingDocument) Version() interface{}               { return this.version }
@@ -0,0 +1,93 @@
+package persist
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Spool accumulates a serialized document in memory until it grows beyond a limit,
+// after which the contents are spilled to a temporary file. This bounds the memory
+// required to write large documents while still allowing the contents to be read
+// (and re-read, for retries) in sections once the document has been serialized.
+type Spool struct {
+	limit    int64
+	size     int64
+	checksum hash.Hash
+	digest   hash.Hash
+	buffer   *bytes.Buffer
+	file     *os.File
+}
+
+func NewSpool(limit int64) *Spool {
+	return &Spool{limit: limit, checksum: md5.New(), digest: sha256.New(), buffer: bytes.NewBuffer(nil)}
+}
+
+func (this *Spool) Write(raw []byte) (int, error) {
+	if this.file == nil && int64(this.buffer.Len()+len(raw)) > this.limit {
+		if err := this.spill(); err != nil {
+			return 0, err
+		}
+	}
+
+	var written int
+	var err error
+	if this.file != nil {
+		written, err = this.file.Write(raw)
+	} else {
+		written, err = this.buffer.Write(raw)
+	}
+
+	this.size += int64(written)
+	_, _ = this.checksum.Write(raw[:written])
+	_, _ = this.digest.Write(raw[:written])
+	return written, err
+}
+func (this *Spool) spill() (err error) {
+	if this.file, err = ioutil.TempFile("", "projector-spool-"); err != nil {
+		return err
+	}
+
+	_, err = this.file.Write(this.buffer.Bytes())
+	this.buffer = bytes.NewBuffer(nil)
+	return err
+}
+
+// Size is the number of bytes written.
+func (this *Spool) Size() int64 { return this.size }
+
+// MD5 is the checksum of every byte written.
+func (this *Spool) MD5() []byte { return this.checksum.Sum(nil) }
+
+// SHA256 is the digest of every byte written.
+func (this *Spool) SHA256() []byte { return this.digest.Sum(nil) }
+
+// Bytes returns the contents when they are held in memory, otherwise nil.
+func (this *Spool) Bytes() []byte {
+	if this.file != nil {
+		return nil
+	}
+	return this.buffer.Bytes()
+}
+
+// Section provides a reader of length bytes of the contents beginning at offset.
+func (this *Spool) Section(offset, length int64) *io.SectionReader {
+	if this.file != nil {
+		return io.NewSectionReader(this.file, offset, length)
+	}
+	return io.NewSectionReader(bytes.NewReader(this.buffer.Bytes()), offset, length)
+}
+
+// Close releases the temporary file, if any.
+func (this *Spool) Close() error {
+	if this.file == nil {
+		return nil
+	}
+
+	_ = this.file.Close()
+	return os.Remove(this.file.Name())
+}
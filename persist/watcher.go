@@ -0,0 +1,136 @@
+package persist
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/smartystreets/projector"
+)
+
+// DocumentChange describes a document which has been read with a version other than that
+// previously read (the first read of every document is a change as well).
+type DocumentChange struct {
+	Path     string
+	Version  interface{}
+	Document projector.Document
+}
+
+// Watcher polls the documents watched, once per interval, and sends those which have changed
+// to the Changes channel. Documents are read conditionally (see ConditionalDocument) so that,
+// with storage engines supporting it, an unchanged document isn't transferred again; with
+// others (e.g. GCS) each poll reads the document in full and compares the versions instead.
+type Watcher struct {
+	reader   Reader
+	interval time.Duration
+	jitter   float64
+	random   func() float64
+	watched  []*watchedPath
+	changes  chan DocumentChange
+	closed   chan struct{}
+	once     sync.Once
+}
+
+type watchedPath struct {
+	create  func() projector.Document
+	version string
+}
+
+func NewWatcher(reader Reader, interval time.Duration) *Watcher {
+	return &Watcher{
+		reader:   reader,
+		interval: interval,
+		random:   rand.Float64,
+		changes:  make(chan DocumentChange, 16),
+		closed:   make(chan struct{}),
+	}
+}
+
+// WithJitter varies each interval by up to the fraction provided (e.g. 0.1 for ±10%) so
+// that many watchers started together don't poll storage in lockstep. The fraction must be
+// less than one, which would otherwise allow intervals of no time at all.
+func (this *Watcher) WithJitter(fraction float64) *Watcher {
+	if fraction < 0 || fraction >= 1 {
+		log.Panicf("[ERROR] The jitter of the watcher must be a fraction from zero up to (but not including) one: %v", fraction)
+	}
+	this.jitter = fraction
+	return this
+}
+
+// Watch polls the document at the path of the documents created, each poll reading into a
+// new document so that the documents sent as changes are never modified afterward.
+func (this *Watcher) Watch(create func() projector.Document) *Watcher {
+	this.watched = append(this.watched, &watchedPath{create: create})
+	return this
+}
+
+func (this *Watcher) Changes() <-chan DocumentChange { return this.changes }
+
+// Listen polls until closed, after which the Changes channel is closed.
+func (this *Watcher) Listen() {
+	defer close(this.changes)
+
+	for {
+		for _, watched := range this.watched {
+			if !this.poll(watched) {
+				return
+			}
+		}
+
+		timer := time.NewTimer(this.next())
+		select {
+		case <-timer.C:
+		case <-this.closed:
+			timer.Stop()
+			return
+		}
+	}
+}
+func (this *Watcher) poll(watched *watchedPath) bool {
+	document := watched.create()
+	document.SetVersion(watched.version)
+
+	if err := this.reader.Read(newConditionalDocument(document)); err == ErrNotModified {
+		return true
+	} else if err != nil {
+		log.Printf("[WARN] Unable to read watched document [%s]: %s", document.Path(), err)
+		return true
+	}
+
+	version, _ := document.Version().(string)
+	if len(version) == 0 || version == watched.version {
+		return true // not found or, with storage not supporting conditional reads, unchanged
+	}
+	watched.version = version
+
+	select {
+	case this.changes <- DocumentChange{Path: document.Path(), Version: version, Document: document}:
+		return true
+	case <-this.closed:
+		return false
+	}
+}
+func (this *Watcher) next() time.Duration {
+	if this.jitter <= 0 {
+		return this.interval
+	}
+	variation := (this.random()*2 - 1) * this.jitter
+	return time.Duration(float64(this.interval) * (1 + variation))
+}
+
+func (this *Watcher) Close() {
+	this.once.Do(func() { close(this.closed) })
+}
+
+// conditionalDocument is read only if modified since the version it was given.
+type conditionalDocument struct {
+	*prefixedDocument
+}
+
+func newConditionalDocument(document projector.Document) *conditionalDocument {
+	return &conditionalDocument{prefixedDocument: newPrefixedDocument(document, "")}
+}
+
+func (this *conditionalDocument) Path() string         { return this.Document.Path() } // not cleaned
+func (this *conditionalDocument) ReadIfModified() bool { return true }
@@ -0,0 +1,145 @@
+package persist
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+)
+
+func TestWatcherFixture(t *testing.T) {
+	gunit.Run(new(WatcherFixture), t)
+}
+
+type WatcherFixture struct {
+	*gunit.Fixture
+
+	reader  *FakeWatchedReader
+	watcher *Watcher
+}
+
+func (this *WatcherFixture) Setup() {
+	this.reader = &FakeWatchedReader{}
+	this.watcher = NewWatcher(this.reader, time.Millisecond).
+		Watch(func() projector.Document { return &CountingDocument{} })
+}
+
+func (this *WatcherFixture) TestChangesSentWithNewVersionAndDocument() {
+	this.reader.store(1, "a")
+	go this.watcher.Listen()
+
+	first := <-this.watcher.Changes()
+	this.So(first.Path, should.Equal, "/counting.json")
+	this.So(first.Version, should.Equal, "a")
+	this.So(first.Document.(*CountingDocument).Count, should.Equal, 1)
+
+	for this.reader.unmodified() < 3 {
+		time.Sleep(time.Millisecond) // polling conditionally without changes
+	}
+	this.reader.store(2, "b")
+
+	second := <-this.watcher.Changes()
+	this.So(second.Version, should.Equal, "b")
+	this.So(second.Document.(*CountingDocument).Count, should.Equal, 2)
+	this.So(first.Document.(*CountingDocument).Count, should.Equal, 1)
+
+	this.watcher.Close()
+	for range this.watcher.Changes() {
+	}
+}
+
+func (this *WatcherFixture) TestMissingDocumentNotSent() {
+	go this.watcher.Listen()
+	for this.reader.reads() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	this.watcher.Close()
+
+	_, open := <-this.watcher.Changes()
+	this.So(open, should.BeFalse)
+}
+
+func (this *WatcherFixture) TestJitterVariesInterval() {
+	this.watcher.WithJitter(0.5)
+
+	this.watcher.random = func() float64 { return 0 }
+	this.So(this.watcher.next(), should.Equal, time.Millisecond/2)
+	this.watcher.random = func() float64 { return 1 }
+	this.So(this.watcher.next(), should.Equal, time.Millisecond*3/2)
+}
+
+func (this *WatcherFixture) TestJitterOfOneOrMoreRejected() {
+	this.So(func() { this.watcher.WithJitter(1) }, should.Panic)
+	this.So(func() { this.watcher.WithJitter(-0.1) }, should.Panic)
+	this.So(this.watcher.jitter, should.Equal, 0)
+}
+
+func (this *WatcherFixture) TestPathsReadAsGivenByDocument() {
+	this.reader.store(1, "a")
+	this.watcher = NewWatcher(this.reader, time.Millisecond).
+		Watch(func() projector.Document { return &RelativePathDocument{} })
+	go this.watcher.Listen()
+
+	change := <-this.watcher.Changes()
+	this.watcher.Close()
+	for range this.watcher.Changes() {
+	}
+
+	this.So(change.Path, should.Equal, "counting/./relative.json")
+	this.So(this.reader.paths[0], should.Equal, "counting/./relative.json")
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeWatchedReader struct {
+	mutex       sync.Mutex
+	body        []byte
+	version     string
+	readCount   int
+	unmodifieds int
+	paths       []string
+}
+
+func (this *FakeWatchedReader) store(count int, version string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.body, _ = json.Marshal(CountingDocument{Count: count})
+	this.version = version
+}
+func (this *FakeWatchedReader) reads() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.readCount
+}
+func (this *FakeWatchedReader) unmodified() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.unmodifieds
+}
+
+func (this *FakeWatchedReader) Read(document projector.Document) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.readCount++
+	this.paths = append(this.paths, document.Path())
+
+	if version, ok := ConditionalVersion(document); ok && version == this.version {
+		this.unmodifieds++
+		return ErrNotModified
+	}
+	if len(this.body) > 0 {
+		_ = json.Unmarshal(this.body, document)
+	}
+	document.SetVersion(this.version)
+	return nil
+}
+func (this *FakeWatchedReader) ReadPanic(projector.Document) {}
+
+type RelativePathDocument struct{ CountingDocument }
+
+func (this *RelativePathDocument) Path() string { return "counting/./relative.json" }
@@ -0,0 +1,56 @@
+package persist
+
+import "encoding/base64"
+
+// WriteOptions describe how documents are stored beyond their content: encryption,
+// storage class, caching, access control, and user metadata. Fields left blank retain
+// the storage engine's defaults.
+type WriteOptions struct {
+	ContentType  string            // defaults to "application/json"
+	CacheControl string            // e.g. "max-age=60"
+	StorageClass string            // e.g. "STANDARD_IA" (S3) or "NEARLINE" (GCS)
+	ACL          string            // canned ACL (S3) or predefined ACL (GCS), e.g. "private"
+	Metadata     map[string]string // user metadata, sent as x-amz-meta-* or x-goog-meta-* headers
+
+	// KMSKeyID selects SSE-KMS with the key provided (S3) or the customer-managed
+	// encryption key (CMEK) to use (GCS). S3 otherwise uses SSE-S3 (AES256).
+	KMSKeyID string
+
+	// CustomerKey is a 256-bit key supplied with every request (SSE-C on S3, CSEK on GCS).
+	// Because the storage engine does not keep the key, it is also required to read the document.
+	CustomerKey []byte
+
+	// Checksum embeds the SHA-256 of the stored (compressed) bytes in the user metadata
+	// (see ChecksumMetadataKey) so that readers can verify the content of every object,
+	// including those uploaded in parts, for which the storage engine reports no MD5.
+	Checksum bool
+}
+
+// WithChecksum adds the digest provided to a copy of the metadata when Checksum is set.
+func (this WriteOptions) WithChecksum(digest []byte) WriteOptions {
+	if !this.Checksum {
+		return this
+	}
+
+	metadata := make(map[string]string, len(this.Metadata)+1)
+	for key, value := range this.Metadata {
+		metadata[key] = value
+	}
+	metadata[ChecksumMetadataKey] = base64.StdEncoding.EncodeToString(digest)
+	this.Metadata = metadata
+	return this
+}
+
+// WriteOptionsDocument is implemented by documents which override the WriteOptions
+// configured for the ReadWriter; the configured options are provided as the defaults.
+type WriteOptionsDocument interface {
+	WriteOptions(defaults WriteOptions) WriteOptions
+}
+
+// ResolveWriteOptions applies the overrides of the document, if any, to the defaults provided.
+func ResolveWriteOptions(defaults WriteOptions, document interface{}) WriteOptions {
+	if overrides, ok := document.(WriteOptionsDocument); ok {
+		return overrides.WriteOptions(defaults)
+	}
+	return defaults
+}
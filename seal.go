@@ -0,0 +1,31 @@
+package projector
+
+import "time"
+
+// SealedDocument is implemented by documents which are marked as sealed (complete) once they
+// have been lapsed in favor of the document of the next period; the sealed document is then
+// written one last time, even when no message has changed it since it was last written.
+type SealedDocument interface {
+	Document
+	Seal(now time.Time)
+}
+
+// ArchivedCopyDocument is implemented by documents which, once lapsed (and sealed), are also
+// copied to an archive path. The document itself remains at its own path.
+type ArchivedCopyDocument interface {
+	Document
+	ArchivePath() string
+}
+
+// SealInfo, when embedded in a document, implements Seal by recording the time at which
+// the document was sealed. Documents embedding it should clear it from Reset.
+type SealInfo struct {
+	SealedAt *time.Time `json:",omitempty"`
+}
+
+func (this *SealInfo) Seal(now time.Time) {
+	sealed := now.UTC()
+	this.SealedAt = &sealed
+}
+func (this *SealInfo) Sealed() bool { return this.SealedAt != nil }
+func (this *SealInfo) Reset()       { this.SealedAt = nil }
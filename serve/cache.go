@@ -0,0 +1,112 @@
+package serve
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// entry is a document as served, along with the time at which it was last validated against storage.
+type entry struct {
+	path      string
+	body      []byte
+	gzipped   []byte
+	version   string
+	etag      string
+	validated time.Time
+}
+
+func newEntry(document *document, now time.Time, compress bool) *entry {
+	this := &entry{path: document.Path(), body: document.body, validated: now}
+	if document.Version() != nil {
+		this.version = fmt.Sprint(document.Version())
+	}
+	this.etag = entityTag(this.version)
+	if compress && len(document.gzipped) > 0 {
+		this.gzipped = document.gzipped // served as stored
+	} else if compress {
+		this.gzipped = compressed(this.body)
+	}
+	return this
+}
+func (this *entry) revalidated(now time.Time) *entry {
+	copied := *this // entries are shared by concurrent requests and therefore never modified
+	copied.validated = now
+	return &copied
+}
+
+// entityTag quotes the version, unless it is quoted already (as is an S3 ETag).
+func entityTag(version string) string {
+	if len(version) == 0 || strings.HasPrefix(version, `"`) || strings.HasPrefix(version, `W/"`) {
+		return version
+	}
+	return `"` + version + `"`
+}
+
+func compressed(body []byte) []byte {
+	buffer := bytes.NewBuffer(nil)
+	writer, _ := gzip.NewWriterLevel(buffer, gzip.DefaultCompression)
+	_, _ = writer.Write(body)
+	_ = writer.Close()
+	return buffer.Bytes()
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// cache keeps up to capacity entries, dropping the least recently used first.
+type cache struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	recent   *list.List
+}
+
+func newCache(capacity int) *cache {
+	return &cache{capacity: capacity, entries: map[string]*list.Element{}, recent: list.New()}
+}
+
+func (this *cache) Get(path string) *entry {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	element, found := this.entries[path]
+	if !found {
+		return nil
+	}
+	this.recent.MoveToFront(element)
+	return element.Value.(*entry)
+}
+func (this *cache) Put(cached *entry) {
+	if this.capacity <= 0 {
+		return
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if element, found := this.entries[cached.path]; found {
+		element.Value = cached
+		this.recent.MoveToFront(element)
+		return
+	}
+
+	this.entries[cached.path] = this.recent.PushFront(cached)
+	for this.recent.Len() > this.capacity {
+		oldest := this.recent.Back()
+		this.recent.Remove(oldest)
+		delete(this.entries, oldest.Value.(*entry).path)
+	}
+}
+func (this *cache) Remove(path string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if element, found := this.entries[path]; found {
+		this.recent.Remove(element)
+		delete(this.entries, path)
+	}
+}
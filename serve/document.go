@@ -0,0 +1,49 @@
+package serve
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/smartystreets/projector"
+)
+
+// document holds the raw JSON of whatever happens to be stored at the path.
+type document struct {
+	path        string
+	body        json.RawMessage
+	gzipped     []byte // the body as stored, when stored with gzip
+	version     interface{}
+	conditional bool
+}
+
+func newDocument(path string) *document {
+	return &document{path: path}
+}
+
+func (this *document) Lapse(time.Time) projector.Document { return this }
+func (this *document) Apply(interface{}) bool             { return false }
+func (this *document) Path() string                       { return this.path }
+
+func (this *document) Reset()                       { this.body, this.gzipped, this.version = nil, nil, nil }
+func (this *document) SetVersion(value interface{}) { this.version = value }
+func (this *document) Version() interface{}         { return this.version }
+func (this *document) ReadIfModified() bool         { return this.conditional }
+
+func (this *document) Exists() bool { return len(this.body) > 0 }
+
+func (this *document) SetEncoded(encoding string, body []byte) {
+	if encoding == "gzip" {
+		this.gzipped = body
+	}
+}
+
+func (this *document) MarshalJSON() ([]byte, error) {
+	if len(this.body) == 0 {
+		return []byte("null"), nil
+	}
+	return this.body, nil
+}
+func (this *document) UnmarshalJSON(raw []byte) error {
+	this.body = append(this.body[0:0], raw...)
+	return nil
+}
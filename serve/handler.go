@@ -0,0 +1,151 @@
+// Package serve provides a read-only http.Handler serving the documents held by any
+// persist.Reader by their paths, e.g. to front-end services which would otherwise need
+// credentials of their own to read the storage engine directly.
+package serve
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smartystreets/projector/persist"
+)
+
+type Handler struct {
+	reader   persist.Reader
+	cache    *cache
+	maxAge   time.Duration
+	compress bool
+	now      func() time.Time
+}
+
+func NewHandler(reader persist.Reader) *Handler {
+	return &Handler{reader: reader, cache: newCache(0), now: time.Now}
+}
+
+// WithCache keeps up to capacity documents in memory (dropping the least recently served
+// first). A cached document is validated against storage once older than maxAge, which, for
+// storage engines supporting persist.ConditionalDocument, reads it again only if changed.
+func (this *Handler) WithCache(capacity int, maxAge time.Duration) *Handler {
+	this.cache = newCache(capacity)
+	this.maxAge = maxAge
+	return this
+}
+
+// WithGzip serves documents compressed to clients accepting gzip: as stored, when storage
+// keeps them compressed (see persist.EncodedDocument), or compressed as read otherwise.
+func (this *Handler) WithGzip() *Handler {
+	this.compress = true
+	return this
+}
+
+func (this *Handler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		response.Header().Set("Allow", "GET, HEAD")
+		http.Error(response, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	entry, err := this.load(path.Clean("/" + request.URL.Path))
+	if err != nil {
+		log.Printf("[WARN] Unable to read document [%s]: %s", request.URL.Path, err)
+		http.Error(response, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	} else if entry == nil {
+		http.NotFound(response, request)
+		return
+	}
+
+	headers := response.Header()
+	headers.Set("Content-Type", "application/json; charset=utf-8")
+	headers.Set("Cache-Control", "no-cache") // clients revalidate using the ETag
+	if len(entry.etag) > 0 {
+		headers.Set("ETag", entry.etag)
+	}
+	if this.compress {
+		headers.Set("Vary", "Accept-Encoding")
+	}
+
+	if matches(request.Header.Get("If-None-Match"), entry.etag) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body := entry.body
+	if this.compress && acceptsGzip(request.Header.Get("Accept-Encoding")) {
+		headers.Set("Content-Encoding", "gzip")
+		body = entry.gzipped
+	}
+
+	headers.Set("Content-Length", strconv.Itoa(len(body)))
+	response.WriteHeader(http.StatusOK)
+	if request.Method == http.MethodGet {
+		_, _ = response.Write(body)
+	}
+}
+
+// load gives back the document at the path, from the cache while it remains valid, or nil
+// when there is no such document.
+func (this *Handler) load(path string) (*entry, error) {
+	now := this.now()
+	cached := this.cache.Get(path)
+	if cached != nil && now.Sub(cached.validated) < this.maxAge {
+		return cached, nil
+	}
+
+	document := newDocument(path)
+	if cached != nil {
+		document.SetVersion(cached.version)
+		document.conditional = true
+	}
+
+	err := this.reader.Read(document)
+	if err == persist.ErrNotModified {
+		cached = cached.revalidated(now)
+		this.cache.Put(cached)
+		return cached, nil
+	} else if err != nil {
+		return nil, err
+	} else if !document.Exists() {
+		this.cache.Remove(path)
+		return nil, nil
+	}
+
+	if cached != nil && cached.version == fmt.Sprint(document.Version()) {
+		cached = cached.revalidated(now) // read in full by storage not supporting conditional reads
+		this.cache.Put(cached)
+		return cached, nil
+	}
+
+	loaded := newEntry(document, now, this.compress)
+	this.cache.Put(loaded)
+	return loaded, nil
+}
+
+// matches reports whether the If-None-Match header names the entity tag (weakly compared).
+func matches(header, etag string) bool {
+	if len(header) == 0 || len(etag) == 0 {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+func acceptsGzip(header string) bool {
+	for _, coding := range strings.Split(header, ",") {
+		name := strings.TrimSpace(strings.SplitN(coding, ";", 2)[0])
+		if name == "gzip" && !strings.HasSuffix(strings.ReplaceAll(coding, " ", ""), ";q=0") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package serve
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/projector/persist/anypersist"
+	"github.com/smartystreets/projector/persist/mempersist"
+)
+
+func TestHandlerFixture(t *testing.T) {
+	gunit.Run(new(HandlerFixture), t)
+}
+
+type HandlerFixture struct {
+	*gunit.Fixture
+
+	storage *mempersist.ReadWriter
+	reader  *FakeReader
+	handler *Handler
+	now     time.Time
+}
+
+func (this *HandlerFixture) Setup() {
+	this.storage = mempersist.NewReadWriter()
+	this.reader = &FakeReader{inner: this.storage}
+	this.now = time.Now()
+	this.handler = NewHandler(this.reader)
+	this.handler.now = func() time.Time { return this.now }
+	this.store("/orders.json", `{"Orders":1}`)
+}
+
+func (this *HandlerFixture) store(path, body string) {
+	document := newDocument(path)
+	_ = this.storage.Read(document)
+	_ = document.UnmarshalJSON([]byte(body))
+	_ = this.storage.Write(document)
+}
+func (this *HandlerFixture) serve(method, path string, headers ...string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	this.handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (this *HandlerFixture) TestDocumentServedWithEntityTag() {
+	response := this.serve("GET", "/orders.json")
+
+	this.So(response.Code, should.Equal, http.StatusOK)
+	this.So(response.Body.String(), should.Equal, `{"Orders":1}`)
+	this.So(response.Header().Get("ETag"), should.Equal, `"1"`)
+	this.So(response.Header().Get("Content-Type"), should.StartWith, "application/json")
+}
+func (this *HandlerFixture) TestMissingDocumentNotFound() {
+	this.So(this.serve("GET", "/missing.json").Code, should.Equal, http.StatusNotFound)
+}
+func (this *HandlerFixture) TestOnlyReadsAllowed() {
+	response := this.serve("PUT", "/orders.json")
+
+	this.So(response.Code, should.Equal, http.StatusMethodNotAllowed)
+	this.So(response.Header().Get("Allow"), should.Equal, "GET, HEAD")
+}
+func (this *HandlerFixture) TestMatchingEntityTagNotModified() {
+	response := this.serve("GET", "/orders.json", "If-None-Match", `"0", W/"1"`)
+
+	this.So(response.Code, should.Equal, http.StatusNotModified)
+	this.So(response.Body.Len(), should.Equal, 0)
+}
+
+func (this *HandlerFixture) TestGzipServedOnlyWhenAccepted() {
+	this.handler.WithGzip()
+
+	compressed := this.serve("GET", "/orders.json", "Accept-Encoding", "deflate, gzip")
+	plain := this.serve("GET", "/orders.json", "Accept-Encoding", "gzip;q=0")
+
+	this.So(compressed.Header().Get("Content-Encoding"), should.Equal, "gzip")
+	reader, err := gzip.NewReader(compressed.Body)
+	this.So(err, should.BeNil)
+	body, _ := ioutil.ReadAll(reader)
+	this.So(string(body), should.Equal, `{"Orders":1}`)
+	this.So(plain.Header().Get("Content-Encoding"), should.BeEmpty)
+	this.So(plain.Body.String(), should.Equal, `{"Orders":1}`)
+}
+
+func (this *HandlerFixture) TestCachedDocumentValidatedOnceStale() {
+	this.handler.WithCache(10, time.Minute)
+
+	this.serve("GET", "/orders.json")
+	this.serve("GET", "/orders.json")
+	this.So(this.reader.reads, should.Equal, 1)
+
+	this.now = this.now.Add(time.Minute)
+	this.serve("GET", "/orders.json")
+	this.So(this.reader.reads, should.Equal, 2)
+	this.So(this.reader.unmodified, should.Equal, 1)
+
+	this.store("/orders.json", `{"Orders":2}`)
+	this.now = this.now.Add(time.Minute)
+	response := this.serve("GET", "/orders.json")
+	this.So(response.Body.String(), should.Equal, `{"Orders":2}`)
+	this.So(response.Header().Get("ETag"), should.Equal, `"2"`)
+}
+
+func (this *HandlerFixture) TestLeastRecentlyServedDocumentsDropped() {
+	this.handler.WithCache(1, time.Hour)
+	this.store("/other.json", `{}`)
+
+	this.serve("GET", "/orders.json")
+	this.serve("GET", "/other.json")
+	this.serve("GET", "/orders.json")
+
+	this.So(this.reader.reads, should.Equal, 3)
+}
+
+func (this *HandlerFixture) TestCachedDocumentRevalidatedAgainstS3WithRetries() {
+	server := NewFakeS3(`{"Orders":1}`)
+	defer server.Close()
+	address, _ := url.Parse(server.URL + "/bucket")
+	storage, _ := anypersist.New(anypersist.S3(address, "access", "secret"), anypersist.MaxRetries(3)).Build()
+	this.handler = NewHandler(storage).WithCache(10, time.Minute)
+	this.handler.now = func() time.Time { return this.now }
+
+	this.serve("GET", "/orders.json")
+	this.now = this.now.Add(time.Minute)
+	response := this.serve("GET", "/orders.json")
+
+	this.So(response.Code, should.Equal, http.StatusOK)
+	this.So(response.Body.String(), should.Equal, `{"Orders":1}`)
+	this.So(server.requests, should.Equal, 2)
+	this.So(server.unmodified, should.Equal, 1)
+}
+
+func (this *HandlerFixture) TestGzipStoredInS3ServedAsStored() {
+	server := NewFakeS3(`{"Orders":1}`)
+	defer server.Close()
+	server.gzipped = compressedForTest(`{"Orders":1}`)
+	address, _ := url.Parse(server.URL + "/bucket")
+	storage, _ := anypersist.New(anypersist.S3(address, "access", "secret")).Build()
+	this.handler = NewHandler(storage).WithGzip()
+
+	response := this.serve("GET", "/orders.json", "Accept-Encoding", "gzip")
+
+	this.So(response.Code, should.Equal, http.StatusOK)
+	this.So(response.Header().Get("Content-Encoding"), should.Equal, "gzip")
+	this.So(response.Body.Bytes(), should.Resemble, server.gzipped)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// FakeS3 serves a single object, answering conditional reads as S3 does.
+type FakeS3 struct {
+	*httptest.Server
+	body       string
+	gzipped    []byte // the body as stored, if stored with gzip
+	requests   int
+	unmodified int
+}
+
+func NewFakeS3(body string) *FakeS3 {
+	this := &FakeS3{body: body}
+	this.Server = httptest.NewServer(this)
+	return this
+}
+
+func (this *FakeS3) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	this.requests++
+	stored := []byte(this.body)
+	if len(this.gzipped) > 0 {
+		stored = this.gzipped
+		response.Header().Set("Content-Encoding", "gzip")
+	}
+	sum := md5.Sum(stored)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if request.Header.Get("If-None-Match") == etag {
+		this.unmodified++
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.Header().Set("ETag", etag)
+	_, _ = response.Write(stored)
+}
+
+func compressedForTest(body string) []byte {
+	buffer := bytes.NewBuffer(nil)
+	writer := gzip.NewWriter(buffer)
+	writer.Name = "stored.json" // distinguishes the body as stored from one compressed when served
+	_, _ = io.WriteString(writer, body)
+	_ = writer.Close()
+	return buffer.Bytes()
+}
+
+type FakeReader struct {
+	inner      persist.Reader
+	reads      int
+	unmodified int
+}
+
+func (this *FakeReader) Read(document projector.Document) error {
+	this.reads++
+	err := this.inner.Read(document)
+	if err == persist.ErrNotModified {
+		this.unmodified++
+	}
+	return err
+}
+func (this *FakeReader) ReadPanic(document projector.Document) { panic("nop") }
@@ -0,0 +1,125 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/smartystreets/messaging/v2"
+)
+
+// DocumentChanged describes a write of a document which has been committed to storage.
+type DocumentChanged struct {
+	Path       string
+	OldVersion interface{}
+	NewVersion interface{}
+	Timestamp  time.Time
+	Patch      json.RawMessage `json:",omitempty"` // RFC 6902, from the document as last written (or read)
+}
+
+// ChangePublisher receives an event once each write of a document has succeeded. It is
+// called from the goroutines of every document and must therefore be safe for concurrent use.
+type ChangePublisher interface {
+	Publish(DocumentChanged)
+}
+
+// ChannelPublisher sends each event to the channel provided, waiting until it is received.
+type ChannelPublisher struct {
+	output chan<- DocumentChanged
+}
+
+func NewChannelPublisher(output chan<- DocumentChanged) *ChannelPublisher {
+	return &ChannelPublisher{output: output}
+}
+
+func (this *ChannelPublisher) Publish(event DocumentChanged) { this.output <- event }
+
+// WriterPublisher dispatches each event through the messaging writer provided (committing it,
+// when the writer is transactional). As the write of the document has already succeeded, an
+// event which cannot be dispatched is only logged.
+type WriterPublisher struct {
+	mutex       sync.Mutex
+	writer      messaging.Writer
+	destination string
+}
+
+func NewWriterPublisher(writer messaging.Writer, destination string) *WriterPublisher {
+	return &WriterPublisher{writer: writer, destination: destination}
+}
+
+func (this *WriterPublisher) Publish(event DocumentChanged) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	err := this.writer.Write(messaging.Dispatch{
+		Destination: this.destination,
+		MessageType: MessageTypeName(event),
+		Durable:     true,
+		Timestamp:   event.Timestamp,
+		Message:     event,
+	})
+	if transactional, ok := this.writer.(messaging.CommitWriter); ok && err == nil {
+		err = transactional.Commit()
+	}
+	if err != nil {
+		log.Printf("[WARN] Unable to publish change of document [%s]: %s", event.Path, err)
+	}
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// changePublication is shared by the transformers of a handler.
+type changePublication struct {
+	publisher ChangePublisher
+	patches   bool
+	now       func() time.Time
+}
+
+func newChangePublication(publisher ChangePublisher, patches bool) *changePublication {
+	return &changePublication{publisher: publisher, patches: patches, now: time.Now}
+}
+
+// publish sends the event describing the write just committed, along with the patch from the
+// body last written (or read), which is then replaced by the body just written.
+func (this *simpleTransformer) publish(previous interface{}) {
+	if this.publication == nil {
+		return
+	}
+
+	event := DocumentChanged{
+		Path:       this.document.Path(),
+		OldVersion: previous,
+		NewVersion: this.document.Version(),
+		Timestamp:  this.publication.now().UTC(),
+	}
+	if this.publication.patches {
+		body := this.snapshot()
+		event.Patch = diffJSON(this.written, body)
+		this.written = body
+	}
+
+	this.publication.publisher.Publish(event)
+}
+
+// committed reports whether the write stored a new version of the document; a write skipped
+// because the content was unchanged (see persist.SkipUnchanged) keeps the version read.
+func committed(previous, current interface{}) bool {
+	return previous == nil || fmt.Sprint(previous) != fmt.Sprint(current)
+}
+
+// remember keeps the body of the document as read (after a conflicting write) from which to
+// compute the patch of the next write.
+func (this *simpleTransformer) remember() {
+	if this.publication != nil && this.publication.patches {
+		this.written = this.snapshot()
+	}
+}
+func (this *simpleTransformer) snapshot() []byte {
+	body, err := json.Marshal(this.document)
+	if err != nil {
+		log.Panic(err)
+	}
+	return body
+}
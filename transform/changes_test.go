@@ -0,0 +1,142 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/messaging/v2"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/projector/persist/mempersist"
+)
+
+func TestChangesFixture(t *testing.T) {
+	gunit.Run(new(ChangesFixture), t)
+}
+
+type ChangesFixture struct {
+	*gunit.Fixture
+
+	storage  *mempersist.ReadWriter
+	document *TotalDocument
+	events   chan DocumentChanged
+	now      time.Time
+}
+
+func (this *ChangesFixture) Setup() {
+	this.storage = mempersist.NewReadWriter()
+	this.document = &TotalDocument{}
+	this.events = make(chan DocumentChanged, 16)
+	this.now = time.Now().UTC()
+}
+
+func (this *ChangesFixture) transformer() Transformer {
+	return newMultiTransformer(this.storage, false, []projector.Document{this.document}).
+		WithChangePublisher(NewChannelPublisher(this.events), true)
+}
+
+func (this *ChangesFixture) TestEventPublishedWithPatchForEachWrite() {
+	transformer := this.transformer()
+
+	transformer.Transform(this.now, []interface{}{2})
+	transformer.Transform(this.now, []interface{}{3})
+
+	first, second := <-this.events, <-this.events
+	this.So(first.Path, should.Equal, "/total")
+	this.So(first.OldVersion, should.BeNil)
+	this.So(first.NewVersion, should.Equal, "1")
+	this.So(first.Timestamp, should.HappenOnOrAfter, this.now)
+	this.So(string(first.Patch), should.Equal, `[{"op":"add","path":"","value":{"Total":2}}]`)
+	this.So(second.OldVersion, should.Equal, "1")
+	this.So(second.NewVersion, should.Equal, "2")
+	this.So(string(second.Patch), should.Equal, `[{"op":"replace","path":"/Total","value":5}]`)
+	this.So(this.events, should.BeEmpty)
+}
+
+func (this *ChangesFixture) TestOnlyCommittedWritePublishedWithPatchFromVersionRead() {
+	_ = this.storage.Write(&TotalDocument{Total: 10})
+	this.document.SetVersion("0") // stale
+
+	this.transformer().Transform(this.now, []interface{}{2})
+
+	event := <-this.events
+	this.So(event.OldVersion, should.Equal, "1")
+	this.So(event.NewVersion, should.Equal, "2")
+	this.So(string(event.Patch), should.Equal, `[{"op":"replace","path":"/Total","value":12}]`)
+	this.So(this.events, should.BeEmpty)
+}
+
+func (this *ChangesFixture) TestPatchOfNewPeriodAgainstNothingWritten() {
+	today := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	transformer := newMultiTransformer(this.storage, false, []projector.Document{newDailyOrders(today)}).
+		WithChangePublisher(NewChannelPublisher(this.events), true)
+
+	transformer.Transform(today, []interface{}{OrderPlaced{ID: 1}})
+	transformer.Transform(today.Add(24*time.Hour), []interface{}{OrderPlaced{ID: 2}})
+
+	first, second := <-this.events, <-this.events
+	this.So(first.Path, should.Equal, "/orders/2020-01-01")
+	this.So(second.Path, should.Equal, "/orders/2020-01-02")
+	this.So(second.OldVersion, should.BeNil)
+	this.So(string(second.Patch), should.Equal, `[{"op":"add","path":"","value":{"Orders":1}}]`)
+}
+
+func (this *ChangesFixture) TestSkippedWriteNotPublished() {
+	transformer := newMultiTransformer(persist.NewSkipUnchanged(this.storage), false, []projector.Document{this.document}).
+		WithChangePublisher(NewChannelPublisher(this.events), true)
+
+	transformer.Transform(this.now, []interface{}{2})
+	transformer.Transform(this.now, []interface{}{0})
+
+	this.So((<-this.events).NewVersion, should.Equal, "1")
+	this.So(this.events, should.BeEmpty)
+}
+
+func (this *ChangesFixture) TestPatchOfNestedChanges() {
+	before := []byte(`{"a":{"b":1,"c/d":[1,2]},"e":[1],"f":true,"g":null}`)
+	after := []byte(`{"a":{"b":1,"c/d":[1,3],"x~":null},"e":[1,2],"g":null}`)
+
+	patch := diffJSON(before, after)
+
+	this.So(string(patch), should.Equal, `[`+
+		`{"op":"remove","path":"/f"},`+
+		`{"op":"replace","path":"/a/c~1d/1","value":3},`+
+		`{"op":"add","path":"/a/x~0","value":null},`+
+		`{"op":"replace","path":"/e","value":[1,2]}]`)
+	this.So(string(diffJSON(after, after)), should.Equal, `[]`)
+}
+
+func (this *ChangesFixture) TestWriterPublisherDispatchesAndCommits() {
+	writer := &FakeCommitWriter{}
+	publisher := NewWriterPublisher(writer, "projections")
+	event := DocumentChanged{Path: "/total", NewVersion: "1", Timestamp: this.now}
+
+	publisher.Publish(event)
+	writer.err = errors.New("boom")
+	publisher.Publish(event) // logged
+
+	this.So(writer.dispatches, should.HaveLength, 2)
+	this.So(writer.dispatches[0].Destination, should.Equal, "projections")
+	this.So(writer.dispatches[0].MessageType, should.Equal, "transform.DocumentChanged")
+	this.So(writer.dispatches[0].Timestamp, should.Equal, this.now)
+	this.So(writer.dispatches[0].Message, should.Resemble, event)
+	this.So(writer.commits, should.Equal, 1)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeCommitWriter struct {
+	dispatches []messaging.Dispatch
+	commits    int
+	err        error
+}
+
+func (this *FakeCommitWriter) Write(dispatch messaging.Dispatch) error {
+	this.dispatches = append(this.dispatches, dispatch)
+	return this.err
+}
+func (this *FakeCommitWriter) Commit() error { this.commits++; return nil }
+func (this *FakeCommitWriter) Close()        {}
@@ -0,0 +1,141 @@
+package transform
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+// DeadLetterRecord is the serialized form of a DeadLetter; the message is kept as JSON
+// along with the name of its type (see MessageTypes) so that it can be replayed later.
+type DeadLetterRecord struct {
+	Path        string
+	Operation   string
+	MessageType string
+	Message     json.RawMessage
+	Error       string
+	Stack       string
+	Timestamp   time.Time
+	SourceID    uint64
+	MessageID   uint64
+	MessageTime time.Time
+}
+
+func NewDeadLetterRecord(letter DeadLetter) DeadLetterRecord {
+	message, err := json.Marshal(letter.Message)
+	if err != nil {
+		message, _ = json.Marshal(fmt.Sprintf("%#v", letter.Message)) // at least a description is kept
+	}
+
+	return DeadLetterRecord{
+		Path:        letter.Path,
+		Operation:   letter.Operation,
+		MessageType: MessageTypeName(letter.Message),
+		Message:     message,
+		Error:       letter.Error,
+		Stack:       letter.Stack,
+		Timestamp:   letter.Timestamp,
+		SourceID:    letter.SourceID,
+		MessageID:   letter.MessageID,
+		MessageTime: letter.MessageTime,
+	}
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// StorageDeadLetters writes each dead letter as a document of its own beneath the path provided,
+// named for the time at which the message was dead-lettered (e.g. the document at
+// "/dead-letters/2020-01-02/03-04-05.000000000-1a2b3c4d.json"), so that the letters of any
+// number of processes are written without conflict and may be listed in order.
+type StorageDeadLetters struct {
+	writer persist.Writer
+	path   string
+}
+
+func NewStorageDeadLetters(writer persist.Writer, path string) *StorageDeadLetters {
+	return &StorageDeadLetters{writer: writer, path: path}
+}
+
+func (this *StorageDeadLetters) DeadLetter(letter DeadLetter) error {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	name := letter.Timestamp.UTC().Format("2006-01-02/15-04-05.000000000") + "-" + hex.EncodeToString(suffix) + ".json"
+
+	document := newDeadLetterDocument(path.Join("/", this.path, name))
+	document.Letter = NewDeadLetterRecord(letter)
+	return this.writer.Write(document)
+}
+
+// LoadDeadLetters reads the letters written by StorageDeadLetters at the paths provided.
+func LoadDeadLetters(reader persist.Reader, paths ...string) (records []DeadLetterRecord, err error) {
+	for _, letterPath := range paths {
+		document := newDeadLetterDocument(letterPath)
+		if err = reader.Read(document); err != nil {
+			return nil, err
+		} else if len(document.Letter.Operation) == 0 {
+			return nil, fmt.Errorf("dead letter not found: '%s'", letterPath)
+		}
+		records = append(records, document.Letter)
+	}
+	return records, nil
+}
+
+// DeadLetterDocument is the document in which StorageDeadLetters keeps a dead letter.
+type DeadLetterDocument struct {
+	projector.VersionInfo
+	path   string
+	Letter DeadLetterRecord
+}
+
+func newDeadLetterDocument(path string) *DeadLetterDocument {
+	return &DeadLetterDocument{path: path}
+}
+
+func (this *DeadLetterDocument) Lapse(time.Time) projector.Document { return this }
+func (this *DeadLetterDocument) Apply(interface{}) bool             { return false }
+func (this *DeadLetterDocument) Path() string                       { return this.path }
+func (this *DeadLetterDocument) Reset() {
+	this.Letter = DeadLetterRecord{}
+	this.VersionInfo.Reset()
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// FileDeadLetters appends the dead letters, one JSON record per line (NDJSON), to a local file.
+type FileDeadLetters struct {
+	mutex    sync.Mutex
+	filename string
+}
+
+func NewFileDeadLetters(filename string) *FileDeadLetters {
+	return &FileDeadLetters{filename: filename}
+}
+
+func (this *FileDeadLetters) DeadLetter(letter DeadLetter) error {
+	raw, err := json.Marshal(NewDeadLetterRecord(letter))
+	if err != nil {
+		return err
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	file, err := os.OpenFile(this.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(append(raw, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,147 @@
+package transform
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/messaging/v2"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/projector/persist/mempersist"
+)
+
+func TestDeadLettersFixture(t *testing.T) {
+	gunit.Run(new(DeadLettersFixture), t)
+}
+
+type DeadLettersFixture struct {
+	*gunit.Fixture
+
+	directory string
+	types     *MessageTypes
+	letters   []DeadLetter
+}
+
+func (this *DeadLettersFixture) Setup() {
+	this.directory, _ = ioutil.TempDir("", "dead-letters")
+	this.types = NewMessageTypes(OrderPlaced{}, &OrderShipped{})
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	this.letters = []DeadLetter{
+		{Path: "/orders", Operation: "Apply", Message: OrderPlaced{ID: 1}, Error: "boom", Timestamp: now},
+		{Path: "/orders", Operation: "Lapse", Error: "boom", Timestamp: now},
+		{Path: "/orders", Operation: "Apply", Message: &OrderShipped{ID: 2}, Error: "boom", Timestamp: now},
+	}
+}
+func (this *DeadLettersFixture) Teardown() {
+	_ = os.RemoveAll(this.directory)
+}
+
+func (this *DeadLettersFixture) TestFileDeadLettersReplayed() {
+	filename := filepath.Join(this.directory, "dead-letters.ndjson")
+	sink := NewFileDeadLetters(filename)
+	for _, letter := range this.letters {
+		this.So(sink.DeadLetter(letter), should.BeNil)
+	}
+
+	raw, _ := ioutil.ReadFile(filename)
+	records, err := ReadDeadLetters(bytes.NewReader(raw))
+	this.So(err, should.BeNil)
+	this.So(bytes.Count(raw, []byte("\n")), should.Equal, 3)
+	this.So(records, should.HaveLength, 3)
+	this.So(records[0].MessageType, should.Equal, "transform.OrderPlaced")
+
+	input := make(chan messaging.Delivery, 4)
+	count, err := ReplayDeadLetters(records, this.types, input)
+
+	this.So(err, should.BeNil)
+	this.So(count, should.Equal, 2)
+	this.So((<-input).Message, should.Resemble, OrderPlaced{ID: 1})
+	this.So((<-input).Message, should.Resemble, &OrderShipped{ID: 2})
+}
+
+func (this *DeadLettersFixture) TestUnregisteredTypeReplaysNothing() {
+	records := []DeadLetterRecord{
+		NewDeadLetterRecord(this.letters[0]),
+		NewDeadLetterRecord(DeadLetter{Operation: "Apply", Message: 42}),
+	}
+	input := make(chan messaging.Delivery, 4)
+
+	count, err := ReplayDeadLetters(records, this.types, input)
+
+	this.So(err, should.NotBeNil)
+	this.So(count, should.Equal, 0)
+	this.So(input, should.BeEmpty)
+}
+
+func (this *DeadLettersFixture) TestStorageDeadLettersWrittenOneDocumentEach() {
+	storage := &FakePathRecorder{ReadWriter: mempersist.NewReadWriter()}
+	first := NewStorageDeadLetters(storage, "/dead-letters")
+	second := NewStorageDeadLetters(storage, "/dead-letters")
+
+	this.So(first.DeadLetter(this.letters[0]), should.BeNil)
+	this.So(second.DeadLetter(this.letters[1]), should.BeNil)
+	this.So(first.DeadLetter(this.letters[2]), should.BeNil)
+
+	this.So(storage.paths, should.HaveLength, 3)
+	this.So(storage.paths[0], should.StartWith, "/dead-letters/2020-01-02/03-04-05.000000000-")
+	this.So(storage.paths[0], should.NotEqual, storage.paths[2])
+	records, err := LoadDeadLetters(storage, storage.paths...)
+	this.So(err, should.BeNil)
+	this.So(records, should.HaveLength, 3)
+	this.So(records[1].Operation, should.Equal, "Lapse")
+	this.So(records[2].MessageType, should.Equal, "transform.OrderShipped")
+
+	_, err = LoadDeadLetters(storage, "/dead-letters/missing.json")
+	this.So(err, should.NotBeNil)
+}
+
+func (this *DeadLettersFixture) TestReplayedAsOriginallyDelivered() {
+	delivered := time.Date(2019, 12, 31, 23, 59, 0, 0, time.UTC)
+	letter := newDeadLetter("/orders", "Apply",
+		identify(messaging.Delivery{SourceID: 1, MessageID: 2, Timestamp: delivered, Message: OrderPlaced{ID: 1}}),
+		"boom", time.Now())
+	input := make(chan messaging.Delivery, 1)
+
+	_, err := ReplayDeadLetters([]DeadLetterRecord{NewDeadLetterRecord(letter)}, this.types, input)
+
+	this.So(err, should.BeNil)
+	this.So(<-input, should.Resemble, messaging.Delivery{
+		SourceID:    1,
+		MessageID:   2,
+		MessageType: "transform.OrderPlaced",
+		Timestamp:   delivered,
+		Message:     OrderPlaced{ID: 1},
+	})
+}
+
+func (this *DeadLettersFixture) TestEventTimeKeptAsMessageTime() {
+	occurred := time.Date(2019, 12, 31, 23, 59, 0, 0, time.UTC)
+	message := timedMessage{at: occurred, message: identify(messaging.Delivery{SourceID: 1, Timestamp: occurred.Add(time.Hour), Message: 1})}
+
+	letter := newDeadLetter("/orders", "Late", message, "late", time.Now())
+
+	this.So(letter.Message, should.Equal, 1)
+	this.So(letter.SourceID, should.Equal, 1)
+	this.So(letter.MessageTime, should.Equal, occurred)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakePathRecorder struct {
+	persist.ReadWriter
+	paths []string
+}
+
+func (this *FakePathRecorder) Write(document projector.Document) error {
+	this.paths = append(this.paths, document.Path())
+	return this.ReadWriter.Write(document)
+}
+
+type OrderPlaced struct{ ID int }
+type OrderShipped struct{ ID int }
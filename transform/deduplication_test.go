@@ -0,0 +1,114 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/messaging/v2"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist/mempersist"
+)
+
+func TestDeduplicationFixture(t *testing.T) {
+	gunit.Run(new(DeduplicationFixture), t)
+}
+
+type DeduplicationFixture struct {
+	*gunit.Fixture
+
+	storage  *mempersist.ReadWriter
+	document *TotalDocument
+}
+
+func (this *DeduplicationFixture) Setup() {
+	this.storage = mempersist.NewReadWriter()
+	this.document = &TotalDocument{}
+}
+
+func (this *DeduplicationFixture) listen(deliveries ...messaging.Delivery) {
+	input := make(chan messaging.Delivery, len(deliveries))
+	output := make(chan interface{}, len(deliveries))
+	for _, delivery := range deliveries {
+		input <- delivery
+	}
+	close(input)
+	NewConfigurableHandler(utcNow, input, output, this.storage, this.document).Listen()
+}
+
+func (this *DeduplicationFixture) TestRedeliveredMessagesSkipped() {
+	this.listen(
+		messaging.Delivery{SourceID: 1, MessageID: 1, Message: 10},
+		messaging.Delivery{SourceID: 1, MessageID: 2, Message: 20},
+	)
+	this.listen(
+		messaging.Delivery{SourceID: 1, MessageID: 2, Message: 20}, // redelivered
+		messaging.Delivery{SourceID: 2, MessageID: 2, Message: 5},  // another source
+	)
+
+	this.So(this.document.Total, should.Equal, 35)
+}
+
+func (this *DeduplicationFixture) TestWindowPersistedWithDocument() {
+	this.listen(messaging.Delivery{SourceID: 1, MessageID: 1, Message: 10})
+
+	stored := &TotalDocument{}
+	_ = this.storage.Read(stored)
+	raw, _ := json.Marshal(stored)
+
+	this.So(stored.Total, should.Equal, 10)
+	this.So(stored.Applied(projector.DeliveryID{SourceID: 1, MessageID: 1}), should.BeTrue)
+	this.So(string(raw), should.ContainSubstring, `"AppliedDeliveries":[{"SourceID":1,"MessageID":1}]`)
+}
+
+func (this *DeduplicationFixture) TestMessagesWithoutIdentifiersAlwaysApplied() {
+	this.listen(messaging.Delivery{Message: 10}, messaging.Delivery{Message: 10})
+
+	this.So(this.document.Total, should.Equal, 20)
+	this.So(this.document.AppliedDeliveries, should.BeEmpty)
+}
+
+func (this *DeduplicationFixture) TestMessagesReappliedToVersionWhichLacksThem() {
+	this.listen(messaging.Delivery{SourceID: 1, MessageID: 1, Message: 10})
+	_ = this.storage.Write(&TotalDocument{Total: 100}) // another process; version 2 lacks delivery 1
+
+	this.listen(
+		messaging.Delivery{SourceID: 1, MessageID: 1, Message: 10},
+		messaging.Delivery{SourceID: 1, MessageID: 2, Message: 1},
+	)
+
+	this.So(this.document.Total, should.Equal, 111)
+}
+
+func (this *DeduplicationFixture) TestWindowBounded() {
+	window := projector.DeliveryWindow{}
+	window.SetDeliveryWindowCapacity(2)
+
+	window.Remember(projector.DeliveryID{MessageID: 1})
+	window.Remember(projector.DeliveryID{MessageID: 2})
+	window.Remember(projector.DeliveryID{MessageID: 3})
+
+	this.So(window.Applied(projector.DeliveryID{MessageID: 1}), should.BeFalse)
+	this.So(window.Applied(projector.DeliveryID{MessageID: 3}), should.BeTrue)
+	this.So(window.AppliedDeliveries, should.HaveLength, 2)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type TotalDocument struct {
+	projector.DeliveryWindow
+	version interface{}
+	Total   int
+}
+
+func (this *TotalDocument) Lapse(time.Time) projector.Document { return this }
+func (this *TotalDocument) Apply(message interface{}) bool {
+	this.Total += message.(int)
+	return true
+}
+func (this *TotalDocument) Path() string                 { return "/total" }
+func (this *TotalDocument) Reset()                       { this.Total = 0; this.DeliveryWindow.Reset() }
+func (this *TotalDocument) SetVersion(value interface{}) { this.version = value }
+func (this *TotalDocument) Version() interface{}         { return this.version }
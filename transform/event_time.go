@@ -0,0 +1,66 @@
+package transform
+
+import (
+	"time"
+
+	"github.com/smartystreets/messaging/v2"
+)
+
+// EventTimed is implemented by messages which carry the time at which they occurred; in
+// event-time mode (see Handler.WithEventTime) it takes precedence over the delivery timestamp.
+type EventTimed interface {
+	EventTime() time.Time
+}
+
+// timedMessage carries the event time of the delivery through to the transformer, which lapses
+// the documents each time the event time advances rather than once per batch at the time of
+// processing.
+type timedMessage struct {
+	at      time.Time
+	message interface{}
+}
+
+func eventTime(delivery messaging.Delivery, now time.Time) time.Time {
+	if timed, ok := delivery.Message.(EventTimed); ok && !timed.EventTime().IsZero() {
+		return timed.EventTime()
+	} else if !delivery.Timestamp.IsZero() {
+		return delivery.Timestamp
+	} else {
+		return now
+	}
+}
+
+func untime(message interface{}) (time.Time, bool, interface{}) {
+	if timed, ok := message.(timedMessage); ok {
+		return timed.at, true, timed.message
+	}
+	return time.Time{}, false, message
+}
+
+// eventTimed reports whether the messages carry event times, which is decided by the first.
+func eventTimed(messages []interface{}) bool {
+	if len(messages) == 0 {
+		return false
+	}
+	_, timed, _ := untime(messages[0])
+	return timed
+}
+
+// nextEventRun gives back the number of leading messages sharing the time at which the document
+// is to be lapsed, being the time of the first of them or the clock when the clock is later;
+// the run ends at the first message with a later time (or, when strict, with any other time,
+// so that late messages may be routed individually). Messages without a time extend the run.
+func nextEventRun(clock time.Time, messages []interface{}, strict bool) (time.Time, int) {
+	at, _, _ := untime(messages[0])
+	if at.Before(clock) {
+		at = clock
+	}
+
+	count := 1
+	for ; count < len(messages); count++ {
+		if next, timed, _ := untime(messages[count]); timed && (next.After(at) || strict && next.Before(at)) {
+			break
+		}
+	}
+	return at, count
+}
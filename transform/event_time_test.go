@@ -0,0 +1,122 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/messaging/v2"
+	"github.com/smartystreets/projector/persist/mempersist"
+)
+
+func TestEventTimeFixture(t *testing.T) {
+	gunit.Run(new(EventTimeFixture), t)
+}
+
+type EventTimeFixture struct {
+	*gunit.Fixture
+
+	storage *mempersist.ReadWriter
+	input   chan messaging.Delivery
+	output  chan interface{}
+	day     time.Time
+	now     time.Time
+}
+
+func (this *EventTimeFixture) Setup() {
+	this.storage = mempersist.NewReadWriter()
+	this.input = make(chan messaging.Delivery, 16)
+	this.output = make(chan interface{}, 16)
+	this.day = time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	this.now = this.day.Add(50 * time.Hour)
+}
+
+func (this *EventTimeFixture) listen(eventTime bool) {
+	handler := NewConfigurableHandler(func() time.Time { return this.now }, this.input, this.output, this.storage, newDailyOrders(this.day))
+	if eventTime {
+		handler.WithEventTime()
+	}
+
+	go close(this.input)
+	handler.WithSleep(0).Listen()
+}
+func (this *EventTimeFixture) orders(day time.Time) int {
+	document := newDailyOrders(day)
+	this.So(this.storage.Read(document), should.BeNil)
+	return document.Orders
+}
+
+func (this *EventTimeFixture) TestProcessingTimeByDefault() {
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(time.Hour), Message: OrderPlaced{ID: 1}}
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(25 * time.Hour), Message: OrderPlaced{ID: 2}}
+
+	this.listen(false)
+
+	this.So(this.orders(this.now), should.Equal, 2)
+}
+
+func (this *EventTimeFixture) TestDocumentsLapsedAsEventTimeAdvances() {
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(time.Hour), Message: OrderPlaced{ID: 1}}
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(30 * time.Hour), Message: OrderPlacedAt{
+		OrderPlaced: OrderPlaced{ID: 2}, At: this.day.Add(2 * time.Hour), // the message's own time prevails
+	}}
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(25 * time.Hour), Message: OrderPlaced{ID: 3}}
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(3 * time.Hour), Message: OrderPlaced{ID: 4}} // event time never goes back
+	this.input <- messaging.Delivery{Message: OrderPlaced{ID: 5}}                                         // at the time of processing
+
+	this.listen(true)
+
+	this.So(this.orders(this.day), should.Equal, 2)
+	this.So(this.orders(this.day.Add(24*time.Hour)), should.Equal, 2)
+	this.So(this.orders(this.now), should.Equal, 1)
+}
+
+func (this *EventTimeFixture) TestLateMessagesRoutedToPeriodUntilFinalized() {
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(1 * time.Hour), Message: OrderPlaced{ID: 1}}
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(25 * time.Hour), Message: OrderPlaced{ID: 2}}
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(23 * time.Hour), Message: OrderPlaced{ID: 3}} // the previous day
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(24 * time.Hour), Message: OrderPlaced{ID: 4}} // late, but the current day
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(28 * time.Hour), Message: OrderPlaced{ID: 5}} // the previous day is finalized
+	this.input <- messaging.Delivery{Timestamp: this.day.Add(22 * time.Hour), Message: OrderPlaced{ID: 6}} // too late
+	sink := &FakeDeadLetterSink{}
+	handler := NewConfigurableHandler(func() time.Time { return this.now }, this.input, this.output, this.storage, newDailyOrders(this.day)).
+		WithAllowedLateness(2 * time.Hour).
+		WithDeadLetters(sink).
+		WithSleep(0)
+
+	go close(this.input)
+	handler.Listen()
+
+	this.So(this.orders(this.day), should.Equal, 2)
+	this.So(this.orders(this.day.Add(24*time.Hour)), should.Equal, 3)
+	this.So(sink.letters, should.HaveLength, 1)
+	this.So(sink.letters[0].Operation, should.Equal, "Late")
+	this.So(sink.letters[0].Message, should.Resemble, OrderPlaced{ID: 6})
+}
+
+func (this *EventTimeFixture) TestLateMessagesOfDocumentsWithoutPeriodsAppliedToCurrent() {
+	hour := this.day.Add(time.Hour)
+	this.input <- messaging.Delivery{Timestamp: hour, Message: 1}
+	this.input <- messaging.Delivery{Timestamp: hour.Add(2 * time.Hour), Message: 2}
+	this.input <- messaging.Delivery{Timestamp: hour.Add(time.Hour), Message: 4} // late, no period claims it but the current
+	handler := NewConfigurableHandler(func() time.Time { return this.now }, this.input, this.output, this.storage, newHourlyTotal(hour)).
+		WithAllowedLateness(2 * time.Hour).
+		WithSleep(0)
+
+	go close(this.input)
+	handler.Listen()
+
+	document := newHourlyTotal(hour.Add(2 * time.Hour))
+	this.So(this.storage.Read(document), should.BeNil)
+	this.So(document.Total, should.Equal, 6)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type OrderPlacedAt struct {
+	OrderPlaced
+	At time.Time
+}
+
+func (this OrderPlacedAt) EventTime() time.Time { return this.At }
@@ -1,6 +1,7 @@
 package transform
 
 import (
+	"log"
 	"time"
 
 	"github.com/smartystreets/listeners"
@@ -9,6 +10,8 @@ import (
 	"github.com/smartystreets/projector/persist"
 )
 
+var _ listeners.Listener = new(Handler)
+
 type Handler struct {
 	input       <-chan messaging.Delivery
 	output      chan<- interface{}
@@ -16,14 +19,65 @@ type Handler struct {
 	messages    []interface{}
 	now         func() time.Time
 	sleep       time.Duration
+	eventTime   bool
+
+	flushInterval    time.Duration
+	flushMaxMessages int
+	flushed          time.Time
+	unflushed        int
+	receipt          interface{}
+
+	pipelines *pipelinedTransformer
+	receipts  []sequencedReceipt
+
+	quarantine *quarantine
+}
+
+type sequencedReceipt struct {
+	sequence uint64
+	receipt  interface{}
 }
 
 func NewHandler(now func() time.Time, i <-chan messaging.Delivery, o chan<- interface{}, rw persist.ReadWriter, d ...projector.Document) listeners.Listener {
+	return NewConfigurableHandler(now, i, o, rw, d...)
+}
+
+// NewConfigurableHandler is NewHandler for callers which configure the handler further (e.g.
+// WithWorkers, WithPanicPolicy, or WithEventTime) before it listens.
+func NewConfigurableHandler(now func() time.Time, i <-chan messaging.Delivery, o chan<- interface{}, rw persist.ReadWriter, d ...projector.Document) *Handler {
 	return newHandler(i, o, newTransformer(rw, d...), now)
 }
 
+// NewWriteBehindHandler accumulates changes to the documents in memory, writing them at most
+// once per interval or after maxMessages deliveries, whichever comes first. The receipt of a
+// delivery is only sent to the output channel once the writes covering it have completed.
+func NewWriteBehindHandler(
+	now func() time.Time, i <-chan messaging.Delivery, o chan<- interface{}, rw persist.ReadWriter,
+	interval time.Duration, maxMessages int, d ...projector.Document,
+) *Handler {
+	return newHandler(i, o, newDeferredTransformer(rw, d...), now).WithWriteBehind(interval, maxMessages)
+}
+
+// NewPipelinedHandler transforms and writes each document on a goroutine of its own with a
+// queue of up to capacity batches, so that a slow or failing document doesn't stall the rest
+// until its queue fills. Receipts are sent to the output channel once every document has
+// committed the batches which they cover; Progress reports which document is behind.
+func NewPipelinedHandler(
+	now func() time.Time, i <-chan messaging.Delivery, o chan<- interface{}, rw persist.ReadWriter,
+	capacity int, d ...projector.Document,
+) *Handler {
+	handler := newHandler(i, o, nil, now)
+	handler.pipelines = newPipelinedTransformer(rw, capacity, d...)
+	handler.quarantine = handler.pipelines.quarantine
+	return handler
+}
+
 func newHandler(input <-chan messaging.Delivery, output chan<- interface{}, transformer Transformer, now func() time.Time) *Handler {
-	return &Handler{input: input, output: output, transformer: transformer, now: now}
+	this := &Handler{input: input, output: output, transformer: transformer, now: now, quarantine: newQuarantine()}
+	if multi, ok := transformer.(*multiTransformer); ok {
+		this.quarantine = multi.quarantine
+	}
+	return this
 }
 
 func (this *Handler) WithSleep(duration time.Duration) *Handler {
@@ -31,18 +85,259 @@ func (this *Handler) WithSleep(duration time.Duration) *Handler {
 	return this
 }
 
+// WithWorkers bounds the number of documents transformed and written concurrently. It panics
+// for the pipelined handler, which transforms each document on a goroutine of its own.
+func (this *Handler) WithWorkers(count int) *Handler {
+	transformer, ok := this.transformer.(*multiTransformer)
+	if !ok {
+		log.Panic("[ERROR] WithWorkers doesn't apply to the pipelined handler; each document has a goroutine of its own.")
+	}
+	transformer.WithWorkers(count)
+	return this
+}
+
+// WithPanicPolicy determines how the handler continues once a document panics while applying a
+// message or lapsing; by default the handler halts without acknowledging the batch, and Listen
+// panics (see HaltHandler).
+func (this *Handler) WithPanicPolicy(policy PanicPolicy) *Handler {
+	this.quarantine.policy = policy
+	return this
+}
+
+// WithDeadLetters sends every message which couldn't be projected to the sink provided: those
+// which caused a document to panic, which a projector.ValidatingDocument rejected, which arrived
+// too late (see WithAllowedLateness), or which storage repeatedly refused to write.
+func (this *Handler) WithDeadLetters(sink DeadLetterSink) *Handler {
+	this.quarantine.sink = sink
+	return this
+}
+
+// WithWriteBehind flushes the transformer once per interval or after maxMessages deliveries (when
+// positive) rather than after every batch; the transformer must defer its writes until flushed.
+func (this *Handler) WithWriteBehind(interval time.Duration, maxMessages int) *Handler {
+	this.flushInterval = interval
+	this.flushMaxMessages = maxMessages
+	return this
+}
+
+// WithEventTime lapses the documents at the time each message occurred (see EventTimed, which
+// is otherwise the timestamp of the delivery) as that time advances, rather than once per batch
+// at the time of processing, so that delayed or replayed messages reach the documents of the
+// period in which they occurred.
+func (this *Handler) WithEventTime() *Handler {
+	this.eventTime = true
+	return this
+}
+
+// WithAllowedLateness, in event-time mode (which it enables), keeps each outgoing document open
+// until the watermark (the latest event time less the lateness) passes the time at which it
+// was lapsed. Late messages are applied to the document whose period covers them (see
+// projector.PeriodicDocument) while it remains open; those arriving later still are rejected
+// (and sent to the dead letters, if any). Documents which aren't periodic apply every late
+// message to the current document.
+func (this *Handler) WithAllowedLateness(lateness time.Duration) *Handler {
+	this.eventTime = true
+	if transformer, ok := this.transformer.(*multiTransformer); ok {
+		transformer.WithAllowedLateness(lateness)
+	} else if this.pipelines != nil {
+		this.pipelines.WithAllowedLateness(lateness)
+	}
+	return this
+}
+
+// WithChangePublisher sends an event to the publisher once each write of a document has been
+// committed to storage, including, when patches is set, the RFC 6902 JSON Patch from the
+// document as previously written (which costs serializing the document once more).
+func (this *Handler) WithChangePublisher(publisher ChangePublisher, patches bool) *Handler {
+	if transformer, ok := this.transformer.(*multiTransformer); ok {
+		transformer.WithChangePublisher(publisher, patches)
+	} else if this.pipelines != nil {
+		this.pipelines.WithChangePublisher(publisher, patches)
+	}
+	return this
+}
+
 func (this *Handler) Listen() {
+	if this.pipelines != nil {
+		this.listenPipelined()
+	} else if this.flushInterval > 0 {
+		this.listenWriteBehind()
+	} else {
+		this.listen()
+	}
+
+	close(this.output)
+	if this.quarantine.Halted() {
+		log.Panicf("[ERROR] Handler halted without acknowledging the batch: %s", this.quarantine.Cause())
+	}
+}
+func (this *Handler) listen() {
 	for delivery := range this.input {
-		this.messages = append(this.messages, delivery.Message)
+		this.messages = append(this.messages, this.identify(delivery))
 		if len(this.input) > 0 {
 			continue
 		}
 
 		this.transformer.Transform(this.now(), this.messages)
+		if this.quarantine.Halted() {
+			return
+		}
 		this.output <- delivery.Receipt
 		this.messages = this.messages[0:0]
 		time.Sleep(this.sleep)
 	}
+}
+func (this *Handler) listenWriteBehind() {
+	ticker := time.NewTicker(this.flushInterval)
+	defer ticker.Stop()
+
+	this.flushed = this.now()
+	for {
+		select {
+		case delivery, open := <-this.input:
+			if !open {
+				this.flush()
+				return
+			}
+
+			this.messages = append(this.messages, this.identify(delivery))
+			this.receipt = delivery.Receipt
+			this.unflushed++
+			if len(this.input) > 0 && !this.exceeds() {
+				continue
+			}
+
+			this.transform()
+			if this.exceeds() || this.now().Sub(this.flushed) >= this.flushInterval {
+				this.flush()
+			}
+			time.Sleep(this.sleep)
+
+		case <-ticker.C:
+			if this.now().Sub(this.flushed) >= this.flushInterval {
+				this.flush()
+			}
+		}
+
+		if this.quarantine.Halted() {
+			return
+		}
+	}
+}
+func (this *Handler) transform() {
+	if len(this.messages) > 0 {
+		this.transformer.Transform(this.now(), this.messages)
+		this.messages = this.messages[0:0]
+	}
+}
+func (this *Handler) flush() {
+	if this.unflushed == 0 {
+		return
+	}
 
-	close(this.output)
+	this.transform() // the batch may have been interrupted by the ticker
+	this.transformer.Flush()
+	if this.quarantine.Halted() {
+		return // the receipt must not be acknowledged
+	}
+	this.output <- this.receipt
+	this.unflushed = 0
+	this.flushed = this.now()
+}
+func (this *Handler) exceeds() bool {
+	return this.flushMaxMessages > 0 && this.unflushed >= this.flushMaxMessages
+}
+
+func (this *Handler) listenPipelined() {
+	for {
+		select {
+		case delivery, open := <-this.input:
+			if !open {
+				this.pipelines.Close()
+				this.pipelines.Wait()
+				if !this.quarantine.Halted() {
+					this.acknowledge(this.pipelines.CommittedThrough())
+				}
+				return
+			}
+
+			this.messages = append(this.messages, this.identify(delivery))
+			if len(this.input) > 0 {
+				continue
+			}
+
+			sequence := this.pipelines.Transform(this.now(), this.messages)
+			this.receipts = append(this.receipts, sequencedReceipt{sequence: sequence, receipt: delivery.Receipt})
+			this.messages = this.messages[0:0]
+			time.Sleep(this.sleep)
+
+		case <-this.pipelines.Committed():
+			through := this.pipelines.CommittedThrough() // a document halting from here on doesn't commit
+			if this.quarantine.Halted() {
+				this.pipelines.Close() // the pipelines stop once the batches queued have been transformed
+				return
+			}
+			this.acknowledge(through)
+		}
+	}
+}
+
+// acknowledge sends the receipt of the latest batch committed by every document; because
+// receipts acknowledge every delivery which preceded them, the earlier ones are dropped.
+func (this *Handler) acknowledge(through uint64) {
+	index := 0
+	for index < len(this.receipts) && this.receipts[index].sequence <= through {
+		index++
+	}
+	if index == 0 {
+		return
+	}
+
+	this.output <- this.receipts[index-1].receipt
+	this.receipts = this.receipts[index:]
+}
+
+// Progress reports, for the pipelined handler, how far each document has progressed.
+func (this *Handler) Progress() []DocumentProgress {
+	if this.pipelines == nil {
+		return nil
+	}
+	return this.pipelines.Progress()
+}
+
+func (this *Handler) identify(delivery messaging.Delivery) interface{} {
+	if !this.eventTime {
+		return identify(delivery)
+	}
+	return timedMessage{at: eventTime(delivery, this.now()), message: identify(delivery)}
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// identifiedMessage carries the identifier of the delivery through to the transformer so that
+// documents implementing projector.DeduplicatingDocument can skip deliveries already applied,
+// along with its timestamp, so that a message dead-lettered can be replayed as delivered.
+type identifiedMessage struct {
+	id      projector.DeliveryID
+	at      time.Time
+	message interface{}
+}
+
+func identify(delivery messaging.Delivery) interface{} {
+	if delivery.SourceID == 0 && delivery.MessageID == 0 && delivery.Timestamp.IsZero() {
+		return delivery.Message
+	}
+
+	id := projector.DeliveryID{SourceID: delivery.SourceID, MessageID: delivery.MessageID}
+	return identifiedMessage{id: id, at: delivery.Timestamp, message: delivery.Message}
+}
+func unidentify(message interface{}) (projector.DeliveryID, bool, interface{}) {
+	id, _, body := delivered(message)
+	return id, id != projector.DeliveryID{}, body
+}
+func delivered(message interface{}) (projector.DeliveryID, time.Time, interface{}) {
+	if identified, ok := message.(identifiedMessage); ok {
+		return identified.id, identified.at, identified.message
+	}
+	return projector.DeliveryID{}, time.Time{}, message
 }
@@ -44,10 +44,49 @@ func (this *HandlerFixture) TestMessagesHandled() {
 	this.So(<-this.output, should.BeNil) // channel closed
 }
 
+func (this *HandlerFixture) TestWriteBehindFlushesAfterMaxMessages() {
+	this.handler.WithWriteBehind(time.Hour, 2)
+	this.input <- messaging.Delivery{Message: 1, Receipt: 11}
+	this.input <- messaging.Delivery{Message: 2, Receipt: 12}
+	this.input <- messaging.Delivery{Message: 3, Receipt: 13}
+	go close(this.input)
+	this.handler.Listen()
+
+	this.So(this.transformer.calls, should.Equal, 2)
+	this.So(this.transformer.flushes, should.Equal, 2) // the second when the input is closed
+	this.So(this.transformer.messages, should.Resemble, []interface{}{1, 2, 3})
+	this.So(<-this.output, should.Equal, 12)
+	this.So(<-this.output, should.Equal, 13)
+	this.So(<-this.output, should.BeNil) // channel closed
+}
+
+func (this *HandlerFixture) TestWriteBehindFlushesAfterInterval() {
+	input := make(chan messaging.Delivery) // unbuffered: every delivery is a batch
+	clock := this.now
+	this.handler = newHandler(input, this.output, this.transformer, func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}).WithWriteBehind(time.Minute*5, 0)
+
+	go func() {
+		input <- messaging.Delivery{Message: 1, Receipt: 11}
+		input <- messaging.Delivery{Message: 2, Receipt: 12}
+		input <- messaging.Delivery{Message: 3, Receipt: 13}
+		close(input)
+	}()
+	this.handler.Listen()
+
+	this.So(this.transformer.calls, should.Equal, 3)
+	this.So(this.transformer.flushes, should.Equal, 1)
+	this.So(<-this.output, should.Equal, 13)
+	this.So(<-this.output, should.BeNil) // nothing left to flush once closed
+}
+
 /* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
 
 type FakeTransformer struct {
 	calls    int
+	flushes  int
 	now      time.Time
 	messages []interface{}
 }
@@ -57,3 +96,4 @@ func (this *FakeTransformer) Transform(now time.Time, messages []interface{}) {
 	this.now = now
 	this.messages = append(this.messages, messages...)
 }
+func (this *FakeTransformer) Flush() { this.flushes++ }
@@ -0,0 +1,90 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// diffJSON gives back the RFC 6902 JSON Patch which transforms the JSON document provided
+// first (nil for no document) into the second. Objects are compared member by member and
+// arrays of the same length element by element; other changes replace the value entirely.
+func diffJSON(before, after []byte) json.RawMessage {
+	var from, to interface{}
+	if err := json.Unmarshal(after, &to); err != nil {
+		return nil
+	}
+
+	operations := []patchOperation{}
+	if len(before) == 0 || json.Unmarshal(before, &from) != nil {
+		operations = append(operations, patchOperation{Op: "add", Path: "", Value: to})
+	} else {
+		operations = diffValues(operations, "", from, to)
+	}
+
+	patch, _ := json.Marshal(operations)
+	return patch
+}
+
+type patchOperation struct {
+	Op    string
+	Path  string
+	Value interface{}
+}
+
+func (this patchOperation) MarshalJSON() ([]byte, error) {
+	if this.Op == "remove" {
+		return json.Marshal(map[string]interface{}{"op": this.Op, "path": this.Path})
+	}
+	return json.Marshal(map[string]interface{}{"op": this.Op, "path": this.Path, "value": this.Value})
+}
+
+func diffValues(operations []patchOperation, path string, from, to interface{}) []patchOperation {
+	switch fromValue := from.(type) {
+	case map[string]interface{}:
+		if toValue, ok := to.(map[string]interface{}); ok {
+			return diffObjects(operations, path, fromValue, toValue)
+		}
+	case []interface{}:
+		if toValue, ok := to.([]interface{}); ok && len(toValue) == len(fromValue) {
+			for i := range fromValue {
+				operations = diffValues(operations, path+"/"+strconv.Itoa(i), fromValue[i], toValue[i])
+			}
+			return operations
+		}
+	}
+
+	if reflect.DeepEqual(from, to) {
+		return operations
+	}
+	return append(operations, patchOperation{Op: "replace", Path: path, Value: to})
+}
+func diffObjects(operations []patchOperation, path string, from, to map[string]interface{}) []patchOperation {
+	for _, key := range sortedKeys(from) {
+		if _, found := to[key]; !found {
+			operations = append(operations, patchOperation{Op: "remove", Path: path + "/" + escapePointer(key)})
+		}
+	}
+	for _, key := range sortedKeys(to) {
+		if value, found := from[key]; found {
+			operations = diffValues(operations, path+"/"+escapePointer(key), value, to[key])
+		} else {
+			operations = append(operations, patchOperation{Op: "add", Path: path + "/" + escapePointer(key), Value: to[key]})
+		}
+	}
+	return operations
+}
+func sortedKeys(object map[string]interface{}) (keys []string) {
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapePointer escapes a member name as a reference token of a JSON Pointer (RFC 6901).
+func escapePointer(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
@@ -0,0 +1,103 @@
+package transform
+
+import (
+	"time"
+
+	"github.com/smartystreets/projector"
+)
+
+// closedPeriod is an outgoing document which, in event-time mode with an allowed lateness,
+// remains open to the messages of its period which arrive late. It is finalized (sealed and
+// forgotten) once the watermark, being the latest event time less the
+// allowed lateness, passes the event time at which the document was lapsed.
+type closedPeriod struct {
+	*simpleTransformer
+	closed time.Time
+}
+
+// retire seals the outgoing document or, when late messages are allowed, keeps it open (to be
+// sealed once finalized) along with its unwritten changes, which are written as the
+// transformer is flushed.
+func (this *simpleTransformer) retire(now time.Time) {
+	if this.lateness <= 0 {
+		this.seal(now)
+		return
+	}
+
+	outgoing := newSimpleTransformer(this.document, this.storage).
+		withDeferredWrites(true).
+		withQuarantine(this.quarantine)
+	outgoing.pending, this.pending = this.pending, nil
+	outgoing.index, outgoing.retired = this.index, true
+	outgoing.publication, outgoing.written, this.written = this.publication, this.written, nil
+	this.closed = append(this.closed, &closedPeriod{simpleTransformer: outgoing, closed: now})
+}
+
+func (this *simpleTransformer) late(message interface{}) bool {
+	at, timed, _ := untime(message)
+	return this.lateness > 0 && timed && at.Before(this.clock)
+}
+
+// route applies a late message to the document of its period: the current document or the
+// most recently closed one which covers the time of the message. A message whose period has
+// been finalized is rejected.
+func (this *simpleTransformer) route(message interface{}) {
+	at, _, _ := untime(message)
+	if this.claims(at) {
+		this.accept([]interface{}{message})
+		return
+	}
+
+	for i := len(this.closed) - 1; i >= 0 && !this.halted; i-- {
+		if period := this.closed[i]; !period.halted && period.claims(at) {
+			period.accept([]interface{}{message})
+			return
+		}
+	}
+
+	if !this.halted {
+		this.quarantine.Reject(this.document.Path(), deadLetterLate, message, "the period of the message has been finalized")
+	}
+}
+
+// claims reports whether the time of a late message falls in the period of the document (see
+// projector.PeriodicDocument); a document which isn't periodic claims every message.
+func (this *simpleTransformer) claims(at time.Time) (covered bool) {
+	periodic, ok := this.document.(projector.PeriodicDocument)
+	if this.halted {
+		return false
+	} else if !ok {
+		return true
+	}
+
+	defer func() {
+		if panicked := recover(); panicked != nil {
+			this.halted = !this.quarantine.Recover(this.document.Path(), "Covers", nil, panicked)
+			covered = false
+		}
+	}()
+
+	return periodic.Covers(at)
+}
+
+// finalize seals and forgets the closed periods which the watermark has passed.
+func (this *simpleTransformer) finalize() {
+	if len(this.closed) == 0 {
+		return
+	}
+
+	watermark := this.clock.Add(-this.lateness)
+	open := this.closed[0:0]
+	for _, period := range this.closed {
+		if period.closed.After(watermark) {
+			open = append(open, period)
+		} else {
+			period.seal(period.closed)
+		}
+	}
+
+	for i := len(open); i < len(this.closed); i++ {
+		this.closed[i] = nil
+	}
+	this.closed = open
+}
@@ -0,0 +1,65 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// MessageTypes maps the names under which messages are archived (or dead-lettered) to their
+// concrete types so that they can be decoded again. A type is named by its package and type
+// name, e.g. "orders.Placed", whether or not it was registered as a pointer.
+type MessageTypes struct {
+	types map[string]reflect.Type
+}
+
+func NewMessageTypes(samples ...interface{}) *MessageTypes {
+	this := &MessageTypes{types: map[string]reflect.Type{}}
+	for _, sample := range samples {
+		this.Register(sample)
+	}
+	return this
+}
+
+// Register adds the type of the sample provided; messages are decoded as pointers
+// when the sample is a pointer.
+func (this *MessageTypes) Register(sample interface{}) {
+	this.RegisterName(MessageTypeName(sample), sample)
+}
+
+// RegisterName adds the type of the sample provided under the name provided.
+func (this *MessageTypes) RegisterName(name string, sample interface{}) {
+	this.types[name] = reflect.TypeOf(sample)
+}
+
+func (this *MessageTypes) Decode(name string, raw []byte) (interface{}, error) {
+	registered, found := this.types[name]
+	if !found {
+		return nil, fmt.Errorf("message type not registered: '%s'", name)
+	}
+
+	value := reflect.New(indirect(registered))
+	if err := json.Unmarshal(raw, value.Interface()); err != nil {
+		return nil, fmt.Errorf("message of type '%s' could not be decoded: %s", name, err)
+	}
+
+	if registered.Kind() == reflect.Ptr {
+		return value.Interface(), nil
+	}
+	return value.Elem().Interface(), nil
+}
+
+// MessageTypeName is the name under which the type of the message is registered by default.
+func MessageTypeName(message interface{}) string {
+	if message == nil {
+		return ""
+	}
+	return indirect(reflect.TypeOf(message)).String()
+}
+
+func indirect(value reflect.Type) reflect.Type {
+	if value.Kind() == reflect.Ptr {
+		return value.Elem()
+	}
+	return value
+}
@@ -0,0 +1,154 @@
+package transform
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+// Partition describes a partition of a projector.PartitionedDocument as last written.
+type Partition struct {
+	Path    string
+	Version string
+	Written time.Time
+}
+
+// partitionIndex keeps the manifest and latest alias of the partitioned documents written by a
+// transformer (and its closed periods). The documents of the index are written with the
+// version read as a precondition, like the documents themselves: where storage enforces it
+// (e.g. Google Cloud Storage, but not S3), a conflicting write is read again and retried
+// against the version written by the other process until the partition is recorded. Other
+// storage keeps the last write, so partitions recorded at the same time by another process
+// writing the same index may go missing from it. A partition already recorded at the same
+// version isn't written again.
+type partitionIndex struct {
+	storage   persist.ReadWriter
+	now       func() time.Time
+	sleep     func(time.Duration)
+	documents map[string]indexDocument
+}
+
+func newPartitionIndex(storage persist.ReadWriter) *partitionIndex {
+	return &partitionIndex{
+		storage:   storage,
+		now:       time.Now,
+		sleep:     time.Sleep,
+		documents: map[string]indexDocument{},
+	}
+}
+
+// Written records the document, once written, in its manifest and, unless it belongs to a
+// closed period, in its latest alias.
+func (this *partitionIndex) Written(document projector.Document, latest bool) {
+	partitioned, ok := document.(projector.PartitionedDocument)
+	if !ok {
+		return
+	}
+
+	partition := Partition{Path: document.Path(), Version: fmt.Sprint(document.Version()), Written: this.now().UTC()}
+	if path := partitioned.ManifestPath(); len(path) > 0 {
+		this.update(path, func() indexDocument { return newPartitionManifest(path) }, partition)
+	}
+	if path := partitioned.LatestPath(); len(path) > 0 && latest {
+		this.update(path, func() indexDocument { return newLatestPartition(path) }, partition)
+	}
+}
+func (this *partitionIndex) update(path string, create func() indexDocument, partition Partition) {
+	document, found := this.documents[path]
+	if !found {
+		document = create()
+		this.read(document)
+		this.documents[path] = document
+	}
+
+	for document.Record(partition) {
+		err := this.storage.Write(document)
+		if err == nil {
+			return
+		} else if err != persist.ErrConcurrentWrite {
+			log.Printf("[WARN] Unable to write partition index [%s]: %s", path, err)
+			this.sleep(time.Second * 5)
+		}
+
+		document.Reset()
+		this.read(document)
+	}
+}
+func (this *partitionIndex) read(document indexDocument) {
+	for {
+		err := this.storage.Read(document)
+		if err == nil {
+			return
+		}
+
+		log.Printf("[WARN] Unable to read partition index [%s]: %s", document.Path(), err)
+		document.Reset()
+		this.sleep(time.Second * 5)
+	}
+}
+
+// indexDocument records a partition, reporting whether the partition was new or its version
+// changed (and so whether the index needs to be written).
+type indexDocument interface {
+	projector.Document
+	Record(Partition) bool
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// PartitionManifest lists every partition written, in the order first written.
+type PartitionManifest struct {
+	projector.VersionInfo
+	path       string
+	Partitions []Partition
+}
+
+func newPartitionManifest(path string) *PartitionManifest {
+	return &PartitionManifest{path: path}
+}
+
+func (this *PartitionManifest) Record(partition Partition) bool {
+	for i := range this.Partitions {
+		if this.Partitions[i].Path != partition.Path {
+			continue
+		} else if this.Partitions[i].Version == partition.Version {
+			return false
+		}
+		this.Partitions[i] = partition
+		return true
+	}
+	this.Partitions = append(this.Partitions, partition)
+	return true
+}
+
+func (this *PartitionManifest) Lapse(time.Time) projector.Document { return this }
+func (this *PartitionManifest) Apply(interface{}) bool             { return false }
+func (this *PartitionManifest) Path() string                       { return this.path }
+func (this *PartitionManifest) Reset()                             { this.Partitions = nil; this.VersionInfo.Reset() }
+
+// LatestPartition names the partition most recently written.
+type LatestPartition struct {
+	projector.VersionInfo
+	path   string
+	Latest Partition
+}
+
+func newLatestPartition(path string) *LatestPartition {
+	return &LatestPartition{path: path}
+}
+
+func (this *LatestPartition) Record(partition Partition) bool {
+	if this.Latest.Path == partition.Path && this.Latest.Version == partition.Version {
+		return false
+	}
+	this.Latest = partition
+	return true
+}
+
+func (this *LatestPartition) Lapse(time.Time) projector.Document { return this }
+func (this *LatestPartition) Apply(interface{}) bool             { return false }
+func (this *LatestPartition) Path() string                       { return this.path }
+func (this *LatestPartition) Reset()                             { this.Latest = Partition{}; this.VersionInfo.Reset() }
@@ -0,0 +1,117 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/projector/persist/mempersist"
+)
+
+func TestPartitionsFixture(t *testing.T) {
+	gunit.Run(new(PartitionsFixture), t)
+}
+
+type PartitionsFixture struct {
+	*gunit.Fixture
+
+	storage *mempersist.ReadWriter
+	hour    time.Time
+}
+
+func (this *PartitionsFixture) Setup() {
+	this.storage = mempersist.NewReadWriter()
+	this.hour = time.Date(2020, 1, 2, 3, 0, 0, 0, time.UTC)
+}
+
+func (this *PartitionsFixture) TestManifestAndLatestRecordEveryPartitionWritten() {
+	transformer := newTransformer(this.storage, newHourlyTotal(this.hour))
+
+	transformer.Transform(this.hour, []interface{}{1})
+	transformer.Transform(this.hour.Add(time.Hour), []interface{}{2})
+
+	manifest := this.manifest()
+	this.So(manifest.Partitions, should.HaveLength, 2)
+	this.So(manifest.Partitions[0].Path, should.Equal, "/total/2020-01-02T03")
+	this.So(manifest.Partitions[0].Version, should.Equal, "2") // once written, once sealed
+	this.So(manifest.Partitions[1].Path, should.Equal, "/total/2020-01-02T04")
+	this.So(manifest.Partitions[1].Version, should.Equal, "1")
+	this.So(manifest.Partitions[1].Written, should.NotBeZeroValue)
+
+	latest := newLatestPartition("/total/latest.json")
+	this.So(this.storage.Read(latest), should.BeNil)
+	this.So(latest.Latest, should.Resemble, manifest.Partitions[1])
+}
+
+func (this *PartitionsFixture) TestPartitionsWrittenByAnotherProcessKept() {
+	first := newTransformer(this.storage, newHourlyTotal(this.hour))
+	second := newTransformer(this.storage, newHourlyTotal(this.hour.Add(-time.Hour)))
+
+	first.Transform(this.hour, []interface{}{1})
+	second.Transform(this.hour.Add(-time.Hour), []interface{}{2})
+	first.Transform(this.hour, []interface{}{3}) // conflicts, reads, and retries
+
+	manifest := this.manifest()
+	this.So(manifest.Partitions, should.HaveLength, 2)
+	this.So(manifest.Partitions[0].Path, should.Equal, "/total/2020-01-02T03")
+	this.So(manifest.Partitions[0].Version, should.Equal, "2")
+	this.So(manifest.Partitions[1].Path, should.Equal, "/total/2020-01-02T02")
+}
+
+func (this *PartitionsFixture) TestPartitionAtSameVersionNotRecordedAgain() {
+	recorder := &FakePathRecorder{ReadWriter: this.storage}
+	index := newPartitionIndex(recorder)
+	document := newHourlyTotal(this.hour)
+	this.So(this.storage.Write(document), should.BeNil)
+
+	index.Written(document, true)
+	index.Written(document, true)
+	newPartitionIndex(recorder).Written(document, true) // read from storage, already recorded
+
+	this.So(recorder.paths, should.Resemble, []string{"/total/index.json", "/total/latest.json"})
+}
+
+func (this *PartitionsFixture) TestIndexWritesRetriedUntilRecorded() {
+	storage := &FakeRefusingStorage{ReadWriter: this.storage, conflicts: 5, refusals: 1}
+	index := newPartitionIndex(storage)
+	var naps []time.Duration
+	index.sleep = func(nap time.Duration) { naps = append(naps, nap) }
+	document := newHourlyTotal(this.hour)
+	this.So(this.storage.Write(document), should.BeNil)
+
+	index.Written(document, false)
+
+	manifest := this.manifest()
+	this.So(manifest.Partitions, should.HaveLength, 1)
+	this.So(manifest.Partitions[0].Path, should.Equal, "/total/2020-01-02T03")
+	this.So(naps, should.Resemble, []time.Duration{time.Second * 5})
+}
+
+func (this *PartitionsFixture) manifest() *PartitionManifest {
+	manifest := newPartitionManifest("/total/index.json")
+	this.So(this.storage.Read(manifest), should.BeNil)
+	return manifest
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeRefusingStorage struct {
+	persist.ReadWriter
+	conflicts int
+	refusals  int
+}
+
+func (this *FakeRefusingStorage) Write(document projector.Document) error {
+	if this.conflicts > 0 {
+		this.conflicts--
+		return persist.ErrConcurrentWrite
+	} else if this.refusals > 0 {
+		this.refusals--
+		return errors.New("refused")
+	}
+	return this.ReadWriter.Write(document)
+}
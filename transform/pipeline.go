@@ -0,0 +1,180 @@
+package transform
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+// DocumentProgress describes how far a document has progressed through the batches
+// handed to it; Committed trails Queued while batches wait to be applied and written.
+type DocumentProgress struct {
+	Path      string
+	Committed uint64
+	Queued    uint64
+}
+
+// pipelinedTransformer gives each document a goroutine and a queue of its own so that a
+// document which is slow to write, or stuck retrying, doesn't hold back the others until
+// its queue is full. Batches are numbered; every document commits them in order.
+type pipelinedTransformer struct {
+	pipelines  []*documentPipeline
+	quarantine *quarantine
+	committed  chan struct{}
+	waiter     sync.WaitGroup
+	sequence   uint64
+}
+
+func newPipelinedTransformer(store persist.ReadWriter, capacity int, documents ...projector.Document) *pipelinedTransformer {
+	this := &pipelinedTransformer{quarantine: newQuarantine(), committed: make(chan struct{}, 1)}
+	for _, document := range documents {
+		transformer := newSimpleTransformer(document, store).withQuarantine(this.quarantine)
+		this.pipelines = append(this.pipelines, newDocumentPipeline(transformer, capacity, this.committed))
+	}
+
+	this.waiter.Add(len(this.pipelines))
+	for _, pipeline := range this.pipelines {
+		go this.run(pipeline)
+	}
+
+	return this
+}
+func (this *pipelinedTransformer) run(pipeline *documentPipeline) {
+	pipeline.Listen()
+	this.waiter.Done()
+}
+
+// WithChangePublisher publishes every write committed (see Handler.WithChangePublisher); it must
+// be called before the first batch is queued.
+func (this *pipelinedTransformer) WithChangePublisher(publisher ChangePublisher, patches bool) *pipelinedTransformer {
+	publication := newChangePublication(publisher, patches)
+	for _, pipeline := range this.pipelines {
+		pipeline.transformer.withChangePublication(publication)
+	}
+	return this
+}
+
+// WithAllowedLateness keeps outgoing documents open to late messages (see Handler.WithAllowedLateness);
+// it must be called before the first batch is queued.
+func (this *pipelinedTransformer) WithAllowedLateness(lateness time.Duration) *pipelinedTransformer {
+	for _, pipeline := range this.pipelines {
+		pipeline.transformer.withAllowedLateness(lateness)
+	}
+	return this
+}
+
+// Transform queues the messages for every document and gives back the sequence of the batch.
+func (this *pipelinedTransformer) Transform(now time.Time, messages []interface{}) uint64 {
+	this.sequence++
+	batch := pipelineBatch{sequence: this.sequence, now: now, messages: append([]interface{}{}, messages...)}
+	for _, pipeline := range this.pipelines {
+		pipeline.Enqueue(batch)
+	}
+	return this.sequence
+}
+
+// Committed signals (without blocking) whenever a document has committed a batch.
+func (this *pipelinedTransformer) Committed() <-chan struct{} { return this.committed }
+
+// CommittedThrough is the sequence of the last batch committed by every document.
+func (this *pipelinedTransformer) CommittedThrough() uint64 {
+	through := this.sequence
+	for _, pipeline := range this.pipelines {
+		if progress := pipeline.Progress(); progress.Committed < through {
+			through = progress.Committed
+		}
+	}
+	return through
+}
+
+func (this *pipelinedTransformer) Progress() (progress []DocumentProgress) {
+	for _, pipeline := range this.pipelines {
+		progress = append(progress, pipeline.Progress())
+	}
+	return progress
+}
+
+// Close stops the pipelines once they have transformed the batches already queued.
+func (this *pipelinedTransformer) Close() {
+	for _, pipeline := range this.pipelines {
+		pipeline.Close()
+	}
+}
+
+// Wait blocks until every pipeline has stopped.
+func (this *pipelinedTransformer) Wait() { this.waiter.Wait() }
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type pipelineBatch struct {
+	sequence uint64
+	now      time.Time
+	messages []interface{}
+}
+
+type documentPipeline struct {
+	transformer *simpleTransformer
+	queue       chan pipelineBatch
+	committed   chan<- struct{}
+
+	mutex    sync.Mutex
+	progress DocumentProgress
+}
+
+func newDocumentPipeline(transformer *simpleTransformer, capacity int, committed chan<- struct{}) *documentPipeline {
+	return &documentPipeline{
+		transformer: transformer,
+		queue:       make(chan pipelineBatch, capacity),
+		committed:   committed,
+		progress:    DocumentProgress{Path: transformer.document.Path()},
+	}
+}
+
+func (this *documentPipeline) Enqueue(batch pipelineBatch) {
+	this.mutex.Lock()
+	this.progress.Queued = batch.sequence
+	progress := this.progress
+	this.mutex.Unlock()
+
+	select {
+	case this.queue <- batch:
+	default:
+		log.Printf("[WARN] Document [%s] is holding back acknowledgement at batch %d of %d (queue full).",
+			progress.Path, progress.Committed, progress.Queued)
+		this.queue <- batch
+	}
+}
+func (this *documentPipeline) Close() { close(this.queue) }
+
+// Listen transforms the batches queued; a batch doesn't commit once the document has halted, so
+// that its receipt isn't acknowledged, but the handler is signaled all the same so that it stops.
+func (this *documentPipeline) Listen() {
+	for batch := range this.queue {
+		this.transformer.Transform(batch.now, batch.messages)
+		if !this.transformer.halted {
+			this.commit(batch.sequence)
+		}
+		this.signal()
+	}
+}
+func (this *documentPipeline) commit(sequence uint64) {
+	this.mutex.Lock()
+	this.progress.Committed = sequence
+	this.progress.Path = this.transformer.document.Path()
+	this.mutex.Unlock()
+}
+func (this *documentPipeline) signal() {
+	select {
+	case this.committed <- struct{}{}:
+	default: // a signal is already pending
+	}
+}
+
+func (this *documentPipeline) Progress() DocumentProgress {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.progress
+}
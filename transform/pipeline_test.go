@@ -0,0 +1,118 @@
+package transform
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/messaging/v2"
+	"github.com/smartystreets/projector"
+)
+
+func TestPipelineFixture(t *testing.T) {
+	gunit.Run(new(PipelineFixture), t)
+}
+
+type PipelineFixture struct {
+	*gunit.Fixture
+
+	input    chan messaging.Delivery
+	output   chan interface{}
+	store    *FakeGatedStorage
+	healthy  *FakeDocument
+	stuck    *FakeDocument
+	handler  *Handler
+	finished chan struct{}
+}
+
+func (this *PipelineFixture) Setup() {
+	this.input = make(chan messaging.Delivery) // unbuffered: every delivery is a batch
+	this.output = make(chan interface{}, 16)
+	this.healthy = &FakeDocument{index: 1}
+	this.stuck = &FakeDocument{index: 2}
+	this.store = &FakeGatedStorage{FakeStorage: NewFakeStorage(), gated: this.stuck.Path(), gate: make(chan struct{}), counts: map[string]int{}}
+	this.handler = NewPipelinedHandler(utcNow, this.input, this.output, this.store, 4, this.healthy, this.stuck)
+	this.finished = make(chan struct{})
+	go func() { this.handler.Listen(); close(this.finished) }()
+}
+
+func (this *PipelineFixture) TestWorkersNotApplicableToPipelines() {
+	this.So(func() { this.handler.WithWorkers(2) }, should.Panic)
+
+	close(this.store.gate)
+	close(this.input)
+	<-this.finished
+}
+
+func (this *PipelineFixture) TestHealthyDocumentProgressesWhileAnotherIsStuck() {
+	this.input <- messaging.Delivery{Message: 1, Receipt: 11}
+	this.input <- messaging.Delivery{Message: 2, Receipt: 12}
+
+	this.So(this.eventually(func() bool { return this.store.countWrites(this.healthy.Path()) == 2 }), should.BeTrue)
+	this.So(this.output, should.BeEmpty)
+	this.So(this.handler.Progress(), should.Resemble, []DocumentProgress{
+		{Path: this.healthy.Path(), Committed: 2, Queued: 2},
+		{Path: this.stuck.Path(), Committed: 0, Queued: 2},
+	})
+
+	close(this.store.gate)
+	close(this.input)
+	<-this.finished
+
+	var receipts []interface{}
+	for receipt := range this.output {
+		receipts = append(receipts, receipt)
+	}
+	this.So(receipts, should.NotBeEmpty)
+	this.So(receipts[len(receipts)-1], should.Equal, 12)
+}
+
+func (this *PipelineFixture) TestReceiptsReleasedOnceEveryDocumentCommits() {
+	close(this.store.gate)
+
+	this.input <- messaging.Delivery{Message: 1, Receipt: 11}
+
+	this.So(<-this.output, should.Equal, 11)
+	close(this.input)
+	<-this.finished
+	this.So(<-this.output, should.BeNil) // channel closed
+}
+
+func (this *PipelineFixture) eventually(condition func() bool) bool {
+	for attempt := 0; attempt < 100; attempt++ {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeGatedStorage struct {
+	*FakeStorage
+	gated  string
+	gate   chan struct{}
+	mutex  sync.Mutex
+	counts map[string]int
+}
+
+func (this *FakeGatedStorage) Write(document projector.Document) error {
+	if document.Path() == this.gated {
+		<-this.gate
+	}
+
+	this.mutex.Lock()
+	this.counts[document.Path()]++
+	this.mutex.Unlock()
+
+	return this.FakeStorage.Write(document)
+}
+func (this *FakeGatedStorage) countWrites(path string) int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.counts[path]
+}
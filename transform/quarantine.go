@@ -0,0 +1,162 @@
+package transform
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PanicPolicy determines how the handler continues once Document.Apply or Document.Lapse panics
+// or once storage has repeatedly refused to write a document.
+type PanicPolicy int
+
+const (
+	// HaltHandler stops the handler without acknowledging the batch containing the message;
+	// Listen then panics with the cause, once its output has been closed, much as the
+	// process would have crashed had the panic not been recovered.
+	HaltHandler PanicPolicy = iota
+
+	// SkipMessage continues with the next message; the document keeps any changes the
+	// offending call made before it panicked. When the document couldn't be written, the
+	// messages not yet written are skipped and the document is read once more.
+	SkipMessage
+
+	// HaltDocument stops transforming (and writing) the document, discarding its unwritten
+	// changes, while the other documents continue.
+	HaltDocument
+)
+
+// DeadLetter describes a message which could not be projected.
+type DeadLetter struct {
+	Path      string      // the path of the document
+	Operation string      // "Apply", "Lapse", "Reject", "Write", or "Late" (see below)
+	Message   interface{} // nil for Lapse
+	Error     string
+	Stack     string
+	Timestamp time.Time // when the message was dead-lettered
+
+	// the delivery of the message, which is replayed as it was delivered: its identifiers and
+	// its timestamp (the event time, in event-time mode) are zero when unknown.
+	SourceID    uint64
+	MessageID   uint64
+	MessageTime time.Time
+}
+
+// The operations of dead letters besides "Apply" and "Lapse", which panicked.
+const (
+	deadLetterRejected  = "Reject" // projector.ValidatingDocument rejected the message
+	deadLetterUnwritten = "Write"  // storage repeatedly refused to write the document
+	deadLetterLate      = "Late"   // the period of the message had been finalized
+)
+
+func newDeadLetter(path, operation string, message interface{}, reason string, now time.Time) DeadLetter {
+	at, _, untimed := untime(message)
+	id, timestamp, body := delivered(untimed)
+	if !at.IsZero() {
+		timestamp = at // the event time takes precedence over the timestamp of the delivery
+	}
+
+	return DeadLetter{
+		Path:        path,
+		Operation:   operation,
+		Message:     body,
+		Error:       reason,
+		Timestamp:   now.UTC(),
+		SourceID:    id.SourceID,
+		MessageID:   id.MessageID,
+		MessageTime: timestamp,
+	}
+}
+
+// DeadLetterSink receives the messages which could not be projected. It is called from the
+// goroutines of every document and must therefore be safe for concurrent use.
+type DeadLetterSink interface {
+	DeadLetter(DeadLetter) error
+}
+
+// quarantine is shared by the transformers of a handler; it records what panicked and
+// signals the handler when the policy calls for it to halt.
+type quarantine struct {
+	policy PanicPolicy
+	sink   DeadLetterSink
+	now    func() time.Time
+	halted int32
+	mutex  sync.Mutex
+	cause  string // why the handler halted
+}
+
+func newQuarantine() *quarantine {
+	return &quarantine{policy: HaltHandler, now: time.Now}
+}
+
+func (this *quarantine) Halted() bool { return atomic.LoadInt32(&this.halted) == 1 }
+
+// Cause describes what halted the handler, if anything did.
+func (this *quarantine) Cause() string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.cause
+}
+
+// Recover records the panic and reports whether the document may continue.
+func (this *quarantine) Recover(path, operation string, message, recovered interface{}) bool {
+	letter := newDeadLetter(path, operation, message, fmt.Sprint(recovered), this.now())
+	letter.Stack = string(debug.Stack())
+	log.Printf("[ERROR] Document [%s] panicked during %s of message [%#v]: %s\n%s",
+		letter.Path, letter.Operation, letter.Message, letter.Error, letter.Stack)
+
+	this.send(letter)
+	return this.continues(path, fmt.Sprintf("document [%s] panicked during %s: %s", path, operation, letter.Error))
+}
+
+// Abandon records the messages which storage repeatedly refused to write (e.g. because the
+// document no longer serializes) and reports whether the document may continue.
+func (this *quarantine) Abandon(path string, messages []interface{}, err error) bool {
+	log.Printf("[ERROR] Document [%s] could not be written, abandoning %d message(s): %s", path, len(messages), err)
+	for _, message := range messages {
+		this.send(newDeadLetter(path, deadLetterUnwritten, message, err.Error(), this.now()))
+	}
+
+	return this.continues(path, fmt.Sprintf("document [%s] could not be written: %s", path, err))
+}
+func (this *quarantine) continues(path, cause string) bool {
+	switch this.policy {
+	case SkipMessage:
+		return true
+	case HaltDocument:
+		log.Printf("[WARN] Document [%s] halted; it will no longer be transformed.", path)
+		return false
+	default:
+		this.halt(cause)
+		return false
+	}
+}
+
+func (this *quarantine) halt(cause string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if len(this.cause) == 0 {
+		this.cause = cause // the first of the documents to halt
+	}
+	atomic.StoreInt32(&this.halted, 1)
+}
+
+// Reject records a message which was not applied (but which didn't panic) so that it can be
+// examined and replayed; the policy doesn't apply.
+func (this *quarantine) Reject(path, operation string, message interface{}, reason string) {
+	letter := newDeadLetter(path, operation, message, reason, this.now())
+	log.Printf("[WARN] Document [%s] rejected message [%#v] during %s: %s", path, letter.Message, operation, reason)
+	this.send(letter)
+}
+func (this *quarantine) send(letter DeadLetter) {
+	if this.sink == nil {
+		return
+	}
+	if err := this.sink.DeadLetter(letter); err != nil {
+		log.Printf("[WARN] Unable to dead-letter message for document [%s]: %s", letter.Path, err)
+	}
+}
@@ -0,0 +1,207 @@
+package transform
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/messaging/v2"
+	"github.com/smartystreets/projector"
+)
+
+func TestQuarantineFixture(t *testing.T) {
+	gunit.Run(new(QuarantineFixture), t)
+}
+
+type QuarantineFixture struct {
+	*gunit.Fixture
+
+	store    *FakeStorage
+	sink     *FakeDeadLetterSink
+	poisoned *PoisonedDocument
+	healthy  *FakeDocument
+	handler  *Handler
+	input    chan messaging.Delivery
+	output   chan interface{}
+}
+
+func (this *QuarantineFixture) Setup() {
+	this.store = NewFakeStorage()
+	this.sink = &FakeDeadLetterSink{}
+	this.poisoned = &PoisonedDocument{}
+	this.healthy = &FakeDocument{index: 1}
+	this.input = make(chan messaging.Delivery, 16)
+	this.output = make(chan interface{}, 16)
+	this.handler = NewConfigurableHandler(utcNow, this.input, this.output, this.store, this.poisoned, this.healthy).
+		WithDeadLetters(this.sink)
+}
+
+func (this *QuarantineFixture) listen(messages ...interface{}) {
+	for i, message := range messages {
+		this.input <- messaging.Delivery{Message: message, Receipt: i}
+	}
+	close(this.input)
+	this.handler.Listen()
+}
+
+func (this *QuarantineFixture) TestPoisonMessageSkipped() {
+	this.handler = NewConfigurableHandler(utcNow, this.input, this.output, this.store, this.poisoned).
+		WithDeadLetters(this.sink).
+		WithPanicPolicy(SkipMessage)
+	this.store.writeErrorCount = 1 // the messages are reapplied after the conflict
+
+	this.listen(1, "poison", 2)
+
+	this.So(this.poisoned.applied, should.Resemble, []interface{}{1, 2, 1, 2})
+	this.So(this.sink.letters, should.HaveLength, 1)
+	this.So(this.sink.letters[0].Path, should.Equal, this.poisoned.Path())
+	this.So(this.sink.letters[0].Operation, should.Equal, "Apply")
+	this.So(this.sink.letters[0].Message, should.Equal, "poison")
+	this.So(this.sink.letters[0].Error, should.Equal, "poisoned!")
+	this.So(this.sink.letters[0].Stack, should.NotBeBlank)
+	this.So(<-this.output, should.Equal, 2)
+}
+
+func (this *QuarantineFixture) TestPoisonedDocumentHalted() {
+	this.handler.WithPanicPolicy(HaltDocument)
+
+	this.listen(1, "poison", 2)
+	this.handler.transformer.Transform(utcNow(), []interface{}{3})
+
+	this.So(this.poisoned.applied, should.Resemble, []interface{}{1})
+	this.So(this.store.writes[this.poisoned.Path()], should.BeNil)
+	this.So(this.store.writes[this.healthy.Path()], should.Equal, this.healthy)
+	this.So(this.healthy.messages, should.Resemble, []interface{}{1, "poison", 2, 3})
+	this.So(<-this.output, should.Equal, 2)
+}
+
+func (this *QuarantineFixture) TestHandlerHaltedWithoutAcknowledging() {
+	this.So(func() { this.listen(1, "poison", 2) }, should.PanicWith,
+		"[ERROR] Handler halted without acknowledging the batch: document ["+this.poisoned.Path()+"] panicked during Apply: poisoned!")
+
+	this.So(this.sink.letters, should.HaveLength, 1)
+	this.So(this.store.writes[this.poisoned.Path()], should.BeNil)
+	this.So(<-this.output, should.BeNil) // closed without a receipt
+}
+
+func (this *QuarantineFixture) TestPipelinedHandlerHaltedWithoutAcknowledging() {
+	this.handler = NewPipelinedHandler(utcNow, this.input, this.output, this.store, 4, this.poisoned, this.healthy).
+		WithDeadLetters(this.sink)
+
+	this.So(func() { this.listen(1, "poison", 2) }, should.Panic)
+
+	this.So(this.handler.Progress(), should.Resemble, []DocumentProgress{
+		{Path: this.poisoned.Path(), Committed: 0, Queued: 1},
+		{Path: this.healthy.Path(), Committed: 1, Queued: 1},
+	})
+	this.So(this.sink.letters, should.HaveLength, 1)
+	this.So(<-this.output, should.BeNil) // closed without a receipt
+}
+
+func (this *QuarantineFixture) TestLapsePanicSkipped() {
+	this.handler.WithPanicPolicy(SkipMessage)
+	this.poisoned.lapsePanics = true
+
+	this.listen(1)
+
+	this.So(this.sink.letters, should.HaveLength, 1)
+	this.So(this.sink.letters[0].Operation, should.Equal, "Lapse")
+	this.So(this.sink.letters[0].Message, should.BeNil)
+	this.So(this.poisoned.applied, should.Resemble, []interface{}{1})
+	this.So(this.store.writes[this.poisoned.Path()], should.Equal, this.poisoned)
+}
+
+func (this *QuarantineFixture) TestRejectedMessageDeadLetteredAsDelivered() {
+	validated := &ValidatedDocument{}
+	this.handler = NewConfigurableHandler(utcNow, this.input, this.output, this.store, validated).WithDeadLetters(this.sink)
+	delivered := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	this.input <- messaging.Delivery{SourceID: 1, MessageID: 2, Timestamp: delivered, Message: "invalid"}
+
+	this.listen(1)
+
+	this.So(validated.applied, should.Resemble, []interface{}{1})
+	this.So(this.sink.letters, should.HaveLength, 1)
+	this.So(this.sink.letters[0].Operation, should.Equal, "Reject")
+	this.So(this.sink.letters[0].Message, should.Equal, "invalid")
+	this.So(this.sink.letters[0].Error, should.Equal, "not valid")
+	this.So(this.sink.letters[0].SourceID, should.Equal, 1)
+	this.So(this.sink.letters[0].MessageID, should.Equal, 2)
+	this.So(this.sink.letters[0].MessageTime, should.Equal, delivered)
+	this.So(<-this.output, should.Equal, 0)
+}
+
+func (this *QuarantineFixture) TestRepeatedlyRefusedWritesAbandoned() {
+	this.handler = NewConfigurableHandler(utcNow, this.input, this.output, this.store, this.poisoned).
+		WithDeadLetters(this.sink).
+		WithPanicPolicy(SkipMessage)
+	this.store.writeErrorCount, this.store.writeError = 100, errors.New("refused")
+
+	this.listen(1, 2)
+
+	this.So(this.store.writeCount, should.Equal, maxRefusedWrites)
+	this.So(this.sink.letters, should.HaveLength, 2)
+	this.So(this.sink.letters[0].Operation, should.Equal, "Write")
+	this.So(this.sink.letters[0].Error, should.Equal, "refused")
+	this.So(this.sink.letters[1].Message, should.Equal, 2)
+	this.So(<-this.output, should.Equal, 1)
+}
+
+func (this *QuarantineFixture) TestRepeatedlyRefusedWritesHaltHandler() {
+	this.store.writeErrorCount, this.store.writeError = 100, errors.New("refused")
+
+	this.So(func() { this.listen(1) }, should.Panic)
+
+	this.So(this.sink.letters, should.HaveLength, 2) // one for each document
+	this.So(<-this.output, should.BeNil)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type FakeDeadLetterSink struct {
+	mutex   sync.Mutex
+	letters []DeadLetter
+}
+
+func (this *FakeDeadLetterSink) DeadLetter(letter DeadLetter) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.letters = append(this.letters, letter)
+	return nil
+}
+
+type PoisonedDocument struct {
+	applied     []interface{}
+	lapsePanics bool
+}
+
+func (this *PoisonedDocument) Lapse(time.Time) projector.Document {
+	if this.lapsePanics {
+		panic("lapse poisoned!")
+	}
+	return this
+}
+func (this *PoisonedDocument) Apply(message interface{}) bool {
+	if message == "poison" {
+		panic("poisoned!")
+	}
+	this.applied = append(this.applied, message)
+	return true
+}
+
+type ValidatedDocument struct{ PoisonedDocument }
+
+func (this *ValidatedDocument) Lapse(time.Time) projector.Document { return this }
+func (this *ValidatedDocument) Validate(message interface{}) error {
+	if message == "invalid" {
+		return errors.New("not valid")
+	}
+	return nil
+}
+
+func (this *PoisonedDocument) Path() string           { return "/poisoned" }
+func (this *PoisonedDocument) Reset()                 {}
+func (this *PoisonedDocument) SetVersion(interface{}) {}
+func (this *PoisonedDocument) Version() interface{}   { return nil }
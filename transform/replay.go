@@ -0,0 +1,164 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/smartystreets/messaging/v2"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+)
+
+// ArchivedMessage is a single line of an archived message stream (NDJSON); the message is kept
+// as JSON along with the name of its type (see MessageTypes) so that it can be replayed later.
+type ArchivedMessage struct {
+	MessageType string
+	Timestamp   time.Time
+	SourceID    uint64 `json:",omitempty"`
+	MessageID   uint64 `json:",omitempty"`
+	Message     json.RawMessage
+}
+
+func NewArchivedMessage(delivery messaging.Delivery) (ArchivedMessage, error) {
+	message, err := json.Marshal(delivery.Message)
+	if err != nil {
+		return ArchivedMessage{}, err
+	}
+
+	return ArchivedMessage{
+		MessageType: MessageTypeName(delivery.Message),
+		Timestamp:   delivery.Timestamp,
+		SourceID:    delivery.SourceID,
+		MessageID:   delivery.MessageID,
+		Message:     message,
+	}, nil
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+// Replay rebuilds documents from an archived message stream, e.g. for a new kind of document
+// or after a projection has been fixed. The messages are transformed in large batches, each
+// batch at the time of its first message (so that Lapse sees the time at which the messages
+// were originally received), and the documents are written every so many messages.
+type Replay struct {
+	storage    persist.ReadWriter
+	types      *MessageTypes
+	documents  []projector.Document
+	batchSize  int
+	resolution time.Duration
+}
+
+func NewReplay(storage persist.ReadWriter, types *MessageTypes, documents ...projector.Document) *Replay {
+	return &Replay{
+		storage:    storage,
+		types:      types,
+		documents:  documents,
+		batchSize:  defaultReplayBatchSize,
+		resolution: defaultReplayResolution,
+	}
+}
+
+// WithTargetPrefix writes (and reads) the documents beneath the prefix provided rather than at
+// their own paths, so that the documents in use aren't disturbed by the rebuild.
+func (this *Replay) WithTargetPrefix(prefix string) *Replay {
+	this.storage = persist.NewPrefixedReadWriter(this.storage, prefix)
+	return this
+}
+
+// WithBatchSize bounds the number of messages transformed at once and written at once.
+func (this *Replay) WithBatchSize(size int) *Replay {
+	this.batchSize = size
+	return this
+}
+
+// WithClockResolution starts a new batch whenever the time of the messages crosses a multiple
+// of the resolution; it should be no longer than the shortest period of the documents.
+func (this *Replay) WithClockResolution(resolution time.Duration) *Replay {
+	this.resolution = resolution
+	return this
+}
+
+// Replay transforms every message of the archive and writes the documents, giving back the
+// number of messages transformed.
+func (this *Replay) Replay(archive io.Reader) (int, error) {
+	transformer := newMultiTransformer(this.storage, true, this.documents)
+	decoder := json.NewDecoder(archive)
+
+	var (
+		batch     []interface{}
+		clock     time.Time
+		bucket    time.Time
+		unflushed int
+		count     int
+	)
+
+	transform := func() error {
+		transformer.Transform(clock, batch)
+		unflushed += len(batch)
+		batch = batch[0:0]
+		if unflushed >= this.batchSize {
+			transformer.Flush()
+			unflushed = 0
+		}
+		if transformer.quarantine.Halted() {
+			return ErrReplayHalted
+		}
+		return nil
+	}
+
+	for {
+		var record ArchivedMessage
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return count, fmt.Errorf("archived message %d could not be read: %s", count+1, err)
+		}
+
+		message, err := this.types.Decode(record.MessageType, record.Message)
+		if err != nil {
+			return count, err
+		}
+
+		timestamp := record.Timestamp
+		if timestamp.IsZero() {
+			timestamp = clock
+		}
+		if len(batch) > 0 && (len(batch) >= this.batchSize || timestamp.Truncate(this.resolution) != bucket) {
+			if err = transform(); err != nil {
+				return count, err
+			}
+		}
+		if len(batch) == 0 {
+			clock, bucket = timestamp, timestamp.Truncate(this.resolution)
+		}
+
+		batch = append(batch, identify(messaging.Delivery{
+			SourceID:  record.SourceID,
+			MessageID: record.MessageID,
+			Message:   message,
+		}))
+		count++
+	}
+
+	if len(batch) > 0 {
+		if err := transform(); err != nil {
+			return count, err
+		}
+	}
+
+	transformer.Flush()
+	if transformer.quarantine.Halted() {
+		return count, ErrReplayHalted
+	}
+	return count, nil
+}
+
+var ErrReplayHalted = errors.New("replay halted: a document panicked")
+
+const (
+	defaultReplayBatchSize  = 10000
+	defaultReplayResolution = time.Minute
+)
@@ -0,0 +1,57 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/smartystreets/messaging/v2"
+)
+
+// ReadDeadLetters decodes the records written by FileDeadLetters.
+func ReadDeadLetters(reader io.Reader) (records []DeadLetterRecord, err error) {
+	decoder := json.NewDecoder(reader)
+	for {
+		var record DeadLetterRecord
+		if err = decoder.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("dead letter %d could not be read: %s", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// ReplayDeadLetters decodes the message of every record (those of Lapse carry none) and, once
+// all of them have been decoded, sends them in order to the input of a handler, giving back
+// the number sent. Each message is delivered with its original identifiers and timestamp, for
+// deduplication and event time (see Handler.WithEventTime). As the other documents of the
+// original handler may well have applied the messages, the handler should be given only the
+// documents named by the Path of the records.
+func ReplayDeadLetters(records []DeadLetterRecord, types *MessageTypes, input chan<- messaging.Delivery) (int, error) {
+	var deliveries []messaging.Delivery
+	for _, record := range records {
+		if len(record.MessageType) == 0 {
+			continue
+		}
+
+		message, err := types.Decode(record.MessageType, record.Message)
+		if err != nil {
+			return 0, err
+		}
+
+		deliveries = append(deliveries, messaging.Delivery{
+			SourceID:    record.SourceID,
+			MessageID:   record.MessageID,
+			MessageType: record.MessageType,
+			Timestamp:   record.MessageTime,
+			Message:     message,
+		})
+	}
+
+	for _, delivery := range deliveries {
+		input <- delivery
+	}
+
+	return len(deliveries), nil
+}
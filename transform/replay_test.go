@@ -0,0 +1,125 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/messaging/v2"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/projector/persist/mempersist"
+)
+
+func TestReplayFixture(t *testing.T) {
+	gunit.Run(new(ReplayFixture), t)
+}
+
+type ReplayFixture struct {
+	*gunit.Fixture
+
+	storage *mempersist.ReadWriter
+	types   *MessageTypes
+	archive *bytes.Buffer
+	day     time.Time
+}
+
+func (this *ReplayFixture) Setup() {
+	this.storage = mempersist.NewReadWriter()
+	this.types = NewMessageTypes(OrderPlaced{})
+	this.archive = new(bytes.Buffer)
+	this.day = time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+}
+
+func (this *ReplayFixture) archiveMessage(timestamp time.Time, id uint64, message interface{}) {
+	record, _ := NewArchivedMessage(messaging.Delivery{SourceID: 1, MessageID: id, Timestamp: timestamp, Message: message})
+	raw, _ := json.Marshal(record)
+	this.archive.Write(append(raw, '\n'))
+}
+
+func (this *ReplayFixture) TestDocumentsRebuiltBeneathPrefixAtTimeOfMessages() {
+	this.archiveMessage(this.day.Add(time.Hour), 1, OrderPlaced{ID: 1})
+	this.archiveMessage(this.day.Add(time.Hour+time.Second), 2, OrderPlaced{ID: 2})
+	this.archiveMessage(this.day.Add(23*time.Hour), 3, OrderPlaced{ID: 3})
+	this.archiveMessage(this.day.Add(25*time.Hour), 4, OrderPlaced{ID: 4})
+	this.archiveMessage(this.day.Add(25*time.Hour), 4, OrderPlaced{ID: 4}) // redelivered
+
+	count, err := NewReplay(this.storage, this.types, newDailyOrders(this.day)).
+		WithTargetPrefix("rebuild").
+		WithBatchSize(2).
+		Replay(this.archive)
+
+	this.So(err, should.BeNil)
+	this.So(count, should.Equal, 5)
+	this.So(this.load("rebuild", this.day).Orders, should.Equal, 3)
+	this.So(this.load("rebuild", this.day.Add(24*time.Hour)).Orders, should.Equal, 1)
+	this.So(this.load("", this.day).Version(), should.BeEmpty) // the live document is untouched
+}
+func (this *ReplayFixture) load(prefix string, day time.Time) *DailyOrders {
+	document := newDailyOrders(day)
+	this.So(persist.NewPrefixedReadWriter(this.storage, prefix).Read(document), should.BeNil)
+	return document
+}
+
+func (this *ReplayFixture) TestUnregisteredTypeStopsReplay() {
+	this.archiveMessage(this.day, 1, OrderPlaced{ID: 1})
+	this.archiveMessage(this.day, 2, OrderShipped{ID: 1})
+
+	count, err := NewReplay(this.storage, this.types, newDailyOrders(this.day)).Replay(this.archive)
+
+	this.So(err, should.NotBeNil)
+	this.So(count, should.Equal, 1)
+}
+
+func (this *ReplayFixture) TestPanickingDocumentHaltsReplay() {
+	this.archiveMessage(this.day, 1, OrderPlaced{ID: -1})
+
+	_, err := NewReplay(this.storage, this.types, newDailyOrders(this.day)).Replay(this.archive)
+
+	this.So(err, should.Equal, ErrReplayHalted)
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type DailyOrders struct {
+	projector.DeliveryWindow
+	projector.VersionInfo
+	date   time.Time
+	Orders int
+}
+
+func newDailyOrders(date time.Time) *DailyOrders {
+	return &DailyOrders{date: date.Truncate(24 * time.Hour)}
+}
+
+func (this *DailyOrders) Lapse(now time.Time) projector.Document {
+	if now.Truncate(24 * time.Hour).Equal(this.date) {
+		return this
+	}
+	return newDailyOrders(now)
+}
+func (this *DailyOrders) Covers(at time.Time) bool {
+	return at.Truncate(24 * time.Hour).Equal(this.date)
+}
+func (this *DailyOrders) Apply(message interface{}) bool {
+	if timed, ok := message.(OrderPlacedAt); ok {
+		message = timed.OrderPlaced
+	}
+	placed, ok := message.(OrderPlaced)
+	if ok && placed.ID < 0 {
+		panic("invalid order")
+	}
+	if ok {
+		this.Orders++
+	}
+	return ok
+}
+func (this *DailyOrders) Path() string { return "/orders/" + this.date.Format("2006-01-02") }
+func (this *DailyOrders) Reset() {
+	this.Orders = 0
+	this.DeliveryWindow.Reset()
+	this.VersionInfo.Reset()
+}
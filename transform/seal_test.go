@@ -0,0 +1,110 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartystreets/assertions/should"
+	"github.com/smartystreets/gunit"
+	"github.com/smartystreets/projector"
+	"github.com/smartystreets/projector/persist"
+	"github.com/smartystreets/projector/persist/mempersist"
+)
+
+func TestSealFixture(t *testing.T) {
+	gunit.Run(new(SealFixture), t)
+}
+
+type SealFixture struct {
+	*gunit.Fixture
+
+	storage *mempersist.ReadWriter
+	hour    time.Time
+}
+
+func (this *SealFixture) Setup() {
+	this.storage = mempersist.NewReadWriter()
+	this.hour = time.Date(2020, 1, 2, 3, 0, 0, 0, time.UTC)
+}
+
+func (this *SealFixture) TestOutgoingDocumentSealedWithClosingChangesAndCopiedToArchive() {
+	transformer := newTransformer(this.storage, newHourlyTotal(this.hour))
+
+	transformer.Transform(this.hour, []interface{}{1, 2})
+	transformer.Transform(this.hour.Add(time.Hour), []interface{}{3})
+
+	outgoing := this.load(newHourlyTotal(this.hour))
+	this.So(outgoing.Total, should.Equal, 3)
+	this.So(outgoing.Summary, should.Equal, "closed")
+	this.So(outgoing.Sealed(), should.BeTrue)
+	this.So(*outgoing.SealedAt, should.Equal, this.hour.Add(time.Hour))
+	this.So(this.load(newHourlyTotal(this.hour.Add(time.Hour))).Sealed(), should.BeFalse)
+
+	archived := newHourlyTotal(this.hour)
+	this.So(this.storage.Read(persist.NewDocumentCopy(archived, archived.ArchivePath())), should.BeNil)
+	this.So(archived.Summary, should.Equal, "closed")
+	this.So(archived.Sealed(), should.BeTrue)
+}
+
+func (this *SealFixture) TestUnchangedDocumentWrittenOnceSealed() {
+	transformer := newTransformer(this.storage, newHourlyTotal(this.hour))
+
+	transformer.Transform(this.hour, nil)
+	transformer.Transform(this.hour.Add(time.Hour), nil)
+
+	this.So(this.load(newHourlyTotal(this.hour)).Sealed(), should.BeTrue)
+}
+
+func (this *SealFixture) TestDocumentStoredBeforeRestartReadBeforeSealed() {
+	stored := newHourlyTotal(this.hour)
+	stored.Total = 5
+	this.So(this.storage.Write(stored), should.BeNil)
+	transformer := newDeferredTransformer(this.storage, newHourlyTotal(this.hour))
+
+	transformer.Transform(this.hour, []interface{}{1})
+	transformer.Transform(this.hour.Add(time.Hour), nil)
+
+	outgoing := this.load(newHourlyTotal(this.hour))
+	this.So(outgoing.Total, should.Equal, 6)
+	this.So(outgoing.Sealed(), should.BeTrue)
+}
+
+func (this *SealFixture) load(document *HourlyTotal) *HourlyTotal {
+	this.So(this.storage.Read(document), should.BeNil)
+	return document
+}
+
+/* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
+
+type HourlyTotal struct {
+	projector.SealInfo
+	projector.VersionInfo
+	hour    time.Time
+	Total   int
+	Summary string
+}
+
+func newHourlyTotal(now time.Time) *HourlyTotal {
+	return &HourlyTotal{hour: now.Truncate(time.Hour)}
+}
+
+func (this *HourlyTotal) Lapse(now time.Time) projector.Document {
+	if now.Truncate(time.Hour).Equal(this.hour) {
+		return this
+	}
+	this.Summary = "closed"
+	return newHourlyTotal(now)
+}
+func (this *HourlyTotal) Apply(message interface{}) bool {
+	this.Total += message.(int)
+	return true
+}
+func (this *HourlyTotal) Path() string         { return "/total/" + this.hour.Format("2006-01-02T15") }
+func (this *HourlyTotal) ArchivePath() string  { return "/archive" + this.Path() }
+func (this *HourlyTotal) ManifestPath() string { return "/total/index.json" }
+func (this *HourlyTotal) LatestPath() string   { return "/total/latest.json" }
+func (this *HourlyTotal) Reset() {
+	this.Total, this.Summary = 0, ""
+	this.SealInfo.Reset()
+	this.VersionInfo.Reset()
+}
@@ -2,6 +2,7 @@ package transform
 
 import (
 	"log"
+	"reflect"
 	"sync"
 	"time"
 
@@ -11,69 +12,391 @@ import (
 
 type Transformer interface {
 	Transform(time.Time, []interface{})
+
+	// Flush writes every document having changes not yet written.
+	Flush()
 }
 
 type multiTransformer struct {
 	transformers []*simpleTransformer
+	quarantine   *quarantine
 	waiter       sync.WaitGroup
+	workers      int
+	offset       int
 }
 
 func newTransformer(store persist.ReadWriter, documents ...projector.Document) Transformer {
+	return newMultiTransformer(store, false, documents)
+}
+
+// newDeferredTransformer applies messages to the documents without writing them until Flush.
+func newDeferredTransformer(store persist.ReadWriter, documents ...projector.Document) Transformer {
+	return newMultiTransformer(store, true, documents)
+}
+func newMultiTransformer(store persist.ReadWriter, deferred bool, documents []projector.Document) *multiTransformer {
+	quarantine := newQuarantine()
 	var transformers []*simpleTransformer
 	for _, document := range documents {
-		transformers = append(transformers, newSimpleTransformer(document, store))
+		transformers = append(transformers, newSimpleTransformer(document, store).
+			withDeferredWrites(deferred).
+			withQuarantine(quarantine))
 	}
 
-	return &multiTransformer{transformers: transformers}
+	return &multiTransformer{transformers: transformers, quarantine: quarantine}
 }
+
+// WithWorkers bounds the number of documents transformed (and written) concurrently; by
+// default every document has a goroutine of its own.
+func (this *multiTransformer) WithWorkers(count int) *multiTransformer {
+	this.workers = count
+	return this
+}
+
+// WithChangePublisher publishes every write committed (see Handler.WithChangePublisher).
+func (this *multiTransformer) WithChangePublisher(publisher ChangePublisher, patches bool) *multiTransformer {
+	publication := newChangePublication(publisher, patches)
+	for _, transformer := range this.transformers {
+		transformer.withChangePublication(publication)
+	}
+	return this
+}
+
+// WithAllowedLateness keeps outgoing documents open to late messages (see Handler.WithAllowedLateness).
+func (this *multiTransformer) WithAllowedLateness(lateness time.Duration) *multiTransformer {
+	for _, transformer := range this.transformers {
+		transformer.withAllowedLateness(lateness)
+	}
+	return this
+}
+
 func (this *multiTransformer) Transform(now time.Time, messages []interface{}) {
+	this.each(func(transformer *simpleTransformer) { transformer.Transform(now, messages) })
+}
+func (this *multiTransformer) Flush() {
+	this.each(func(transformer *simpleTransformer) { transformer.Flush() })
+}
+func (this *multiTransformer) each(action func(*simpleTransformer)) {
 	count := len(this.transformers)
-	this.waiter.Add(count)
+	if this.workers <= 0 || this.workers >= count {
+		this.waiter.Add(count)
+		for i := 0; i < count; i++ {
+			go this.perform(i, action) // this for loop is safe to execute because it evaluates "i" before "go"
+		}
+	} else {
+		this.waiter.Add(this.workers)
+		queue := this.schedule(count)
+		for i := 0; i < this.workers; i++ {
+			go this.work(queue, action)
+		}
+	}
+
+	this.waiter.Wait()
+}
 
+// schedule queues every document, starting each time with the document following the last
+// one started first in the previous round, so that no document consistently waits longest.
+func (this *multiTransformer) schedule(count int) <-chan int {
+	queue := make(chan int, count)
 	for i := 0; i < count; i++ {
-		go this.transform(i, now, messages) // this for loop is safe to execute because it evaluates "i" before "go"
+		queue <- (this.offset + i) % count
 	}
+	close(queue)
 
-	this.waiter.Wait()
+	this.offset = (this.offset + this.workers) % count
+	return queue
+}
+func (this *multiTransformer) work(queue <-chan int, action func(*simpleTransformer)) {
+	for index := range queue {
+		action(this.transformers[index])
+	}
+	this.waiter.Done()
 }
-func (this *multiTransformer) transform(index int, now time.Time, messages []interface{}) {
-	this.transformers[index].Transform(now, messages)
+func (this *multiTransformer) perform(index int, action func(*simpleTransformer)) {
+	action(this.transformers[index])
 	this.waiter.Done()
 }
 
 /* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
 
 type simpleTransformer struct {
-	document projector.Document
-	storage  persist.ReadWriter
+	document   projector.Document
+	storage    persist.ReadWriter
+	deferred   bool
+	pending    []interface{} // messages applied since the document was last written
+	quarantine *quarantine
+	halted     bool
+	failures   int       // consecutive writes refused by storage (other than conflicts)
+	clock      time.Time // the latest event time, when the messages carry one
+	lateness   time.Duration
+	closed     []*closedPeriod // outgoing documents kept open for late messages
+	retired    bool            // the transformer of a closed period
+	index      *partitionIndex
+	loaded     bool // whether the document has been read, when it's sealed once lapsed
+
+	publication *changePublication
+	written     []byte // the document as last written (or read), when publishing patches
 }
 
 func newSimpleTransformer(document projector.Document, storage persist.ReadWriter) *simpleTransformer {
-	return &simpleTransformer{document: document, storage: storage}
+	return &simpleTransformer{
+		document:   document,
+		storage:    storage,
+		quarantine: newQuarantine(),
+		index:      newPartitionIndex(storage),
+	}
+}
+func (this *simpleTransformer) withDeferredWrites(deferred bool) *simpleTransformer {
+	this.deferred = deferred
+	return this
+}
+func (this *simpleTransformer) withQuarantine(quarantine *quarantine) *simpleTransformer {
+	this.quarantine = quarantine
+	return this
+}
+func (this *simpleTransformer) withChangePublication(publication *changePublication) *simpleTransformer {
+	this.publication = publication
+	return this
+}
+func (this *simpleTransformer) withAllowedLateness(lateness time.Duration) *simpleTransformer {
+	this.lateness = lateness
+	return this
 }
 func (this *simpleTransformer) Transform(now time.Time, messages []interface{}) {
-	this.document = this.document.Lapse(now)
-	for this.apply(messages) && !this.save() {
+	if this.halted {
+		return
+	}
+
+	if !eventTimed(messages) {
+		this.transform(now, messages)
+	}
+	for remaining := messages; eventTimed(remaining) && !this.halted; {
+		if this.late(remaining[0]) {
+			this.route(remaining[0])
+			remaining = remaining[1:]
+			continue
+		}
+
+		var count int
+		this.clock, count = nextEventRun(this.clock, remaining, this.lateness > 0)
+		this.transform(this.clock, remaining[:count])
+		this.finalize()
+		remaining = remaining[count:]
+	}
+
+	if !this.deferred {
+		this.Flush()
 	}
 }
-func (this *simpleTransformer) apply(messages []interface{}) (modified bool) {
-	for _, message := range messages {
-		if message != nil {
-			modified = this.document.Apply(message) || modified
+func (this *simpleTransformer) transform(now time.Time, messages []interface{}) {
+	this.load()
+	next := this.lapse(now)
+	if this.halted {
+		this.pending = this.pending[0:0]
+		return
+	} else if lapsed(this.document, next) {
+		// changes to the outgoing document must not be lost and the next patch is of the new document
+		this.retire(now)
+		this.document, this.written, this.loaded = next, nil, false
+	}
+
+	this.accept(messages)
+}
+
+// lapsed reports whether Lapse gave back a document other than the current one. Documents are
+// compared by identity when they are pointers (as they usually are) and otherwise by type and
+// path, since value documents, which need not be comparable, are copied by every call.
+func lapsed(current, next projector.Document) bool {
+	from, to := reflect.ValueOf(current), reflect.ValueOf(next)
+	if from.Type() != to.Type() {
+		return true
+	} else if from.Kind() == reflect.Ptr {
+		return from.Pointer() != to.Pointer()
+	}
+	return current.Path() != next.Path()
+}
+
+// accept applies the messages to the document; once the document has unwritten changes every
+// message is kept so that all of them can be reapplied should the write be rejected in favor
+// of a newer version.
+func (this *simpleTransformer) accept(messages []interface{}) {
+	if modified, applied := this.apply(messages); modified || len(this.pending) > 0 {
+		this.pending = append(this.pending, applied...)
+	}
+}
+func (this *simpleTransformer) Flush() {
+	this.flush()
+	for _, period := range this.closed {
+		period.flush()
+	}
+}
+func (this *simpleTransformer) flush() {
+	for len(this.pending) > 0 && !this.halted && !this.save() && this.reapply() {
+	}
+
+	this.pending = this.pending[0:0]
+}
+
+// seal writes the outgoing document for the last time. Documents implementing
+// projector.SealedDocument are sealed first (and written even when unchanged) and a copy of
+// those implementing projector.ArchivedCopyDocument is then written to their archive path.
+func (this *simpleTransformer) seal(now time.Time) {
+	sealed, ok := this.document.(projector.SealedDocument)
+	if !ok {
+		this.flush()
+	}
+	for ok && !this.halted {
+		sealed.Seal(now)
+		if this.save() {
+			break
 		}
+		this.reapply() // the version read is sealed once more
 	}
+	this.pending = this.pending[0:0]
+
+	if archived, ok := this.document.(projector.ArchivedCopyDocument); ok && !this.halted && len(archived.ArchivePath()) > 0 {
+		if err := this.storage.Write(persist.NewDocumentCopy(archived, archived.ArchivePath())); err != nil {
+			log.Printf("[WARN] Unable to write the archived copy of document [%s] to [%s]: %s", archived.Path(), archived.ArchivePath(), err)
+		}
+	}
+}
+
+// load reads a document which is sealed once lapsed but which this process hasn't yet read or
+// written (e.g. after a restart), reapplying the messages not yet written; otherwise the
+// sealed document, written unconditionally, would replace the version stored.
+func (this *simpleTransformer) load() {
+	if _, ok := this.document.(projector.SealedDocument); !ok || this.loaded {
+		return
+	}
+
+	this.loaded = true
+	if this.document.Version() != nil {
+		return
+	}
+
+	this.read()
+	this.reapply()
+}
+func (this *simpleTransformer) reapply() bool {
+	modified, applied := this.apply(this.pending)
+	this.pending = applied
 	return modified
 }
+
+// apply gives back the messages applied, which excludes any message that panicked. Messages
+// the document has already applied are kept, as they may need to be applied to the version
+// read after a conflicting write, which may not have applied them.
+func (this *simpleTransformer) apply(messages []interface{}) (modified bool, applied []interface{}) {
+	applied = make([]interface{}, 0, len(messages))
+	for _, message := range messages {
+		_, _, untimed := untime(message)
+		id, identified, body := unidentify(untimed)
+		if body == nil {
+			continue
+		}
+
+		deduplicating, _ := this.document.(projector.DeduplicatingDocument)
+		if identified && deduplicating != nil && deduplicating.Applied(id) {
+			applied = append(applied, message)
+			continue
+		}
+
+		changed, recovered := this.applyMessage(message, body)
+		if this.halted {
+			this.pending = this.pending[0:0] // the changes made so far are discarded
+			return false, nil
+		} else if recovered {
+			continue
+		}
+
+		if identified && deduplicating != nil {
+			deduplicating.Remember(id)
+		}
+		modified = changed || modified
+		applied = append(applied, message)
+	}
+	return modified, applied
+}
+
+// applyMessage applies the body of the message, unless the document rejects it; the message,
+// as delivered, is dead-lettered when rejected or when the document panics.
+func (this *simpleTransformer) applyMessage(message, body interface{}) (modified, recovered bool) {
+	defer func() {
+		if panicked := recover(); panicked != nil {
+			recovered = true
+			this.halted = !this.quarantine.Recover(this.document.Path(), "Apply", message, panicked)
+		}
+	}()
+
+	if validating, ok := this.document.(projector.ValidatingDocument); ok {
+		if err := validating.Validate(body); err != nil {
+			this.quarantine.Reject(this.document.Path(), deadLetterRejected, message, err.Error())
+			return false, true
+		}
+	}
+
+	return this.document.Apply(body), false
+}
+
+// refused counts the writes refused by storage and, once there have been too many in a row,
+// abandons the messages not yet written, which are dead-lettered, rather than reapplying them
+// indefinitely; it reports whether the messages were abandoned.
+func (this *simpleTransformer) refused(err error) bool {
+	log.Printf("[WARN] Error writing document [%s]: %s", this.document.Path(), err)
+	if this.failures++; this.failures < maxRefusedWrites {
+		return false
+	}
+
+	this.failures = 0
+	this.halted = !this.quarantine.Abandon(this.document.Path(), this.pending, err)
+	this.pending = this.pending[0:0]
+	return true
+}
+
+const maxRefusedWrites = 3
+
+// lapse gives back the current document when Lapse panics.
+func (this *simpleTransformer) lapse(now time.Time) (next projector.Document) {
+	defer func() {
+		if panicked := recover(); panicked != nil {
+			this.halted = !this.quarantine.Recover(this.document.Path(), "Lapse", nil, panicked)
+			next = this.document
+		}
+	}()
+
+	return this.document.Lapse(now)
+}
 func (this *simpleTransformer) save() bool {
-	if err := this.storage.Write(this.document); err == nil {
+	_, partitioned := this.document.(projector.PartitionedDocument)
+	observed := this.publication != nil || partitioned
+
+	var previous interface{}
+	if observed {
+		previous = this.document.Version()
+	}
+
+	err := this.storage.Write(this.document)
+	if err == nil {
+		this.failures = 0
+		if observed && committed(previous, this.document.Version()) {
+			this.index.Written(this.document, !this.retired)
+			this.publish(previous)
+		}
 		return true
 	}
 
+	abandoned := err != persist.ErrConcurrentWrite && this.refused(err)
+	this.read()
+	return abandoned // otherwise save didn't complete, messages need to be reapplied
+}
+
+// read gives the document the version stored, trying until storage can be read.
+func (this *simpleTransformer) read() {
 	for {
 		this.document.Reset()
 
 		if err := this.storage.Read(this.document); err == nil {
-			return false // save didn't complete, messages need to be reapplied
+			this.remember()
+			return
 		} else {
 			log.Printf("[WARN] Error reading document [%s]: %s", this.document.Path(), err)
 		}
@@ -57,6 +57,13 @@ func (this *TransformerFixture) TestAllDocumentsTransformedAndWritten() {
 	this.So(applyTimes, should.NotBeChronological)
 }
 
+func (this *TransformerFixture) TestValueDocumentsNeedNotBeComparable() {
+	transformer := newTransformer(this.store, ValueDocument{tags: []string{"value"}})
+
+	this.So(func() { transformer.Transform(this.now, this.messages) }, should.NotPanic)
+	this.So(func() { transformer.Transform(this.now, this.messages) }, should.NotPanic)
+}
+
 func (this *TransformerFixture) TestFailedWriteRetried() {
 	document := &FakeDocument{}
 	this.documents = []*FakeDocument{document}
@@ -71,6 +78,74 @@ func (this *TransformerFixture) TestFailedWriteRetried() {
 	this.So(this.store.reads[document.Path()], should.Equal, document)
 }
 
+func (this *TransformerFixture) TestDeferredTransformerWritesOnlyWhenFlushed() {
+	document := &FakeDocument{}
+	this.transformer = newDeferredTransformer(this.store, document)
+
+	this.transformer.Transform(this.now, this.messages)
+	this.transformer.Transform(this.now, []interface{}{4})
+
+	this.So(this.store.writeCount, should.Equal, 0)
+
+	this.transformer.Flush()
+	this.transformer.Flush()
+
+	this.So(this.store.writeCount, should.Equal, 1)
+	this.So(document.messages, should.Resemble, []interface{}{"1", 2, 3.0, 4})
+}
+
+func (this *TransformerFixture) TestDeferredTransformerReappliesEveryPendingMessage() {
+	document := &FakeDocument{}
+	this.transformer = newDeferredTransformer(this.store, document)
+	this.store.writeErrorCount = 1
+
+	this.transformer.Transform(this.now, this.messages)
+	this.transformer.Transform(this.now, []interface{}{4})
+	this.transformer.Flush()
+
+	this.So(document.reset, should.Equal, 1)
+	this.So(this.store.writeCount, should.Equal, 2)
+	this.So(document.messages, should.Resemble, []interface{}{"1", 2, 3.0, 4, "1", 2, 3.0, 4})
+}
+
+func (this *TransformerFixture) TestDeferredTransformerFlushesOutgoingDocumentOnLapse() {
+	outgoing := &FakeDocument{index: 1}
+	outgoing.next = &FakeDocument{index: 2}
+	this.transformer = newDeferredTransformer(this.store, outgoing)
+
+	this.transformer.Transform(this.now, this.messages)
+	this.transformer.Transform(this.now, this.messages)
+
+	this.So(this.store.writes[outgoing.Path()], should.Equal, outgoing)
+	this.So(this.store.writes, should.HaveLength, 1)
+}
+
+func (this *TransformerFixture) TestWorkersBoundConcurrentWrites() {
+	this.store.delay = time.Millisecond
+	this.transformer.(*multiTransformer).WithWorkers(3)
+
+	this.transformer.Transform(this.now, this.messages)
+
+	this.So(this.store.writeCount, should.Equal, len(this.documents))
+	this.So(this.store.maxActive, should.BeLessThanOrEqualTo, 3)
+	for _, document := range this.documents {
+		this.So(this.store.writes[document.Path()], should.Equal, document)
+	}
+}
+
+func (this *TransformerFixture) TestWorkersStartWithDifferentDocumentsEachRound() {
+	transformer := this.transformer.(*multiTransformer).WithWorkers(3)
+
+	first := <-transformer.schedule(len(this.documents))
+	second := <-transformer.schedule(len(this.documents))
+	queue := transformer.schedule(len(this.documents))
+
+	this.So(first, should.Equal, 0)
+	this.So(second, should.Equal, 3)
+	this.So(<-queue, should.Equal, 6)
+	this.So(len(queue), should.Equal, len(this.documents)-1) // every document is queued
+}
+
 /* ////////////////////////////////////////////////////////////////////////////////////////////////////////////////// */
 
 type FakeStorage struct {
@@ -79,6 +154,10 @@ type FakeStorage struct {
 	writes          map[string]projector.Document
 	writeCount      int
 	writeErrorCount int
+	writeError      error // instead of a conflict
+	delay           time.Duration
+	active          int
+	maxActive       int
 }
 
 func NewFakeStorage() *FakeStorage {
@@ -94,6 +173,10 @@ func (this *FakeStorage) Read(document projector.Document) error {
 	return nil
 }
 func (this *FakeStorage) Write(document projector.Document) error {
+	this.enter()
+	time.Sleep(this.delay)
+	defer this.exit()
+
 	this.mutex.Lock()
 	defer this.mutex.Unlock()
 
@@ -101,11 +184,26 @@ func (this *FakeStorage) Write(document projector.Document) error {
 
 	if this.writeCount++; this.writeCount >= this.writeErrorCount+1 {
 		return nil
+	} else if this.writeError != nil {
+		return this.writeError
 	} else {
 		return persist.ErrConcurrentWrite
 	}
 }
 
+func (this *FakeStorage) enter() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.active++; this.active > this.maxActive {
+		this.maxActive = this.active
+	}
+}
+func (this *FakeStorage) exit() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.active--
+}
+
 type FakeDocument struct {
 	index     int
 	apply     int
@@ -114,6 +212,7 @@ type FakeDocument struct {
 	now       time.Time
 	messages  []interface{}
 	version   interface{}
+	next      *FakeDocument // returned by Lapse once the document has been applied
 }
 
 func (this *FakeDocument) Apply(message interface{}) bool {
@@ -122,9 +221,25 @@ func (this *FakeDocument) Apply(message interface{}) bool {
 	this.messages = append(this.messages, message)
 	return true
 }
-func (this *FakeDocument) Lapse(now time.Time) (next projector.Document) { this.now = now; return this }
-func (this *FakeDocument) Path() string                                  { return fmt.Sprintf("/%d", this.index) }
-func (this *FakeDocument) Reset()                                        { this.reset++ }
-func (this *FakeDocument) SetVersion(value interface{})                  { this.version = value }
-func (this *FakeDocument) Version() interface{}                          { panic("nop") }
-func utcNow() time.Time                                                  { return time.Now().UTC() }
+func (this *FakeDocument) Lapse(now time.Time) (next projector.Document) {
+	this.now = now
+	if this.next != nil && this.apply > 0 {
+		return this.next
+	}
+	return this
+}
+func (this *FakeDocument) Path() string                 { return fmt.Sprintf("/%d", this.index) }
+func (this *FakeDocument) Reset()                       { this.reset++ }
+func (this *FakeDocument) SetVersion(value interface{}) { this.version = value }
+func (this *FakeDocument) Version() interface{}         { panic("nop") }
+func utcNow() time.Time                                 { return time.Now().UTC() }
+
+// ValueDocument isn't comparable (because of the slice), nor is it modified by Apply.
+type ValueDocument struct{ tags []string }
+
+func (this ValueDocument) Lapse(time.Time) projector.Document { return this }
+func (this ValueDocument) Apply(interface{}) bool             { return true }
+func (this ValueDocument) Path() string                       { return "/value" }
+func (this ValueDocument) Reset()                             {}
+func (this ValueDocument) SetVersion(interface{})             {}
+func (this ValueDocument) Version() interface{}               { return nil }
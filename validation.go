@@ -0,0 +1,9 @@
+package projector
+
+// ValidatingDocument is implemented by documents which reject some messages outright, e.g. those
+// breaking a business rule. A message for which Validate gives back an error isn't applied and
+// is recorded as a dead letter instead.
+type ValidatingDocument interface {
+	Document
+	Validate(message interface{}) error
+}